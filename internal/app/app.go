@@ -2,68 +2,108 @@ package app
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
-	"github.com/AdityaKK0407/sentryvault/internal/cipher"
 	"github.com/AdityaKK0407/sentryvault/internal/database"
 	"github.com/AdityaKK0407/sentryvault/internal/model"
+	"github.com/AdityaKK0407/sentryvault/internal/vault"
 	tea "github.com/charmbracelet/bubbletea"
-	bolt "go.etcd.io/bbolt"
 )
 
-func RunAuth(files []string) (string, string, bool, error) {
+func RunAuth(files []string) (string, vault.Credentials, bool, error) {
 	if len(files) == 0 {
-		username, password, err := CreateUser()
+		username, creds, err := CreateUser()
 		if err != nil {
-			return "", "", false, err
+			return "", vault.Credentials{}, false, err
 		}
-		return username, password, true, err
+		return username, creds, true, err
 	} else {
 		return SelectUser(files)
 	}
 }
 
-func RunCipher(db *bolt.DB, username, password string, newUser bool) ([]byte, error) {
+// RunCipher creates or opens the vault and returns it with its key. The
+// caller closes the store.
+func RunCipher(username string, creds vault.Credentials, newUser bool) (database.VaultStore, []byte, error) {
+	open := vault.Open
 	if newUser {
-		salt, err := cipher.GenerateRandomSalt()
-		if err != nil {
-			return nil, err
-		}
-		cipherKey32 := cipher.DeriveEncryptionKey32([]byte(password), salt)
+		open = vault.Create
+	}
+	store, cipherKey32, err := open(username, creds)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, cipherKey32, nil
+}
 
-		title := username + "'s Vault"
-		combinedTitle, err := cipher.EncryptAESGCM(cipherKey32, []byte(title))
-		if err != nil {
-			return nil, err
-		}
+// RunModel shows the unlocked vault until the program ends. actor names who
+// unlocked it in the audit log.
+func RunModel(store database.VaultStore, username, actor string, cipherKey32, cipherKey64 []byte) error {
+	if _, err := store.PurgeExpiredTrash(); err != nil {
+		return err
+	}
 
-		if err = database.SetHeaders(db, combinedTitle, salt); err != nil {
-			return nil, err
+	// Vaults switched to from inside the program are closed here, the one
+	// passed in is closed by the caller.
+	opened := store
+	defer func() {
+		if store != opened {
+			store.Close()
 		}
+	}()
 
-		return cipherKey32, nil
-	} else {
-		combinedTitle, salt, err := database.GetHeaders(db)
-		cipherKey32 := cipher.DeriveEncryptionKey32([]byte(password), salt)
-		_, err = cipher.DecryptAESGCM(cipherKey32, combinedTitle)
-
+	for {
+		p := tea.NewProgram(model.InitialMainModel(store, username, actor, cipherKey32, cipherKey64))
+		m, err := p.Run()
 		if err != nil {
-			return nil, errors.New("invalid password")
+			return err
+		}
+		finalModel, ok := m.(model.MainModel)
+		if !ok {
+			return nil
+		}
+		store, username, actor, cipherKey32 = finalModel.Vault()
+		finalModel.ClearClipboard()
+		if finalModel.Err != nil {
+			return finalModel.Err
+		}
+		if !finalModel.Locked {
+			return autoCompact(store, username)
+		}
+		if store, cipherKey32, actor, err = unlockAgain(store, username); err != nil {
+			return err
 		}
-
-		return cipherKey32, nil
 	}
 }
 
-func RunModel(db *bolt.DB, cipherKey32, cipherKey64 []byte) error {
-	p := tea.NewProgram(model.InitialMainModel(db, cipherKey32, cipherKey64))
-	m, err := p.Run()
-	if err != nil {
-		return err
+// unlockAgain asks for the password of a vault that locked itself after
+// being left alone, until it is given correctly or the prompt is aborted.
+// The vault is closed and opened again as at the start, so that the duress
+// password opens the decoy here too. It returns the vault, its key and who
+// unlocked it.
+func unlockAgain(store database.VaultStore, username string) (database.VaultStore, []byte, string, error) {
+	fmt.Printf("%s's vault was locked after a period of inactivity\n", username)
+	if err := store.Close(); err != nil {
+		return store, nil, "", err
 	}
-	if finalModel, ok := m.(model.MainModel); ok {
-		if finalModel.Err != nil {
-			return finalModel.Err
+	for {
+		creds, err := PromptCredentials("")
+		if err != nil {
+			return store, nil, "", err
+		}
+		opened, cipherKey32, err := vault.Open(username, creds)
+		if err == nil {
+			return opened, cipherKey32, creds.Actor(), nil
+		}
+		if errors.Is(err, vault.ErrWiped) {
+			return store, nil, "", err
+		}
+		fmt.Println(err)
+		// Wait out the back-off instead of failing every attempt before it
+		var locked *vault.LockedOutError
+		if errors.As(err, &locked) {
+			time.Sleep(time.Until(locked.Until))
 		}
 	}
-	return nil
 }
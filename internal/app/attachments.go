@@ -0,0 +1,127 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+)
+
+func runAttach(args []string) error {
+	fs := flag.NewFlagSet("attach", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault attach -vault NAME [-name NAME] ENTRY FILE")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "keyfile of the vault, if it has one")
+	name := fs.String("name", "", "name of the attachment (default: the file name)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected ENTRY and FILE arguments")
+	}
+	if *name == "" {
+		*name = filepath.Base(fs.Arg(1))
+	}
+
+	store, cipherKey32, audit, err := unlockLogged(*username, *keyfile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	entry, err := resolveEntry(store, cipherKey32, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err = database.AttachFile(store, cipherKey32, []byte(entry), []byte(*name), fs.Arg(1), *username); err != nil {
+		return err
+	}
+	if err = audit.Log(auditlog.Attach, entry, *name, ""); err != nil {
+		return err
+	}
+	fmt.Printf("Attached \"%s\" to \"%s\"\n", *name, fs.Arg(0))
+	return nil
+}
+
+func runExtract(args []string) error {
+	fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault extract -vault NAME ENTRY")
+		fmt.Fprintln(fs.Output(), "  sentryvault extract -vault NAME [-o PATH] ENTRY ATTACHMENT")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "keyfile of the vault, if it has one")
+	output := fs.String("o", "", "file to write the attachment to, - for stdout (default: the attachment name)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 && fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected ENTRY and optionally ATTACHMENT arguments")
+	}
+
+	store, cipherKey32, audit, err := unlockLogged(*username, *keyfile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	entry, err := resolveEntry(store, cipherKey32, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() == 1 {
+		attachments, err := store.GetAttachments([]byte(entry))
+		if err != nil {
+			return err
+		}
+		if len(attachments) == 0 {
+			fmt.Printf("\"%s\" has no attachments\n", fs.Arg(0))
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ATTACHMENT\tSIZE\tADDED\tBY")
+		for _, attachment := range attachments {
+			metadata, err := database.OpenAttachmentMetadata(cipherKey32, attachment[1])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+				attachment[0],
+				database.FormatSize(metadata.Size),
+				metadata.Added.Local().Format("2006-01-02 15:04"),
+				metadata.AddedBy,
+			)
+		}
+		return w.Flush()
+	}
+
+	name := fs.Arg(1)
+	if *output == "" {
+		*output = filepath.Base(name)
+	}
+	if err = audit.Log(auditlog.Export, entry, name, "extracted to "+*output); err != nil {
+		return err
+	}
+	if *output == "-" {
+		return database.ExtractAttachment(store, cipherKey32, []byte(entry), []byte(name), os.Stdout)
+	}
+	if err = database.ExtractAttachmentFile(store, cipherKey32, []byte(entry), []byte(name), *output); err != nil {
+		return err
+	}
+	fmt.Printf("Extracted \"%s\" to %s\n", name, *output)
+	return nil
+}
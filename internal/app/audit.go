@@ -0,0 +1,61 @@
+package app
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/config"
+	"github.com/AdityaKK0407/sentryvault/internal/health"
+)
+
+func runAudit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault audit -vault NAME [-breach-list PATH] [-fail]")
+		fmt.Fprintln(fs.Output(), "\nPrints the weak, reused, stale and breached secrets of the vault as JSON.")
+		fmt.Fprintln(fs.Output(), "Thresholds come from the [health] section of the configuration.")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "keyfile of the vault, if it has one")
+	breachList := fs.String("breach-list", "", "Have I Been Pwned hash file or range directory (default: health.breach_list)")
+	fail := fs.Bool("fail", false, "exit with an error when there are findings")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if *breachList != "" {
+		cfg.Health.BreachList = *breachList
+	}
+	store, cipherKey32, audit, err := unlockLogged(*username, *keyfile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	report, err := health.Check(store, cipherKey32, cfg.Health, time.Now())
+	if err != nil {
+		return err
+	}
+	if err = audit.Log(auditlog.Check, "", "", fmt.Sprintf("security report of %d secrets", report.Checked)); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(report); err != nil {
+		return err
+	}
+	if *fail && len(report.Findings) > 0 {
+		return fmt.Errorf("audit found %d problems", len(report.Findings))
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+)
+
+func runAuditLog(args []string) error {
+	fs := flag.NewFlagSet("audit-log", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault audit-log list -vault NAME [-actor NAME] [-action ACTION] [-entry ENTRY]")
+		fmt.Fprintln(fs.Output(), "  sentryvault audit-log verify -vault NAME")
+		fmt.Fprintln(fs.Output(), "\nThe audit log records who unlocked the vault and what they read or changed.")
+		fmt.Fprintln(fs.Output(), "verify checks that no record was changed or removed, and fails if one was.")
+		fmt.Fprintf(fs.Output(), "\nActions: %s\n", actionNames())
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "keyfile of the vault, if it has one")
+	actor := fs.String("actor", "", "only list records of this member, or owner")
+	action := fs.String("action", "", "only list records of this action")
+	entry := fs.String("entry", "", "only list records of this entry")
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("expected list or verify")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		store, cipherKey32, err := unlockVault(*username, *keyfile)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		records, err := auditlog.Read(store, cipherKey32)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SEQ\tTIME\tACTOR\tACTION\tENTRY\tKEY\tDETAIL")
+		for _, r := range records {
+			if (*actor != "" && r.Actor != *actor) || (*action != "" && string(r.Action) != *action) || (*entry != "" && r.Entry != *entry) {
+				continue
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Seq, r.Time.Local().Format("2006-01-02 15:04:05"), r.Actor, r.Action, r.Entry, r.Key, r.Detail)
+		}
+		return w.Flush()
+	case "verify":
+		store, cipherKey32, err := unlockVault(*username, *keyfile)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		result, err := auditlog.Verify(store, cipherKey32)
+		if err != nil {
+			return err
+		}
+		if !result.OK() {
+			for _, p := range result.Problems {
+				fmt.Println(p)
+			}
+			return fmt.Errorf("the audit log of \"%s\" was tampered with, %d problems found", *username, len(result.Problems))
+		}
+		fmt.Printf("The audit log of \"%s\" is intact, %d records checked\n", *username, result.Records)
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown audit-log command %q", args[0])
+	}
+}
+
+func actionNames() string {
+	names := make([]string, len(auditlog.Actions))
+	for i, action := range auditlog.Actions {
+		names[i] = string(action)
+	}
+	return strings.Join(names, ", ")
+}
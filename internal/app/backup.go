@@ -0,0 +1,65 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/AdityaKK0407/sentryvault/internal/config"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+	"github.com/AdityaKK0407/sentryvault/internal/vault"
+)
+
+func runBackup(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault backup -vault NAME")
+		fmt.Fprintln(fs.Output(), "  sentryvault backup -vault NAME -list")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	list := fs.Bool("list", false, "list the backups of the vault")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		fs.Usage()
+		return errors.New("missing -vault flag")
+	}
+
+	if *list {
+		backups, err := database.GetBackups(*username)
+		if err != nil {
+			return err
+		}
+		for _, backup := range backups {
+			fmt.Println(backup)
+		}
+		return nil
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	exists, err := vault.Exists(*username)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("vault %q not found", *username)
+	}
+	store, err := database.OpenStore(*username)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	path, err := store.Backup(*username, cfg.Backup.Retention)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up \"%s\" to %s, keeping the last %d backups\n", *username, path, cfg.Backup.Retention)
+	return nil
+}
@@ -0,0 +1,164 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+	"github.com/AdityaKK0407/sentryvault/internal/vault"
+)
+
+const usage = `Usage: sentryvault [command] [flags]
+
+Run without a command to open the interactive vault.
+
+Commands:
+  history   list, restore and configure previous versions of a field
+  trash     list, restore and purge deleted entries and fields
+  rename    rename an entry or one of its keys
+  ls        list entries by folder and tag
+  attach    encrypt a file and attach it to an entry
+  extract   list or decrypt the attachments of an entry
+  audit     report weak, reused, stale and breached secrets as JSON
+  audit-log list the audit log of a vault or verify its chain
+  keyfile   create a keyfile, or add or remove one as a second factor
+  lockout   show or set what happens after failed unlocks
+  duress    set or remove a password that opens a decoy vault
+  members   list, add and revoke the members of a shared vault
+  recovery  create, split into shares or remove the recovery key
+  recover   unlock with the recovery key or shares and set a new password
+  generate  generate a password following the configured policy
+  backup    back up a vault, keeping the configured number of backups
+  compact   shrink a vault file and overwrite what was deleted from it
+  fsck      check a vault for damage and quarantine what cannot be read
+  config    check or create the configuration file
+
+Entries can be given by name or by folder path, e.g. work/aws/prod.
+`
+
+func RunCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "history":
+		return runHistory(args[1:])
+	case "trash":
+		return runTrash(args[1:])
+	case "rename":
+		return runRename(args[1:])
+	case "ls":
+		return runList(args[1:])
+	case "attach":
+		return runAttach(args[1:])
+	case "extract":
+		return runExtract(args[1:])
+	case "audit":
+		return runAudit(args[1:])
+	case "audit-log":
+		return runAuditLog(args[1:])
+	case "keyfile":
+		return runKeyfile(args[1:])
+	case "lockout":
+		return runLockout(args[1:])
+	case "duress":
+		return runDuress(args[1:])
+	case "members":
+		return runMembers(args[1:])
+	case "recovery":
+		return runRecovery(args[1:])
+	case "recover":
+		return runRecover(args[1:])
+	case "generate":
+		return runGenerate(args[1:])
+	case "backup":
+		return runBackup(args[1:])
+	case "compact":
+		return runCompact(args[1:])
+	case "fsck":
+		return runFsck(args[1:])
+	case "config":
+		return runConfig(args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+	}
+}
+
+// unlockVault prompts for the credentials of an existing vault and returns
+// the open store together with its key. The caller closes the store.
+func unlockVault(username, keyfile string) (database.VaultStore, []byte, error) {
+	store, cipherKey32, _, err := openVault(username, keyfile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return store, cipherKey32, nil
+}
+
+// unlockLogged is unlockVault, also returning the audit log of the vault
+// for whoever unlocked it.
+func unlockLogged(username, keyfile string) (database.VaultStore, []byte, auditlog.Logger, error) {
+	store, cipherKey32, creds, err := openVault(username, keyfile)
+	if err != nil {
+		return nil, nil, auditlog.Logger{}, err
+	}
+	return store, cipherKey32, auditlog.NewLogger(store, cipherKey32, creds.Actor()), nil
+}
+
+// openVault is unlockVault for commands working on the vault file itself,
+// also returning the credentials given.
+func openVault(username, keyfile string) (database.FileStore, []byte, vault.Credentials, error) {
+	var creds vault.Credentials
+	if username == "" {
+		return nil, nil, creds, errors.New("missing -vault flag")
+	}
+	exists, err := vault.Exists(username)
+	if err != nil {
+		return nil, nil, creds, err
+	}
+	if !exists {
+		return nil, nil, creds, fmt.Errorf("vault %q not found", username)
+	}
+
+	if creds, err = PromptCredentials(keyfile); err != nil {
+		return nil, nil, creds, err
+	}
+	store, cipherKey32, err := vault.Open(username, creds)
+	if err != nil {
+		return nil, nil, creds, err
+	}
+	return store, cipherKey32, creds, nil
+}
+
+// resolveEntry accepts an entry by name or by folder path, such as
+// "work/aws/prod", and returns the name it is stored under.
+func resolveEntry(store database.VaultStore, cipherKey32 []byte, path string) (string, error) {
+	pairs, err := store.GetEntriesMetadata()
+	if err != nil {
+		return "", err
+	}
+	for _, pair := range pairs {
+		if string(pair[0]) == path {
+			return path, nil
+		}
+	}
+
+	folder, name := database.SplitEntryPath(path)
+	for _, pair := range pairs {
+		if string(pair[0]) != name {
+			continue
+		}
+		metadata, err := database.OpenEntryMetadata(cipherKey32, pair[1])
+		if err != nil {
+			return "", err
+		}
+		if metadata.Folder != folder {
+			return "", fmt.Errorf("entry \"%s\" is in folder \"%s\"", name, metadata.Folder)
+		}
+		return name, nil
+	}
+	return "", fmt.Errorf("entry \"%s\" %w", path, database.ErrNotFound)
+}
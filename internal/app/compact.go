@@ -0,0 +1,72 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/AdityaKK0407/sentryvault/internal/config"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+)
+
+func runCompact(args []string) error {
+	fs := flag.NewFlagSet("compact", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault compact -vault NAME")
+		fmt.Fprintln(fs.Output(), "\nDeleted items stay in the free space of the vault file until it is compacted.")
+		fmt.Fprintln(fs.Output(), "compact rewrites the vault into a fresh file and overwrites the old one.")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "keyfile of the vault, if it has one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Unlocking first refuses a vault of a newer version, which this one
+	// would rewrite without knowing its layout
+	store, _, _, err := openVault(*username, *keyfile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	result, err := store.Compact()
+	if err != nil {
+		return err
+	}
+	printCompacted(*username, result)
+	return nil
+}
+
+// autoCompact compacts a vault once its free space passes the configured
+// threshold, which closes the store. A store without a file, such as a
+// MemoryStore, has nothing to compact.
+func autoCompact(store database.VaultStore, username string) error {
+	file, ok := store.(database.FileStore)
+	if !ok {
+		return nil
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if cfg.Compact.Threshold == 0 {
+		return nil
+	}
+	ratio, err := file.FreeRatio()
+	if err != nil || ratio < cfg.Compact.Threshold {
+		return err
+	}
+	result, err := file.Compact()
+	if err != nil {
+		return err
+	}
+	printCompacted(username, result)
+	return nil
+}
+
+func printCompacted(username string, result database.CompactResult) {
+	fmt.Printf("Compacted \"%s\" from %s to %s, reclaiming %s\n", username,
+		database.FormatSize(result.Before), database.FormatSize(result.After), database.FormatSize(result.Reclaimed()))
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/AdityaKK0407/sentryvault/internal/config"
+)
+
+func runConfig(args []string) error {
+	fs := flag.NewFlagSet("config", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault config check [-file PATH]")
+		fmt.Fprintln(fs.Output(), "  sentryvault config init [-file PATH]")
+		fs.PrintDefaults()
+	}
+	defaultPath, err := config.Path()
+	if err != nil {
+		return err
+	}
+	path := fs.String("file", defaultPath, "configuration file")
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("expected check or init")
+	}
+	if err = fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "check":
+		if _, err = config.LoadFile(*path); err != nil {
+			return err
+		}
+		fmt.Printf("%s: OK\n", *path)
+		return nil
+	case "init":
+		if err = config.WriteDefault(*path); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote the default configuration to %s\n", *path)
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown config command %q", args[0])
+	}
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/AdityaKK0407/sentryvault/internal/vault"
+)
+
+func runDuress(args []string) error {
+	fs := flag.NewFlagSet("duress", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault duress set -vault NAME")
+		fmt.Fprintln(fs.Output(), "  sentryvault duress remove -vault NAME")
+		fmt.Fprintln(fs.Output(), "\nA duress password opens a decoy in place of the vault, wherever the vault")
+		fmt.Fprintln(fs.Output(), "password is asked for. Setting it empties the decoy: unlock with it and add")
+		fmt.Fprintln(fs.Output(), "a few plausible entries. Nothing in the vault shows that one is set.")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "keyfile of the vault, if it has one")
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("expected set or remove")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *username == "" {
+		return errors.New("missing -vault flag")
+	}
+	exists, err := vault.Exists(*username)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("vault %q not found", *username)
+	}
+
+	switch args[0] {
+	case "set":
+		creds, err := PromptCredentials(*keyfile)
+		if err != nil {
+			return err
+		}
+		password, err := promptNewPassword("Enter the duress password")
+		if err != nil {
+			return err
+		}
+		if err = vault.SetDuress(*username, creds, password); err != nil {
+			return err
+		}
+		fmt.Printf("The duress password now opens an empty decoy of \"%s\"\n", *username)
+		return nil
+	case "remove":
+		creds, err := PromptCredentials(*keyfile)
+		if err != nil {
+			return err
+		}
+		if err = vault.RemoveDuress(*username, creds); err != nil {
+			return err
+		}
+		fmt.Printf("\"%s\" no longer has a duress password, its decoy was emptied\n", *username)
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown duress command %q", args[0])
+	}
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+)
+
+func runFsck(args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault fsck -vault NAME [-repair]")
+		fmt.Fprintln(fs.Output(), "\nfsck authenticates every ciphertext of the vault and checks its file, header")
+		fmt.Fprintln(fs.Output(), "and audit log. -repair moves damaged fields, versions and attachments into a")
+		fmt.Fprintln(fs.Output(), "quarantine so the rest of their entries can be used again.")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "keyfile of the vault, if it has one")
+	repair := fs.Bool("repair", false, "quarantine the damaged items")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, cipherKey32, creds, err := openVault(*username, *keyfile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	audit := auditlog.NewLogger(store, cipherKey32, creds.Actor())
+
+	report, err := store.Check(cipherKey32, *repair)
+	if err != nil {
+		return err
+	}
+	log, err := auditlog.Verify(store, cipherKey32)
+	if err != nil {
+		return err
+	}
+	unrepaired := 0
+	for _, d := range report.Damage {
+		fmt.Println(d)
+		if !d.Quarantined {
+			unrepaired++
+		}
+	}
+	for _, p := range log.Problems {
+		fmt.Printf("AuditLog: %s\n", p)
+	}
+
+	detail := fmt.Sprintf("fsck of %d items, %d damaged", report.Checked, len(report.Damage))
+	if *repair {
+		detail += ", repaired"
+	}
+	if err = audit.Log(auditlog.Check, "", "", detail); err != nil {
+		return err
+	}
+
+	quarantined, err := store.QuarantineCount()
+	if err != nil {
+		return err
+	}
+	if quarantined > 0 {
+		fmt.Printf("%d items are in quarantine\n", quarantined)
+	}
+	if unrepaired > 0 || !log.OK() {
+		if unrepaired > 0 && !*repair {
+			return fmt.Errorf("vault \"%s\" is damaged, %d problems found, run with -repair to quarantine them", *username, unrepaired+len(log.Problems))
+		}
+		return fmt.Errorf("vault \"%s\" is damaged, %d problems found", *username, unrepaired+len(log.Problems))
+	}
+	if len(report.Damage) > 0 {
+		fmt.Printf("Vault \"%s\" was repaired, %d items checked\n", *username, report.Checked)
+		return nil
+	}
+	fmt.Printf("Vault \"%s\" is intact, %d items checked\n", *username, report.Checked)
+	return nil
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/AdityaKK0407/sentryvault/internal/config"
+	"github.com/AdityaKK0407/sentryvault/internal/generator"
+)
+
+func runGenerate(args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	policy := cfg.Generator
+
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault generate [-length N] [-symbols=false] ...")
+		fmt.Fprintln(fs.Output(), "\nDefaults come from the [generator] section of the configuration.")
+		fs.PrintDefaults()
+	}
+	fs.IntVar(&policy.Length, "length", policy.Length, "password length")
+	fs.BoolVar(&policy.Lowercase, "lowercase", policy.Lowercase, "include lowercase letters")
+	fs.BoolVar(&policy.Uppercase, "uppercase", policy.Uppercase, "include uppercase letters")
+	fs.BoolVar(&policy.Digits, "digits", policy.Digits, "include digits")
+	fs.BoolVar(&policy.Symbols, "symbols", policy.Symbols, "include symbols")
+	fs.BoolVar(&policy.ExcludeAmbiguous, "exclude-ambiguous", policy.ExcludeAmbiguous, "leave out characters such as l, 1, O and 0")
+	if err = fs.Parse(args); err != nil {
+		return err
+	}
+
+	password, err := generator.Generate(policy)
+	if err != nil {
+		return err
+	}
+	fmt.Println(password)
+	return nil
+}
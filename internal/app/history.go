@@ -0,0 +1,102 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+)
+
+func runHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault history -vault NAME ENTRY KEY")
+		fmt.Fprintln(fs.Output(), "  sentryvault history -vault NAME -restore ID ENTRY KEY")
+		fmt.Fprintln(fs.Output(), "  sentryvault history -vault NAME -retention N")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "keyfile of the vault, if it has one")
+	restore := fs.Uint64("restore", 0, "restore the version with this ID")
+	retention := fs.Int("retention", -1, "number of previous versions kept per field")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, cipherKey32, audit, err := unlockLogged(*username, *keyfile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if *retention >= 0 {
+		if err = database.SetHistoryRetention(store, *retention); err != nil {
+			return err
+		}
+		fmt.Printf("History retention set to %d versions\n", *retention)
+		return nil
+	}
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("expected ENTRY and KEY arguments")
+	}
+	name, err := resolveEntry(store, cipherKey32, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	entry, key := []byte(name), []byte(fs.Arg(1))
+
+	versions, err := store.GetHistory(entry, key)
+	if err != nil {
+		return err
+	}
+
+	if *restore != 0 {
+		for _, version := range versions {
+			if version.ID == *restore {
+				if err = database.RestoreVersion(store, cipherKey32, entry, key, version, *username); err != nil {
+					return err
+				}
+				if err = audit.Log(auditlog.Restore, name, fs.Arg(1), fmt.Sprintf("version %d", version.ID)); err != nil {
+					return err
+				}
+				fmt.Printf("Restored version %d of %s/%s\n", version.ID, entry, key)
+				return nil
+			}
+		}
+		return fmt.Errorf("version %d not found", *restore)
+	}
+
+	if len(versions) == 0 {
+		fmt.Println("No previous versions")
+		return nil
+	}
+	if err = audit.Log(auditlog.Reveal, name, fs.Arg(1), "previous versions"); err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCHANGED\tBY\tNOTE\tVALUE")
+	for _, version := range versions {
+		value, err := cipher.DecryptAESGCM(cipherKey32, version.Value)
+		if err != nil {
+			return err
+		}
+		metadata, err := database.OpenFieldMetadata(cipherKey32, version.Metadata)
+		if err != nil {
+			return err
+		}
+		changed := "-"
+		if !metadata.Modified.IsZero() {
+			changed = metadata.Modified.Local().Format("2006-01-02 15:04")
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", version.ID, changed, metadata.ChangedBy, metadata.Note, value)
+	}
+	return w.Flush()
+}
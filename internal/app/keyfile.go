@@ -0,0 +1,78 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/AdityaKK0407/sentryvault/internal/vault"
+)
+
+func runKeyfile(args []string) error {
+	fs := flag.NewFlagSet("keyfile", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault keyfile new PATH")
+		fmt.Fprintln(fs.Output(), "  sentryvault keyfile add -vault NAME [-keyfile CURRENT] PATH")
+		fmt.Fprintln(fs.Output(), "  sentryvault keyfile remove -vault NAME -keyfile CURRENT")
+		fmt.Fprintln(fs.Output(), "\nA vault with a keyfile needs both the password and the keyfile to unlock.")
+		fmt.Fprintln(fs.Output(), "Keep a copy of the keyfile somewhere safe, the vault cannot be opened without it.")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "current keyfile of the vault, if it has one")
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("expected new, add or remove")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "new":
+		if fs.NArg() != 1 {
+			fs.Usage()
+			return errors.New("expected a PATH argument")
+		}
+		if err := vault.GenerateKeyfile(fs.Arg(0)); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote a new keyfile to %s\n", fs.Arg(0))
+		return nil
+	case "add", "remove":
+		newKeyfile := ""
+		if args[0] == "add" {
+			if fs.NArg() != 1 {
+				fs.Usage()
+				return errors.New("expected a PATH argument")
+			}
+			newKeyfile = fs.Arg(0)
+		}
+		return changeKeyfile(*username, *keyfile, newKeyfile)
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown keyfile command %q", args[0])
+	}
+}
+
+// changeKeyfile unlocks a vault and protects it with the same password and
+// a new keyfile, or none, under a new key.
+func changeKeyfile(username, keyfile, newKeyfile string) error {
+	store, cipherKey32, creds, err := openVault(username, keyfile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if _, err = vault.SetCredentials(store, cipherKey32, vault.Credentials{Member: creds.Member, Password: creds.Password, Keyfile: newKeyfile}); err != nil {
+		return err
+	}
+	if newKeyfile == "" {
+		fmt.Printf("\"%s\" no longer needs a keyfile\n", username)
+	} else {
+		fmt.Printf("\"%s\" now needs the keyfile %s to unlock\n", username, newKeyfile)
+	}
+	fmt.Printf("Create a new recovery key if you had one: sentryvault recovery new -vault %s\n", username)
+	return nil
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+)
+
+func runList(args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault ls -vault NAME [-tag TAG] [FOLDER]")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "keyfile of the vault, if it has one")
+	tag := fs.String("tag", "", "only list entries with this tag")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errors.New("expected at most one FOLDER argument")
+	}
+	folder := database.CleanFolder(fs.Arg(0))
+
+	store, cipherKey32, err := unlockVault(*username, *keyfile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	pairs, err := store.GetEntriesMetadata()
+	if err != nil {
+		return err
+	}
+
+	type listing struct {
+		path string
+		tags string
+	}
+	var listings []listing
+	for _, pair := range pairs {
+		metadata, err := database.OpenEntryMetadata(cipherKey32, pair[1])
+		if err != nil {
+			return err
+		}
+		if folder != "" && metadata.Folder != folder && !strings.HasPrefix(metadata.Folder, folder+"/") {
+			continue
+		}
+		if *tag != "" && !metadata.HasTag(*tag) {
+			continue
+		}
+		listings = append(listings, listing{
+			path: database.JoinEntryPath(metadata.Folder, string(pair[0])),
+			tags: strings.Join(metadata.Tags, ", "),
+		})
+	}
+	sort.Slice(listings, func(i, j int) bool {
+		return listings[i].path < listings[j].path
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ENTRY\tTAGS")
+	for _, l := range listings {
+		fmt.Fprintf(w, "%s\t%s\n", l.path, l.tags)
+	}
+	return w.Flush()
+}
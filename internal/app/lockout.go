@@ -0,0 +1,68 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/AdityaKK0407/sentryvault/internal/vault"
+	"github.com/charmbracelet/huh"
+)
+
+func runLockout(args []string) error {
+	fs := flag.NewFlagSet("lockout", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault lockout -vault NAME")
+		fmt.Fprintln(fs.Output(), "  sentryvault lockout -vault NAME -wipe-after N")
+		fmt.Fprintln(fs.Output(), "\nAfter 3 failed unlocks every further attempt waits twice as long, up to an hour.")
+		fmt.Fprintln(fs.Output(), "With -wipe-after the key material is destroyed after N failures in a row,")
+		fmt.Fprintln(fs.Output(), "which makes the vault unrecoverable without a backup. 0 turns wiping off.")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "keyfile of the vault, if it has one")
+	wipeAfter := fs.Int("wipe-after", -1, "wipe the vault after this many failed unlocks in a row, 0 for never")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, _, _, err := openVault(*username, *keyfile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if *wipeAfter > 0 {
+		confirmed := false
+		err = huh.NewConfirm().
+			Title(fmt.Sprintf("WARNING: %d failed unlocks in a row will permanently destroy \"%s\"", *wipeAfter, *username)).
+			Description("Anyone who can type at your vault can then erase it. Only backups can bring it back.").
+			Affirmative("Enable wiping").
+			Negative("Cancel").
+			Value(&confirmed).
+			Run()
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			fmt.Println("Wiping was not enabled")
+			return nil
+		}
+	}
+	if *wipeAfter >= 0 {
+		if err = vault.SetWipeAfter(store, *wipeAfter); err != nil {
+			return err
+		}
+	}
+
+	state, _, err := vault.GetUnlockState(store)
+	if err != nil {
+		return err
+	}
+	if state.WipeAfter > 0 {
+		fmt.Printf("WARNING: \"%s\" is wiped after %d failed unlocks in a row\n", *username, state.WipeAfter)
+	} else {
+		fmt.Printf("\"%s\" is never wiped, failed unlocks only slow down further attempts\n", *username)
+	}
+	return nil
+}
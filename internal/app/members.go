@@ -0,0 +1,117 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/vault"
+	"github.com/charmbracelet/huh"
+)
+
+func runMembers(args []string) error {
+	fs := flag.NewFlagSet("members", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault members list -vault NAME")
+		fmt.Fprintln(fs.Output(), "  sentryvault members add -vault NAME MEMBER")
+		fmt.Fprintln(fs.Output(), "  sentryvault members revoke -vault NAME MEMBER")
+		fmt.Fprintln(fs.Output(), "\nMembers unlock a shared vault with their own password instead of the vault")
+		fmt.Fprintln(fs.Output(), "password. Only the owner, who has the vault password, adds and revokes them.")
+		fmt.Fprintln(fs.Output(), "Revoking rotates the vault key and removes the recovery key and shares.")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "keyfile of the vault, if it has one")
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("expected list, add or revoke")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if args[0] != "list" && fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected a MEMBER argument")
+	}
+
+	store, cipherKey32, creds, err := openVault(*username, *keyfile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "list":
+		members, err := vault.Members(store)
+		if err != nil {
+			return err
+		}
+		if len(members) == 0 {
+			fmt.Printf("\"%s\" has no members besides its owner\n", *username)
+			return nil
+		}
+		for _, member := range members {
+			fmt.Printf("%-20s  added %s  key %s\n", member.Name, member.Added.Local().Format("2006-01-02"), member.Fingerprint)
+		}
+		return nil
+	case "add":
+		if creds.Member != "" {
+			return errors.New("only the owner of the vault can add members")
+		}
+		name := fs.Arg(0)
+		password, err := promptNewPassword(fmt.Sprintf("%s, choose your password for \"%s\"", name, *username))
+		if err != nil {
+			return err
+		}
+		member, err := vault.AddMember(store, cipherKey32, name, password)
+		if err != nil {
+			return err
+		}
+		if err = auditlog.NewLogger(store, cipherKey32, creds.Actor()).Log(auditlog.Access, "", "", "added member "+name); err != nil {
+			return err
+		}
+		fmt.Printf("Added %s with key %s, who unlocks \"%s\" as member %s\n", member.Name, member.Fingerprint, *username, member.Name)
+		return nil
+	case "revoke":
+		rotated, err := vault.RevokeMember(store, creds, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if err = auditlog.NewLogger(store, rotated, creds.Actor()).Log(auditlog.Access, "", "", "revoked member "+fs.Arg(0)); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked %s and rotated the key of \"%s\"\n", fs.Arg(0), *username)
+		fmt.Printf("Create a new recovery key if you had one: sentryvault recovery new -vault %s\n", *username)
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown members command %q", args[0])
+	}
+}
+
+// promptNewPassword asks for a new password twice.
+func promptNewPassword(title string) (string, error) {
+	var password, confirm string
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				EchoMode(huh.EchoModePassword).
+				Title(title).
+				Value(&password),
+
+			huh.NewInput().
+				EchoMode(huh.EchoModePassword).
+				Title("Enter the password again").
+				Validate(func(s string) error {
+					if s != password {
+						return errors.New("the passwords do not match")
+					}
+					return nil
+				}).
+				Value(&confirm),
+		),
+	)
+	return password, form.Run()
+}
@@ -0,0 +1,323 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+	"github.com/AdityaKK0407/sentryvault/internal/vault"
+	"github.com/charmbracelet/huh"
+)
+
+func runRecovery(args []string) error {
+	fs := flag.NewFlagSet("recovery", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault recovery new -vault NAME [-o KIT]")
+		fmt.Fprintln(fs.Output(), "  sentryvault recovery split -vault NAME -n SHARES -k THRESHOLD [-o DIR]")
+		fmt.Fprintln(fs.Output(), "  sentryvault recovery remove -vault NAME [-shares]")
+		fmt.Fprintln(fs.Output(), "\nA recovery key unlocks the vault when the master password is forgotten,")
+		fmt.Fprintln(fs.Output(), "see: sentryvault recover. A new key replaces the previous one.")
+		fmt.Fprintln(fs.Output(), "\nsplit hands out N shares of a separate recovery secret, any K of which")
+		fmt.Fprintln(fs.Output(), "unlock the vault together. Splitting again replaces the earlier shares.")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "keyfile of the vault, if it has one")
+	output := fs.String("o", "", "also write the emergency kit to this file, or the shares to this directory")
+	n := fs.Int("n", 0, "number of shares to split into")
+	k := fs.Int("k", 0, "number of shares needed to recover")
+	shares := fs.Bool("shares", false, "remove the shares instead of the recovery key")
+	if len(args) == 0 {
+		fs.Usage()
+		return errors.New("expected new, split or remove")
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if args[0] != "new" && args[0] != "split" && args[0] != "remove" {
+		fs.Usage()
+		return fmt.Errorf("unknown recovery command %q", args[0])
+	}
+	store, cipherKey32, creds, err := openVault(*username, *keyfile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	audit := auditlog.NewLogger(store, cipherKey32, creds.Actor())
+
+	switch args[0] {
+	case "new":
+		if err = newRecoveryKey(store, *username, cipherKey32, creds, *output); err != nil {
+			return err
+		}
+		return audit.Log(auditlog.Access, "", "", "new recovery key")
+	case "split":
+		if err = splitRecovery(store, *username, cipherKey32, creds, *n, *k, *output); err != nil {
+			return err
+		}
+		return audit.Log(auditlog.Access, "", "", fmt.Sprintf("split recovery into %d shares, %d needed", *n, *k))
+	default:
+		if *shares {
+			if err = vault.RemoveShares(store, creds); err != nil {
+				return err
+			}
+			if err = audit.Log(auditlog.Access, "", "", "removed recovery shares"); err != nil {
+				return err
+			}
+			fmt.Printf("The shares of \"%s\" no longer unlock it\n", *username)
+			return nil
+		}
+		if err = vault.RemoveRecoveryKey(store, creds); err != nil {
+			return err
+		}
+		if err = audit.Log(auditlog.Access, "", "", "removed recovery key"); err != nil {
+			return err
+		}
+		fmt.Printf("\"%s\" can no longer be recovered with a recovery key\n", *username)
+		return nil
+	}
+}
+
+// newRecoveryKey creates a recovery key and prints the emergency kit, also
+// writing it to output when given.
+func newRecoveryKey(store database.VaultStore, username string, cipherKey32 []byte, creds vault.Credentials, output string) error {
+	recoveryKey, err := vault.NewRecoveryKey(store, cipherKey32, creds)
+	if err != nil {
+		return err
+	}
+	path, err := database.DBPath(username)
+	if err != nil {
+		return err
+	}
+	keyfile, err := vault.NeedsKeyfile(store)
+	if err != nil {
+		return err
+	}
+	kit := vault.Kit{
+		Vault:       username,
+		Path:        path,
+		Created:     time.Now(),
+		RecoveryKey: recoveryKey,
+		Keyfile:     keyfile,
+	}.String()
+
+	fmt.Print(kit)
+	if output != "" {
+		if err = os.WriteFile(output, []byte(kit), 0o600); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote the emergency kit to %s, print it and delete the file\n", output)
+	}
+	return nil
+}
+
+// splitRecovery splits a new recovery secret into shares and prints them,
+// also writing each to its own file in dir when given.
+func splitRecovery(store database.VaultStore, username string, cipherKey32 []byte, creds vault.Credentials, n, k int, dir string) error {
+	shares, err := vault.SplitRecovery(store, cipherKey32, creds, n, k)
+	if err != nil {
+		return err
+	}
+	for _, share := range shares {
+		block := share.Block(username, n)
+		fmt.Println(block)
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s-share-%d.txt", username, share.Index()))
+		if err = os.WriteFile(path, []byte(block), 0o600); err != nil {
+			return err
+		}
+	}
+	if dir != "" {
+		fmt.Printf("Wrote %d shares to %s, hand each to its holder and delete the files\n", n, dir)
+	}
+	return nil
+}
+
+// OfferRecoveryKey asks the owner of a new vault whether to create a
+// recovery key and prints the emergency kit if so.
+func OfferRecoveryKey(store database.VaultStore, username string, cipherKey32 []byte, creds vault.Credentials) error {
+	var create bool
+	var output string
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewConfirm().
+				Title("Create a recovery key?").
+				Description("Without one, a forgotten password means the vault is lost for good.").
+				Affirmative("Create").
+				Negative("Skip").
+				Value(&create),
+		),
+		huh.NewGroup(
+			huh.NewInput().
+				Title("Save the emergency kit to a file").
+				Placeholder("Press enter to only print it").
+				Value(&output),
+		).WithHideFunc(func() bool {
+			return !create
+		}),
+	)
+	if err := form.Run(); err != nil {
+		return err
+	}
+	if !create {
+		return nil
+	}
+	if err := newRecoveryKey(store, username, cipherKey32, creds, output); err != nil {
+		return err
+	}
+
+	// Give time to write the key down before the vault takes the screen
+	return huh.NewConfirm().
+		Title("Have you stored the emergency kit somewhere safe?").
+		Affirmative("Continue").
+		Negative("").
+		Run()
+}
+
+func runRecover(args []string) error {
+	fs := flag.NewFlagSet("recover", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: sentryvault recover -vault NAME [-shares]")
+		fmt.Fprintln(fs.Output(), "\nUnlocks a vault with the recovery key from its emergency kit, or with")
+		fmt.Fprintln(fs.Output(), "enough of its recovery shares, and sets a new master password. The")
+		fmt.Fprintln(fs.Output(), "keyfile is not needed and can be replaced. The vault gets a new key, so the")
+		fmt.Fprintln(fs.Output(), "old password, recovery key and shares stop working.")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	shares := fs.Bool("shares", false, "unlock with recovery shares instead of the recovery key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *username == "" {
+		return errors.New("missing -vault flag")
+	}
+	exists, err := vault.Exists(*username)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("vault %q not found", *username)
+	}
+
+	store, err := database.OpenStore(*username)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var cipherKey32 []byte
+	if *shares {
+		cipherKey32, err = promptShares(store)
+	} else {
+		cipherKey32, err = promptRecoveryKey(store)
+	}
+	if err != nil {
+		return err
+	}
+
+	var creds vault.Credentials
+	var confirm string
+	form := huh.NewForm(
+		huh.NewGroup(
+			huh.NewInput().
+				EchoMode(huh.EchoModePassword).
+				Title("Enter a new password").
+				Value(&creds.Password),
+
+			huh.NewInput().
+				EchoMode(huh.EchoModePassword).
+				Title("Enter the new password again").
+				Validate(func(s string) error {
+					if s != creds.Password {
+						return errors.New("the passwords do not match")
+					}
+					return nil
+				}).
+				Value(&confirm),
+
+			keyfileInput(&creds.Keyfile).
+				Description("Optional, leave empty for none. Create one with: sentryvault keyfile new PATH"),
+		),
+	)
+	if err = form.Run(); err != nil {
+		return err
+	}
+	if cipherKey32, err = vault.SetCredentials(store, cipherKey32, creds); err != nil {
+		return err
+	}
+	if err = auditlog.NewLogger(store, cipherKey32, creds.Actor()).Log(auditlog.Access, "", "", "new password after recovery"); err != nil {
+		return err
+	}
+
+	fmt.Printf("\"%s\" now opens with the new password under a new key\n", *username)
+	if *shares {
+		fmt.Printf("The old shares no longer work. Split again to hand out new ones:\n  sentryvault recovery split -vault %s\n", *username)
+	} else {
+		fmt.Printf("The old recovery key no longer works. Create a new one with:\n  sentryvault recovery new -vault %s\n", *username)
+	}
+	return nil
+}
+
+func promptRecoveryKey(store database.VaultStore) ([]byte, error) {
+	var recoveryKey string
+	err := huh.NewInput().
+		Title("Enter the recovery key").
+		Description("As printed on the emergency kit, case and dashes do not matter").
+		Value(&recoveryKey).
+		Run()
+	if err != nil {
+		return nil, err
+	}
+	return vault.Recover(store, recoveryKey)
+}
+
+// promptShares asks for shares one at a time until the threshold written
+// on them is reached. Each share is checked as it is entered.
+func promptShares(store database.VaultStore) ([]byte, error) {
+	var shares []vault.Share
+	threshold := 0
+	for threshold == 0 || len(shares) < threshold {
+		title := "Enter a recovery share"
+		if threshold > 0 {
+			title = fmt.Sprintf("Enter share %d of the %d needed", len(shares)+1, threshold)
+		}
+		var share vault.Share
+		err := huh.NewInput().
+			Title(title).
+			Description("As printed on the share, case and dashes do not matter").
+			Validate(func(code string) error {
+				var err error
+				if share, err = vault.ParseShare(code); err != nil {
+					return err
+				}
+				if _, err = vault.CheckShare(store, share); err != nil {
+					return err
+				}
+				for _, s := range shares {
+					if s.Index() == share.Index() {
+						return fmt.Errorf("share %d was already entered", share.Index())
+					}
+				}
+				return nil
+			}).
+			Run()
+		if err != nil {
+			return nil, err
+		}
+		if threshold, err = vault.CheckShare(store, share); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+	return vault.RecoverShares(store, shares)
+}
@@ -0,0 +1,79 @@
+package app
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+)
+
+func runRename(args []string) error {
+	fs := flag.NewFlagSet("rename", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault rename -vault NAME ENTRY NEW_ENTRY")
+		fmt.Fprintln(fs.Output(), "  sentryvault rename -vault NAME ENTRY FOLDER/NEW_ENTRY")
+		fmt.Fprintln(fs.Output(), "  sentryvault rename -vault NAME -key ENTRY KEY NEW_KEY")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "keyfile of the vault, if it has one")
+	renameKey := fs.Bool("key", false, "rename a key of ENTRY instead of the entry itself")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*renameKey && fs.NArg() != 3) || (!*renameKey && fs.NArg() != 2) {
+		fs.Usage()
+		return errors.New("wrong number of arguments")
+	}
+
+	store, cipherKey32, audit, err := unlockLogged(*username, *keyfile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	entry, err := resolveEntry(store, cipherKey32, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *renameKey {
+		if err = store.RenameKey([]byte(entry), []byte(fs.Arg(1)), []byte(fs.Arg(2))); err != nil {
+			return err
+		}
+		if err = audit.Log(auditlog.Rename, entry, fs.Arg(1), fmt.Sprintf("to \"%s\"", fs.Arg(2))); err != nil {
+			return err
+		}
+		fmt.Printf("Renamed key \"%s\" to \"%s\" in \"%s\"\n", fs.Arg(1), fs.Arg(2), fs.Arg(0))
+		return nil
+	}
+
+	// A new name containing a slash moves the entry into that folder as well
+	folder, newEntry := database.SplitEntryPath(fs.Arg(1))
+	if newEntry != entry {
+		err = store.RenameEntry([]byte(entry), []byte(newEntry))
+		if errors.Is(err, database.ErrExists) {
+			return database.NameTaken(store, cipherKey32, folder, newEntry)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if strings.Contains(fs.Arg(1), "/") {
+		err = database.UpdateEntryMetadata(store, cipherKey32, []byte(newEntry), func(metadata *database.EntryMetadata) {
+			metadata.Folder = folder
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err = audit.Log(auditlog.Rename, fs.Arg(0), "", "to "+fs.Arg(1)); err != nil {
+		return err
+	}
+	fmt.Printf("Renamed entry \"%s\" to \"%s\"\n", fs.Arg(0), fs.Arg(1))
+	return nil
+}
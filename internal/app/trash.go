@@ -0,0 +1,80 @@
+package app
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+)
+
+func runTrash(args []string) error {
+	fs := flag.NewFlagSet("trash", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:")
+		fmt.Fprintln(fs.Output(), "  sentryvault trash -vault NAME")
+		fmt.Fprintln(fs.Output(), "  sentryvault trash -vault NAME -restore ID")
+		fmt.Fprintln(fs.Output(), "  sentryvault trash -vault NAME -purge ID")
+		fmt.Fprintln(fs.Output(), "  sentryvault trash -vault NAME -retention DAYS")
+		fs.PrintDefaults()
+	}
+	username := fs.String("vault", "", "name of the vault")
+	keyfile := fs.String("keyfile", "", "keyfile of the vault, if it has one")
+	restore := fs.Uint64("restore", 0, "restore the item with this ID")
+	purge := fs.Uint64("purge", 0, "permanently delete the item with this ID")
+	retention := fs.Int("retention", -1, "days deleted items are kept, 0 keeps them forever")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, _, audit, err := unlockLogged(*username, *keyfile)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch {
+	case *retention >= 0:
+		if err = database.SetTrashRetention(store, time.Duration(*retention)*24*time.Hour); err != nil {
+			return err
+		}
+		fmt.Printf("Trash retention set to %d days\n", *retention)
+		return nil
+	case *restore != 0:
+		if err = store.RestoreTrash(*restore); err != nil {
+			return err
+		}
+		if err = audit.Log(auditlog.Restore, "", "", fmt.Sprintf("trash item %d", *restore)); err != nil {
+			return err
+		}
+		fmt.Printf("Restored item %d\n", *restore)
+		return nil
+	case *purge != 0:
+		if err = store.PurgeTrash(*purge); err != nil {
+			return err
+		}
+		if err = audit.Log(auditlog.Purge, "", "", fmt.Sprintf("trash item %d", *purge)); err != nil {
+			return err
+		}
+		fmt.Printf("Permanently deleted item %d\n", *purge)
+		return autoCompact(store, *username)
+	}
+
+	items, err := store.GetTrash()
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		fmt.Println("Trash is empty")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDELETED\tENTRY\tKEY")
+	for _, item := range items {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", item.ID, item.Deleted.Local().Format("2006-01-02 15:04"), item.Entry, item.Key)
+	}
+	return w.Flush()
+}
@@ -3,36 +3,42 @@ package app
 import (
 	"strings"
 
+	"github.com/AdityaKK0407/sentryvault/internal/vault"
 	"github.com/charmbracelet/huh"
 )
 
-func CreateUser() (string, string, error) {
-	var username, password string
+func CreateUser() (string, vault.Credentials, error) {
+	var username string
+	var creds vault.Credentials
 	form := huh.NewForm(
 		huh.NewGroup(
 			huh.NewInput().
 				Title("Enter your username").
+				Validate(vault.ValidateName).
 				Value(&username),
 
 			huh.NewInput().
 				EchoMode(huh.EchoModePassword).
 				Title("Enter your password").
 				Placeholder("Press enter to not give a password. (Recommended for security)").
-				Value(&password),
+				Value(&creds.Password),
+
+			keyfileInput(&creds.Keyfile).
+				Description("Optional. Create one with: sentryvault keyfile new PATH"),
 		),
 	)
 
-	return username, password, form.Run()
+	return username, creds, form.Run()
 }
 
-func SelectUser(files []string) (string, string, bool, error) {
+func SelectUser(files []string) (string, vault.Credentials, bool, error) {
 	for i := range len(files) {
 		files[i] = strings.TrimSuffix(files[i], ".db")
 	}
 	newUser := "New User"
 	files = append(files, newUser)
 
-	var username, password string
+	var username string
 	form := huh.NewForm(
 		huh.NewGroup(
 			huh.NewSelect[string]().
@@ -43,26 +49,49 @@ func SelectUser(files []string) (string, string, bool, error) {
 	)
 
 	if err := form.Run(); err != nil {
-		return "", "", false, err
+		return "", vault.Credentials{}, false, err
 	}
 
 	if username == newUser {
-		username, password, err := CreateUser()
-		return username, password, true, err
+		username, creds, err := CreateUser()
+		return username, creds, true, err
+	}
+
+	creds, err := PromptCredentials("")
+	if err != nil {
+		return "", vault.Credentials{}, false, err
 	}
 
-	form = huh.NewForm(
+	return username, creds, false, nil
+}
+
+// PromptCredentials asks for the password and keyfile of a vault, or the
+// member unlocking it. The keyfile field starts out with the given path.
+func PromptCredentials(keyfile string) (vault.Credentials, error) {
+	creds := vault.Credentials{Keyfile: keyfile}
+	form := huh.NewForm(
 		huh.NewGroup(
 			huh.NewInput().
 				EchoMode(huh.EchoModePassword).
 				Title("Enter your password").
-				Value(&password),
+				Value(&creds.Password),
+
+			keyfileInput(&creds.Keyfile).
+				Description("Leave empty if the vault has no keyfile"),
+
+			huh.NewInput().
+				Title("Member").
+				Description("For shared vaults, leave empty to unlock as the owner").
+				Value(&creds.Member),
 		),
 	)
 
-	if err := form.Run(); err != nil {
-		return "", "", false, err
-	}
+	return creds, form.Run()
+}
 
-	return username, password, false, nil
+func keyfileInput(path *string) *huh.Input {
+	return huh.NewInput().
+		Title("Keyfile").
+		Placeholder("path to the keyfile").
+		Value(path)
 }
@@ -0,0 +1,418 @@
+// Package auditlog keeps an append-only log of what is done in a vault.
+// Records are encrypted and chained: each one carries an HMAC over its
+// contents and the HMAC of the record before it, and the last HMAC is kept
+// as the head of the log. Editing, removing or reordering records breaks the
+// chain, which Verify reports.
+package auditlog
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+)
+
+const (
+	// keyHeader holds the random key of the log, encrypted under the vault
+	// key. Its first half seals the records and its second half chains them.
+	keyHeader = "auditKey"
+	// headHeader holds the head of the log, kept by database.AppendLog.
+	headHeader = "auditHead"
+	keySize    = 64
+	macSize    = sha256.Size
+	headSize   = 8 + 2*macSize
+)
+
+// Action is what was done in a vault.
+type Action string
+
+const (
+	Unlock  Action = "unlock"
+	Reveal  Action = "reveal"
+	Copy    Action = "copy"
+	Insert  Action = "insert"
+	Remove  Action = "remove"
+	Rename  Action = "rename"
+	Restore Action = "restore"
+	Purge   Action = "purge"
+	Attach  Action = "attach"
+	Export  Action = "export"
+	Check   Action = "check"
+	Access  Action = "access"
+)
+
+// Actions lists every action, in the order the viewer cycles through them.
+var Actions = []Action{Unlock, Reveal, Copy, Insert, Remove, Rename, Restore, Purge, Attach, Export, Check, Access}
+
+// restarted is the detail of the record a log starts again with when it
+// went missing from a vault that always has one. Verify reports it.
+const restarted = "the log was missing and was started again"
+
+// Record is an entry of the audit log. Entry and Key name what was acted
+// on, when anything, and Detail adds what is useful to know, never a secret.
+type Record struct {
+	Seq    uint64    `json:"-"`
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Action Action    `json:"action"`
+	Entry  string    `json:"entry,omitempty"`
+	Key    string    `json:"key,omitempty"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+// Logger appends records for whoever unlocked a vault. The zero Logger
+// logs nothing.
+type Logger struct {
+	store       database.VaultStore
+	cipherKey32 []byte
+	actor       string
+}
+
+func NewLogger(store database.VaultStore, cipherKey32 []byte, actor string) Logger {
+	return Logger{store: store, cipherKey32: cipherKey32, actor: actor}
+}
+
+// Log appends a record of an action.
+func (l Logger) Log(action Action, entry, key, detail string) error {
+	if l.store == nil {
+		return nil
+	}
+	return Append(l.store, l.cipherKey32, Record{
+		Actor:  l.actor,
+		Action: action,
+		Entry:  entry,
+		Key:    key,
+		Detail: detail,
+	})
+}
+
+type keys struct {
+	seal, mac []byte
+}
+
+// loadKeys decrypts the key of the log, creating it when create is set and
+// the vault has none yet. It returns nil for a vault without a log.
+func loadKeys(store database.VaultStore, cipherKey32 []byte, create bool) (*keys, error) {
+	encrypted, err := store.GetHeader(keyHeader)
+	if err != nil {
+		return nil, err
+	}
+	var key []byte
+	switch {
+	case encrypted != nil:
+		if key, err = cipher.DecryptAESGCM(cipherKey32, encrypted); err != nil {
+			return nil, fmt.Errorf("audit log key: %w", err)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("audit log key has %d bytes", len(key))
+		}
+	case create:
+		key = make([]byte, keySize)
+		if _, err = rand.Read(key); err != nil {
+			return nil, err
+		}
+		if encrypted, err = cipher.EncryptAESGCM(cipherKey32, key); err != nil {
+			return nil, err
+		}
+		if err = store.PutHeaders(map[string][]byte{keyHeader: encrypted}); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+	return &keys{seal: key[:keySize/2], mac: key[keySize/2:]}, nil
+}
+
+// Start gives a vault without a log its key and a first record, naming
+// actor. A vault that has a log keeps it.
+func Start(store database.VaultStore, cipherKey32 []byte, actor string) error {
+	encrypted, err := store.GetHeader(keyHeader)
+	if err != nil || encrypted != nil {
+		return err
+	}
+	return Append(store, cipherKey32, Record{Actor: actor, Action: Access, Detail: "log started"})
+}
+
+// link returns the HMAC chaining a sealed record to the one before it.
+func (k keys) link(seq uint64, prev, sealed []byte) []byte {
+	h := hmac.New(sha256.New, k.mac)
+	h.Write(binary.BigEndian.AppendUint64(nil, seq))
+	h.Write(prev)
+	h.Write(sealed)
+	return h.Sum(nil)
+}
+
+// head returns the head of the log after the record with the given
+// sequence number and link.
+func (k keys) head(seq uint64, link []byte) []byte {
+	head := binary.BigEndian.AppendUint64(nil, seq)
+	head = append(head, link...)
+	h := hmac.New(sha256.New, k.mac)
+	h.Write([]byte("head"))
+	h.Write(head)
+	return h.Sum(head)
+}
+
+// Append adds a record to the log of an unlocked vault, setting its time
+// when not given. A vault from database.LogVersion on whose key or head of
+// the log is missing, which only tampering does, gets a new log starting
+// with a record saying so rather than a clean one.
+func Append(store database.VaultStore, cipherKey32 []byte, r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+	return store.Update(func(tx database.VaultStore) error {
+		k, err := loadKeys(tx, cipherKey32, false)
+		if err != nil {
+			return err
+		}
+		head, err := tx.GetHeader(headHeader)
+		if err != nil {
+			return err
+		}
+		missing := k == nil || head == nil
+		if k == nil {
+			if k, err = loadKeys(tx, cipherKey32, true); err != nil {
+				return err
+			}
+		}
+		version, err := database.GetSchemaVersion(tx)
+		if err != nil {
+			return err
+		}
+		if missing && version >= database.LogVersion {
+			if err = k.append(tx, Record{Time: r.Time, Actor: r.Actor, Action: Access, Detail: restarted}); err != nil {
+				return err
+			}
+		}
+		return k.append(tx, r)
+	})
+}
+
+// append seals a record and adds it to the log.
+func (k keys) append(store database.VaultStore, r Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	sealed, err := cipher.EncryptAESGCM(k.seal, data)
+	if err != nil {
+		return err
+	}
+	return store.AppendLog(func(seq uint64, last []byte) ([]byte, []byte, error) {
+		var prev []byte
+		if len(last) >= macSize {
+			prev = last[:macSize]
+		}
+		link := k.link(seq, prev, sealed)
+		return append(link, sealed...), k.head(seq, link), nil
+	})
+}
+
+// Read returns the records of the log, oldest first. Records that cannot be
+// decrypted are left out, Verify reports them.
+func Read(store database.VaultStore, cipherKey32 []byte) ([]Record, error) {
+	k, err := loadKeys(store, cipherKey32, false)
+	if err != nil || k == nil {
+		return nil, err
+	}
+	stored, _, err := store.GetLog()
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	for _, s := range stored {
+		r, err := k.open(s)
+		if err != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
+
+func (k keys) open(s database.LogRecord) (Record, error) {
+	var r Record
+	if len(s.Data) < macSize {
+		return r, fmt.Errorf("record %d is truncated", s.Seq)
+	}
+	data, err := cipher.DecryptAESGCM(k.seal, s.Data[macSize:])
+	if err != nil {
+		return r, err
+	}
+	if err = json.Unmarshal(data, &r); err != nil {
+		return r, err
+	}
+	r.Seq = s.Seq
+	return r, nil
+}
+
+// Problem is a break in the chain of the log found by Verify.
+type Problem struct {
+	// Seq is the record where the chain breaks, 0 for the log as a whole.
+	Seq    uint64
+	Reason string
+}
+
+func (p Problem) String() string {
+	if p.Seq == 0 {
+		return p.Reason
+	}
+	return fmt.Sprintf("record %d: %s", p.Seq, p.Reason)
+}
+
+// Result is the outcome of Verify.
+type Result struct {
+	Records  int
+	Problems []Problem
+}
+
+// OK reports whether the chain is intact.
+func (r Result) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify checks the chain of the log of an unlocked vault: that no record
+// was changed, that none are missing from the start, middle or end, and
+// that each can be decrypted. From database.LogVersion on every vault has a
+// log, so a missing one is reported too, as is a log started again by
+// Append after it went missing.
+func Verify(store database.VaultStore, cipherKey32 []byte) (Result, error) {
+	var result Result
+	stored, head, err := store.GetLog()
+	if err != nil {
+		return result, err
+	}
+	result.Records = len(stored)
+	version, err := database.GetSchemaVersion(store)
+	if err != nil {
+		return result, err
+	}
+	required := version >= database.LogVersion
+	k, err := loadKeys(store, cipherKey32, false)
+	if err != nil {
+		return result, err
+	}
+	if k == nil {
+		if len(stored) > 0 || head != nil || required {
+			result.Problems = append(result.Problems, Problem{Reason: "the key of the log is missing"})
+		}
+		return result, nil
+	}
+	problem := func(seq uint64, format string, args ...any) {
+		result.Problems = append(result.Problems, Problem{Seq: seq, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	var prev []byte
+	var last uint64
+	for _, s := range stored {
+		if s.Seq != last+1 {
+			if s.Seq-1 == last+1 {
+				problem(s.Seq, "record %d was removed", last+1)
+			} else {
+				problem(s.Seq, "records %d to %d were removed", last+1, s.Seq-1)
+			}
+		}
+		last = s.Seq
+		if len(s.Data) < macSize {
+			problem(s.Seq, "the record is truncated")
+			prev = nil
+			continue
+		}
+		link, sealed := s.Data[:macSize], s.Data[macSize:]
+		if !hmac.Equal(link, k.link(s.Seq, prev, sealed)) {
+			problem(s.Seq, "the record was changed or does not follow the one before it")
+		} else if r, err := k.open(s); err != nil {
+			problem(s.Seq, "the record cannot be decrypted")
+		} else if r.Action == Access && r.Detail == restarted {
+			problem(s.Seq, "the log was missing and was started again here, the records before it are lost")
+		}
+		prev = link
+	}
+
+	switch {
+	case head == nil && (len(stored) > 0 || required):
+		problem(0, "the head of the log is missing")
+	case head == nil:
+	case len(head) != headSize || !hmac.Equal(head, k.head(binary.BigEndian.Uint64(head), head[8:8+macSize])):
+		problem(0, "the head of the log was changed")
+	default:
+		seq := binary.BigEndian.Uint64(head)
+		switch {
+		case seq > last:
+			problem(0, "records %d to %d at the end were removed", last+1, seq)
+		case seq < last || !bytes.Equal(head[8:8+macSize], prev):
+			problem(0, "the last record does not match the head of the log")
+		}
+	}
+	return result, nil
+}
+
+// Rotate gives the log of a vault whose key changes from oldKey to newKey a
+// new key of its own, so that whoever knew the old one can neither read
+// later records nor forge records that Verify accepts. It returns the
+// header holding the new key, encrypted under newKey, and the function
+// sealing the log again under it, both for database.Rekey. A vault without a
+// log gets neither.
+func Rotate(store database.VaultStore, oldKey, newKey []byte) (map[string][]byte, func([]database.LogRecord, []byte) ([]database.LogRecord, []byte, error), error) {
+	old, err := loadKeys(store, oldKey, false)
+	if err != nil || old == nil {
+		return nil, nil, err
+	}
+	key := make([]byte, keySize)
+	if _, err = rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	encrypted, err := cipher.EncryptAESGCM(newKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	next := &keys{seal: key[:keySize/2], mac: key[keySize/2:]}
+	reseal := func(stored []database.LogRecord, head []byte) ([]database.LogRecord, []byte, error) {
+		return old.reseal(next, stored, head)
+	}
+	return map[string][]byte{keyHeader: encrypted}, reseal, nil
+}
+
+// reseal seals the records of a log and its head again under next. Records
+// and heads that do not verify under k are kept as they are, so that Verify
+// still reports them.
+func (k keys) reseal(next *keys, stored []database.LogRecord, head []byte) ([]database.LogRecord, []byte, error) {
+	var prev, nextPrev []byte
+	resealed := make([]database.LogRecord, 0, len(stored))
+	for _, s := range stored {
+		data := s.Data
+		if len(data) < macSize {
+			prev, nextPrev = nil, nil
+			resealed = append(resealed, s)
+			continue
+		}
+		link, sealed := data[:macSize], data[macSize:]
+		if hmac.Equal(link, k.link(s.Seq, prev, sealed)) {
+			if plain, err := cipher.DecryptAESGCM(k.seal, sealed); err == nil {
+				if sealed, err = cipher.EncryptAESGCM(next.seal, plain); err != nil {
+					return nil, nil, err
+				}
+				data = append(next.link(s.Seq, nextPrev, sealed), sealed...)
+			}
+		}
+		prev, nextPrev = link, data[:macSize]
+		resealed = append(resealed, database.LogRecord{Seq: s.Seq, Data: data})
+	}
+
+	if len(head) == headSize && hmac.Equal(head, k.head(binary.BigEndian.Uint64(head), head[8:8+macSize])) {
+		link := head[8 : 8+macSize]
+		if bytes.Equal(link, prev) {
+			link = nextPrev
+		}
+		head = next.head(binary.BigEndian.Uint64(head), link)
+	}
+	return resealed, head, nil
+}
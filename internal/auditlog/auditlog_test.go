@@ -0,0 +1,262 @@
+package auditlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+	bolt "go.etcd.io/bbolt"
+)
+
+// testStore is the store of a test log, with its database for tamper.
+type testStore struct {
+	*database.BoltStore
+	db *bolt.DB
+}
+
+func openTestLog(t *testing.T, records int) (testStore, []byte) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	// GetDBFiles creates the directory of the vaults
+	if _, err := database.GetDBFiles(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.Open("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	store := testStore{BoltStore: database.NewBoltStore(db), db: db}
+	cipherKey32 := bytes.Repeat([]byte{7}, 32)
+	logger := NewLogger(store, cipherKey32, "alice")
+	for i := range records {
+		if err = logger.Log(Reveal, "github", "password", strings.Repeat("x", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store, cipherKey32
+}
+
+// tamper changes the stored audit log directly.
+func tamper(t *testing.T, store testStore, change func(log, header *bolt.Bucket) error) {
+	t.Helper()
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		return change(tx.Bucket([]byte("AuditLog")), tx.Bucket([]byte("Header")))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func seqKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
+
+func TestAppendRead(t *testing.T) {
+	store, cipherKey32 := openTestLog(t, 3)
+	records, err := Read(store, cipherKey32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Read returned %d records, want 3", len(records))
+	}
+	for i, r := range records {
+		if r.Seq != uint64(i+1) || r.Actor != "alice" || r.Action != Reveal || r.Entry != "github" || r.Detail != strings.Repeat("x", i) {
+			t.Errorf("record %d = %+v", i, r)
+		}
+		if r.Time.IsZero() {
+			t.Errorf("record %d has no time", i)
+		}
+	}
+	result, err := Verify(store, cipherKey32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.OK() || result.Records != 3 {
+		t.Fatalf("Verify of an untouched log = %+v", result)
+	}
+
+	if _, err = Verify(store, bytes.Repeat([]byte{8}, 32)); err == nil {
+		t.Fatal("Verify with the wrong key succeeded")
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(log, header *bolt.Bucket) error
+		want   string
+	}{
+		{"edited", func(log, _ *bolt.Bucket) error {
+			data := bytes.Clone(log.Get(seqKey(2)))
+			data[len(data)-1] ^= 1
+			return log.Put(seqKey(2), data)
+		}, "record 2: the record was changed"},
+		{"removed", func(log, _ *bolt.Bucket) error {
+			return log.Delete(seqKey(2))
+		}, "record 3: record 2 was removed"},
+		{"swapped", func(log, _ *bolt.Bucket) error {
+			one, two := bytes.Clone(log.Get(seqKey(1))), bytes.Clone(log.Get(seqKey(2)))
+			if err := log.Put(seqKey(1), two); err != nil {
+				return err
+			}
+			return log.Put(seqKey(2), one)
+		}, "record 1: the record was changed"},
+		{"truncated", func(log, _ *bolt.Bucket) error {
+			return log.Delete(seqKey(4))
+		}, "records 4 to 4 at the end were removed"},
+		{"head removed", func(_, header *bolt.Bucket) error {
+			return header.Delete([]byte("auditHead"))
+		}, "the head of the log is missing"},
+		{"emptied", func(log, header *bolt.Bucket) error {
+			for seq := range uint64(4) {
+				if err := log.Delete(seqKey(seq + 1)); err != nil {
+					return err
+				}
+			}
+			return header.Delete([]byte("auditHead"))
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, cipherKey32 := openTestLog(t, 4)
+			tamper(t, store, tt.change)
+			result, err := Verify(store, cipherKey32)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var problems []string
+			for _, p := range result.Problems {
+				problems = append(problems, p.String())
+			}
+			got := strings.Join(problems, "; ")
+			if tt.want == "" {
+				// A log removed as a whole cannot be told from an empty one,
+				// but the next record shows the gap
+				if err = NewLogger(store, cipherKey32, "alice").Log(Unlock, "", "", ""); err != nil {
+					t.Fatal(err)
+				}
+				if result, err = Verify(store, cipherKey32); err != nil {
+					t.Fatal(err)
+				}
+				if result.OK() {
+					t.Fatal("Verify after the log was emptied found no problem")
+				}
+				return
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Fatalf("Verify problems = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotate(t *testing.T) {
+	store, oldKey := openTestLog(t, 3)
+	tamper(t, store, func(log, _ *bolt.Bucket) error {
+		data := bytes.Clone(log.Get(seqKey(2)))
+		data[len(data)-1] ^= 1
+		return log.Put(seqKey(2), data)
+	})
+	old, err := loadKeys(store, oldKey, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey := bytes.Repeat([]byte{9}, 32)
+	headers, reseal, err := Rotate(store, oldKey, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Rekey(oldKey, newKey, headers, nil, reseal); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := loadKeys(store, newKey, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(next.mac, old.mac) || bytes.Equal(next.seal, old.seal) {
+		t.Fatal("the key of the log was not replaced")
+	}
+	records, err := Read(store, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Seq != 1 || records[1].Seq != 3 {
+		t.Fatalf("Read after Rotate = %+v", records)
+	}
+	// The damage from before is still reported, and nothing else
+	result, err := Verify(store, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Problems) != 1 || result.Problems[0].Seq != 2 {
+		t.Fatalf("Verify after Rotate = %+v", result.Problems)
+	}
+
+	// Records forged with the old key do not pass
+	if err = store.AppendLog(func(seq uint64, last []byte) ([]byte, []byte, error) {
+		link := old.link(seq, last[:macSize], []byte("forged"))
+		return append(link, "forged"...), old.head(seq, link), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = Verify(store, newKey); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Problems) != 3 {
+		t.Fatalf("Verify of a record forged with the old key = %+v", result.Problems)
+	}
+}
+
+func TestVerifyMissingLog(t *testing.T) {
+	store, cipherKey32 := openTestLog(t, 3)
+	// A vault from LogVersion on always has a log, which Init starts
+	if err := database.SetSchemaVersion(store, database.LogVersion); err != nil {
+		t.Fatal(err)
+	}
+	tamper(t, store, func(log, header *bolt.Bucket) error {
+		for seq := range uint64(3) {
+			if err := log.Delete(seqKey(seq + 1)); err != nil {
+				return err
+			}
+		}
+		if err := header.Delete([]byte("auditHead")); err != nil {
+			return err
+		}
+		return header.Delete([]byte("auditKey"))
+	})
+	result, err := Verify(store, cipherKey32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.OK() {
+		t.Fatal("Verify of a vault whose log was wiped found no problem")
+	}
+
+	// Nor does the next record start a clean log
+	if err = NewLogger(store, cipherKey32, "alice").Log(Unlock, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = Verify(store, cipherKey32); err != nil {
+		t.Fatal(err)
+	}
+	if result.OK() {
+		t.Fatal("Verify of a log started again after it was wiped found no problem")
+	}
+	records, err := Read(store, cipherKey32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Detail != restarted || records[1].Action != Unlock {
+		t.Fatalf("records after the log was started again = %+v", records)
+	}
+}
@@ -0,0 +1,170 @@
+// Package breach looks up passwords in a local copy of the Have I Been Pwned
+// password list, without any network access.
+package breach
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// List counts how often a password appears in known breaches.
+type List interface {
+	// Count returns the number of times the password with the given SHA-1
+	// hash was seen, 0 when it was not.
+	Count(hash [sha1.Size]byte) (int, error)
+	Close() error
+}
+
+// Open opens a hash list at path, which is either
+//   - a file of "HASH:COUNT" lines sorted by hash, as downloaded ordered by
+//     hash, which is searched with a binary search, or
+//   - a directory of range files named after the first five characters of
+//     the hashes, such as 21BD1.txt, holding "SUFFIX:COUNT" lines.
+func Open(path string) (List, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return rangeDir(path), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &sortedFile{f: f, size: info.Size()}, nil
+}
+
+// Count looks up a single password in the list at path.
+func Count(path, password string) (int, error) {
+	list, err := Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer list.Close()
+	return list.Count(sha1.Sum([]byte(password)))
+}
+
+// parseLine splits a "HASH:COUNT" line.
+func parseLine(line string) (string, int, error) {
+	hash, count, ok := strings.Cut(strings.TrimSpace(line), ":")
+	if !ok {
+		return "", 0, fmt.Errorf("malformed line %q, expected HASH:COUNT", line)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed count in line %q", line)
+	}
+	return strings.ToUpper(hash), n, nil
+}
+
+func encode(hash [sha1.Size]byte) string {
+	return strings.ToUpper(hex.EncodeToString(hash[:]))
+}
+
+type sortedFile struct {
+	f    *os.File
+	size int64
+}
+
+func (s *sortedFile) Close() error {
+	return s.f.Close()
+}
+
+// Count runs a binary search over byte offsets. Lines differ in length, so
+// each probe moves on to the start of the next line.
+func (s *sortedFile) Count(hash [sha1.Size]byte) (int, error) {
+	target := encode(hash)
+	lo, hi := int64(0), s.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := s.lineFrom(mid)
+		if err != nil {
+			return 0, err
+		}
+		if start >= hi || line == "" {
+			hi = mid
+			continue
+		}
+		h, count, err := parseLine(line)
+		if err != nil {
+			return 0, err
+		}
+		switch c := strings.Compare(h, target); {
+		case c == 0:
+			return count, nil
+		case c < 0:
+			lo = start + int64(len(line))
+		default:
+			hi = mid
+		}
+	}
+	return 0, nil
+}
+
+// lineFrom returns the first line starting at or after offset, with its
+// offset. The line keeps its newline; it is empty at the end of the file.
+func (s *sortedFile) lineFrom(offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		start--
+	}
+	r := bufio.NewReader(io.NewSectionReader(s.f, start, s.size-start))
+	if offset > 0 {
+		skipped, err := r.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			return s.size, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		start += int64(len(skipped))
+	}
+	line, err := r.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, "", err
+	}
+	return start, line, nil
+}
+
+type rangeDir string
+
+func (d rangeDir) Close() error {
+	return nil
+}
+
+func (d rangeDir) Count(hash [sha1.Size]byte) (int, error) {
+	h := encode(hash)
+	prefix, suffix := h[:5], h[5:]
+	f, err := os.Open(filepath.Join(string(d), prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("range file %s.txt is missing from %s", prefix, d)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		s, count, err := parseLine(scanner.Text())
+		if err != nil {
+			return 0, err
+		}
+		if s == suffix {
+			return count, nil
+		}
+	}
+	return 0, scanner.Err()
+}
@@ -0,0 +1,82 @@
+package breach
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var breached = map[string]int{
+	"password": 9545824,
+	"hunter2":  17043,
+	"letmein":  1000,
+	"qwerty":   3912816,
+}
+
+func writeSortedList(t *testing.T, lineEnd string) string {
+	t.Helper()
+	var lines []string
+	for password, count := range breached {
+		lines = append(lines, fmt.Sprintf("%s:%d", encode(sha1.Sum([]byte(password))), count))
+	}
+	// Unrelated hashes around the breached ones
+	for i := range 200 {
+		lines = append(lines, fmt.Sprintf("%s:%d", encode(sha1.Sum([]byte(fmt.Sprint("filler", i)))), i+1))
+	}
+	slices.Sort(lines)
+	path := filepath.Join(t.TempDir(), "pwned.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, lineEnd)+lineEnd), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSortedFile(t *testing.T) {
+	for _, lineEnd := range []string{"\n", "\r\n"} {
+		path := writeSortedList(t, lineEnd)
+		list, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for password, want := range breached {
+			if got, err := list.Count(sha1.Sum([]byte(password))); err != nil || got != want {
+				t.Errorf("Count(%q) = %d, %v, want %d", password, got, err, want)
+			}
+		}
+		for i := range 200 {
+			if got, err := list.Count(sha1.Sum([]byte(fmt.Sprint("filler", i)))); err != nil || got != i+1 {
+				t.Errorf("Count(filler%d) = %d, %v, want %d", i, got, err, i+1)
+			}
+		}
+		if got, err := list.Count(sha1.Sum([]byte("xK9#mQ2$vL7!pR4&"))); err != nil || got != 0 {
+			t.Errorf("Count of an unknown password = %d, %v, want 0", got, err)
+		}
+		list.Close()
+	}
+}
+
+func TestRangeDir(t *testing.T) {
+	dir := t.TempDir()
+	for password, count := range breached {
+		h := encode(sha1.Sum([]byte(password)))
+		f, err := os.OpenFile(filepath.Join(dir, h[:5]+".txt"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(f, "0000000000000000000000000000000000A:1\r\n%s:%d\r\n", h[5:], count)
+		f.Close()
+	}
+
+	for password, want := range breached {
+		if got, err := Count(dir, password); err != nil || got != want {
+			t.Errorf("Count(%q) = %d, %v, want %d", password, got, err, want)
+		}
+	}
+	if _, err := Count(dir, "xK9#mQ2$vL7!pR4&"); err == nil {
+		t.Error("Count with a missing range file succeeded")
+	}
+}
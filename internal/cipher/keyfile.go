@@ -0,0 +1,30 @@
+package cipher
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+// KeyfileHash hashes the contents of a keyfile. Any file can serve as a
+// keyfile, as long as it never changes.
+func KeyfileHash(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errors.New("keyfile is empty")
+	}
+	return h.Sum(nil), nil
+}
+
+// MixKeyfile combines a password with the hash of a keyfile into the input
+// of the key derivation. The hash has a fixed length, so no two pairs of
+// password and keyfile give the same input.
+func MixKeyfile(password, keyfileHash []byte) []byte {
+	input := make([]byte, 0, len(password)+len(keyfileHash))
+	input = append(input, password...)
+	return append(input, keyfileHash...)
+}
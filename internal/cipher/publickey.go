@@ -0,0 +1,66 @@
+package cipher
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+)
+
+const publicKeyInfo = "sentryvault public key wrap"
+
+// GenerateX25519 returns a new X25519 private key.
+func GenerateX25519() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// SealTo encrypts data so that only the holder of the private key matching
+// publicKey can read it. A new ephemeral key is used for every call and
+// returned together with the ciphertext.
+func SealTo(publicKey, data []byte) ([]byte, []byte, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	ephemeral, err := GenerateX25519()
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := wrapKey(ephemeral, recipient, ephemeral.PublicKey(), recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+	sealed, err := EncryptAESGCM(key, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ephemeral.PublicKey().Bytes(), sealed, nil
+}
+
+// OpenFrom decrypts what SealTo encrypted for the public key of privateKey.
+func OpenFrom(privateKey, ephemeralKey, sealed []byte) ([]byte, error) {
+	private, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := wrapKey(private, ephemeral, ephemeral, private.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	return DecryptAESGCM(key, sealed)
+}
+
+// wrapKey derives the AES key shared by the two ends. Both public keys go
+// into the salt so that the key is bound to this exact pair.
+func wrapKey(private *ecdh.PrivateKey, peer, ephemeral, recipient *ecdh.PublicKey) ([]byte, error) {
+	shared, err := private.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	salt := append(ephemeral.Bytes(), recipient.Bytes()...)
+	return hkdf.Key(sha256.New, shared, salt, publicKeyInfo, 32)
+}
@@ -0,0 +1,33 @@
+package cipher
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealTo(t *testing.T) {
+	private, err := GenerateX25519()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("vault data key")
+	ephemeral, sealed, err := SealTo(private.PublicKey().Bytes(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := OpenFrom(private.Bytes(), ephemeral, sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("OpenFrom = %q, want %q", got, data)
+	}
+
+	other, err := GenerateX25519()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = OpenFrom(other.Bytes(), ephemeral, sealed); err == nil {
+		t.Fatal("another private key opened the data")
+	}
+}
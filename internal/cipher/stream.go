@@ -0,0 +1,226 @@
+package cipher
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Streams are encrypted in chunks of StreamChunkSize bytes, following the
+// STREAM construction: every stream has its own salt and key, and the nonce
+// of each chunk is a random prefix, the chunk counter and a flag marking the
+// final chunk. Chunks therefore cannot be reordered, and dropping chunks from
+// the end fails authentication because the final flag is missing.
+//
+// Layout: salt (16) | nonce prefix (7) | chunk | chunk | ... | final chunk
+const StreamChunkSize = 64 * 1024
+
+const (
+	streamSaltSize   = 16
+	streamPrefixSize = 7
+	streamHeaderSize = streamSaltSize + streamPrefixSize
+)
+
+var ErrStreamAuth = errors.New("stream authentication failed: data is corrupted or truncated")
+
+func streamAEAD(cipherKey32, salt []byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, cipherKey32, salt, "sentryvault stream", 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func streamNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 0, 12)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+type streamWriter struct {
+	aead    cipher.AEAD
+	w       io.Writer
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	out     []byte
+	closed  bool
+}
+
+// NewStreamWriter returns a writer that encrypts everything written to it
+// into w. Close must be called to write the final chunk.
+func NewStreamWriter(cipherKey32 []byte, w io.Writer) (io.WriteCloser, error) {
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(rand.Reader, header); err != nil {
+		return nil, err
+	}
+	aead, err := streamAEAD(cipherKey32, header[:streamSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(header); err != nil {
+		return nil, err
+	}
+	return &streamWriter{
+		aead:   aead,
+		w:      w,
+		prefix: header[streamSaltSize:],
+		buf:    make([]byte, 0, StreamChunkSize),
+	}, nil
+}
+
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errors.New("write to closed stream")
+	}
+	n := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows, so that the
+		// final chunk is always the one sealed by Close.
+		if len(s.buf) == StreamChunkSize {
+			if err := s.seal(false); err != nil {
+				return n, err
+			}
+		}
+		c := min(len(p), StreamChunkSize-len(s.buf))
+		s.buf = append(s.buf, p[:c]...)
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (s *streamWriter) seal(last bool) error {
+	s.out = s.aead.Seal(s.out[:0], streamNonce(s.prefix, s.counter, last), s.buf, nil)
+	if _, err := s.w.Write(s.out); err != nil {
+		return err
+	}
+	s.buf = s.buf[:0]
+	s.counter++
+	if s.counter == 0 && !last {
+		return errors.New("stream too long")
+	}
+	return nil
+}
+
+func (s *streamWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.seal(true)
+}
+
+type streamReader struct {
+	aead    cipher.AEAD
+	r       *bufio.Reader
+	prefix  []byte
+	counter uint32
+	chunk   []byte
+	plain   []byte
+	done    bool
+}
+
+// NewStreamReader returns a reader that decrypts a stream written by a
+// stream writer. Read returns ErrStreamAuth if the stream was modified or
+// does not end with its final chunk.
+func NewStreamReader(cipherKey32 []byte, r io.Reader) (io.Reader, error) {
+	header := make([]byte, streamHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrStreamAuth
+		}
+		return nil, err
+	}
+	aead, err := streamAEAD(cipherKey32, header[:streamSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{
+		aead:   aead,
+		r:      bufio.NewReader(r),
+		prefix: header[streamSaltSize:],
+		chunk:  make([]byte, StreamChunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.plain) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.plain)
+	s.plain = s.plain[n:]
+	return n, nil
+}
+
+func (s *streamReader) next() error {
+	n, err := io.ReadFull(s.r, s.chunk)
+	last := false
+	switch {
+	case err == nil:
+		_, err = s.r.Peek(1)
+		if errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		last = true
+	case errors.Is(err, io.EOF):
+		return ErrStreamAuth
+	default:
+		return err
+	}
+
+	plain, err := s.aead.Open(s.chunk[:0], streamNonce(s.prefix, s.counter, last), s.chunk[:n], nil)
+	if err != nil {
+		return ErrStreamAuth
+	}
+	s.plain = plain
+	s.counter++
+	s.done = last
+	return nil
+}
+
+// EncryptStream encrypts src into dst and returns the number of plaintext
+// bytes read.
+func EncryptStream(cipherKey32 []byte, dst io.Writer, src io.Reader) (int64, error) {
+	w, err := NewStreamWriter(cipherKey32, dst)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(w, src)
+	if err != nil {
+		return n, err
+	}
+	return n, w.Close()
+}
+
+// DecryptStream decrypts src into dst and returns the number of plaintext
+// bytes written. Data written before an error must not be trusted.
+func DecryptStream(cipherKey32 []byte, dst io.Writer, src io.Reader) (int64, error) {
+	r, err := NewStreamReader(cipherKey32, src)
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(dst, r)
+}
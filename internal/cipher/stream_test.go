@@ -0,0 +1,78 @@
+package cipher
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func encryptTestStream(t *testing.T, key, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	n, err := EncryptStream(key, &buf, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("EncryptStream read %d bytes, want %d", n, len(data))
+	}
+	return buf.Bytes()
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	for _, size := range []int{0, 1, StreamChunkSize - 1, StreamChunkSize, StreamChunkSize + 1, 3*StreamChunkSize + 17} {
+		data := make([]byte, size)
+		rand.Read(data)
+		stream := encryptTestStream(t, key, data)
+
+		var out bytes.Buffer
+		if _, err := DecryptStream(key, &out, bytes.NewReader(stream)); err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(out.Bytes(), data) {
+			t.Fatalf("size %d: decrypted data differs", size)
+		}
+	}
+}
+
+func TestStreamTampering(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+	data := make([]byte, 2*StreamChunkSize+100)
+	rand.Read(data)
+	stream := encryptTestStream(t, key, data)
+	chunk := StreamChunkSize + 16
+
+	flipped := bytes.Clone(stream)
+	flipped[streamHeaderSize+chunk+5] ^= 1
+
+	reordered := bytes.Clone(stream)
+	copy(reordered[streamHeaderSize:], stream[streamHeaderSize+chunk:streamHeaderSize+2*chunk])
+	copy(reordered[streamHeaderSize+chunk:], stream[streamHeaderSize:streamHeaderSize+chunk])
+
+	wrongKey := make([]byte, 32)
+
+	tests := map[string]struct {
+		key    []byte
+		stream []byte
+	}{
+		"truncated at chunk boundary": {key, stream[:streamHeaderSize+2*chunk]},
+		"truncated mid chunk":         {key, stream[:len(stream)-10]},
+		"header only":                 {key, stream[:streamHeaderSize]},
+		"flipped bit":                 {key, flipped},
+		"reordered chunks":            {key, reordered},
+		"appended data":               {key, append(bytes.Clone(stream), 0)},
+		"wrong key":                   {wrongKey, stream},
+	}
+	for name, tt := range tests {
+		var out bytes.Buffer
+		_, err := DecryptStream(tt.key, &out, bytes.NewReader(tt.stream))
+		if !errors.Is(err, ErrStreamAuth) {
+			t.Errorf("%s: got %v, want ErrStreamAuth", name, err)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/generator"
+	"github.com/AdityaKK0407/sentryvault/internal/health"
+	"github.com/BurntSushi/toml"
+)
+
+// Actions are the names of the key bindings that can be remapped in the
+// [keys] table, in the order they are shown in help.
+var Actions = []string{
+	"up", "down", "enter", "tab", "add", "update", "remove", "rename",
+	"escape", "confirm", "cancel", "sort", "history", "undo", "trash",
+	"tags", "filter", "reveal", "copy", "generate", "submit", "expand",
+	"editor", "files", "vaults", "health", "auditlog", "quit",
+}
+
+var defaultKeys = map[string][]string{
+	"up":       {"up"},
+	"down":     {"down"},
+	"enter":    {"enter"},
+	"tab":      {"tab"},
+	"add":      {"a"},
+	"update":   {"u"},
+	"remove":   {"r"},
+	"rename":   {"m"},
+	"escape":   {"esc"},
+	"confirm":  {"y"},
+	"cancel":   {"n"},
+	"sort":     {"s"},
+	"history":  {"h"},
+	"undo":     {"z"},
+	"trash":    {"t"},
+	"tags":     {"g"},
+	"filter":   {"/"},
+	"reveal":   {"v"},
+	"copy":     {"c"},
+	"generate": {"ctrl+g"},
+	"submit":   {"ctrl+s"},
+	"expand":   {"ctrl+t"},
+	"editor":   {"ctrl+e"},
+	"files":    {"f"},
+	"vaults":   {"o"},
+	"health":   {"d"},
+	"auditlog": {"l"},
+	"quit":     {"q", "ctrl+c"},
+}
+
+type Config struct {
+	Keys      map[string][]string `toml:"keys"`
+	Theme     Theme               `toml:"theme"`
+	Clipboard Clipboard           `toml:"clipboard"`
+	Lock      Lock                `toml:"lock"`
+	Generator generator.Policy    `toml:"generator"`
+	Backup    Backup              `toml:"backup"`
+	Compact   Compact             `toml:"compact"`
+	Health    health.Policy       `toml:"health"`
+}
+
+// Theme holds colours as ANSI numbers ("212") or hex values ("#ff87d7").
+// Empty colours keep the default.
+type Theme struct {
+	NoColor bool   `toml:"no_color"`
+	Accent  string `toml:"accent"`
+	Border  string `toml:"border"`
+	Error   string `toml:"error"`
+	Success string `toml:"success"`
+}
+
+type Clipboard struct {
+	// Timeout after which a copied value is cleared, 0 to keep it.
+	Timeout time.Duration `toml:"timeout"`
+}
+
+type Lock struct {
+	// Timeout of inactivity after which the vault locks, 0 to never lock.
+	Timeout time.Duration `toml:"timeout"`
+}
+
+type Backup struct {
+	// Retention is the number of backups kept per vault.
+	Retention int `toml:"retention"`
+}
+
+type Compact struct {
+	// Threshold is the share of free space in a vault file above which it
+	// is compacted after the program ends or the trash is purged, 0 to
+	// never compact automatically.
+	Threshold float64 `toml:"threshold"`
+}
+
+func Default() Config {
+	keys := make(map[string][]string, len(defaultKeys))
+	for action, k := range defaultKeys {
+		keys[action] = slices.Clone(k)
+	}
+	return Config{
+		Keys: keys,
+		Theme: Theme{
+			Accent:  "212",
+			Border:  "240",
+			Error:   "9",
+			Success: "10",
+		},
+		Clipboard: Clipboard{Timeout: 30 * time.Second},
+		Lock:      Lock{Timeout: 5 * time.Minute},
+		Generator: generator.DefaultPolicy(),
+		Backup:    Backup{Retention: 5},
+		Compact:   Compact{Threshold: 0.5},
+		Health:    health.DefaultPolicy(),
+	}
+}
+
+// Dir returns the SentryVault configuration directory, which also holds the
+// vaults.
+func Dir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "SentryVault"), nil
+}
+
+func Path() (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.toml"), nil
+}
+
+// Load reads the configuration file, falling back to the defaults when there
+// is none.
+func Load() (Config, error) {
+	path, err := Path()
+	if err != nil {
+		return Config{}, err
+	}
+	return LoadFile(path)
+}
+
+// LoadFile reads and validates a configuration file. Settings missing from
+// the file keep their defaults.
+func LoadFile(path string) (Config, error) {
+	cfg := Default()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	keys := cfg.Keys
+	cfg.Keys = nil
+	md, err := toml.Decode(string(data), &cfg)
+	if err != nil {
+		var perr toml.ParseError
+		if errors.As(err, &perr) {
+			return cfg, fmt.Errorf("%s: %s", path, perr.ErrorWithPosition())
+		}
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	for action, k := range keys {
+		if _, ok := cfg.Keys[action]; !ok {
+			if cfg.Keys == nil {
+				cfg.Keys = make(map[string][]string)
+			}
+			cfg.Keys[action] = k
+		}
+	}
+
+	var errs []error
+	for _, key := range md.Undecoded() {
+		errs = append(errs, fmt.Errorf("%s: unknown setting", key))
+	}
+	if err = cfg.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err = errors.Join(errs...); err != nil {
+		return cfg, fmt.Errorf("%s:\n%w", path, err)
+	}
+	return cfg, nil
+}
+
+var colourPattern = regexp.MustCompile(`^(#[0-9a-fA-F]{6}|[0-9]{1,3})$`)
+
+// Validate reports every problem with the configuration at once.
+func (c Config) Validate() error {
+	var errs []error
+
+	bound := make(map[string]string)
+	for _, action := range slices.Sorted(maps.Keys(c.Keys)) {
+		if !slices.Contains(Actions, action) {
+			errs = append(errs, fmt.Errorf("keys.%s: unknown action, expected one of %s", action, strings.Join(Actions, ", ")))
+			continue
+		}
+		if len(c.Keys[action]) == 0 {
+			errs = append(errs, fmt.Errorf("keys.%s: at least one key is required", action))
+		}
+		for _, k := range c.Keys[action] {
+			if strings.TrimSpace(k) == "" {
+				errs = append(errs, fmt.Errorf("keys.%s: empty key", action))
+				continue
+			}
+			if other, ok := bound[k]; ok {
+				errs = append(errs, fmt.Errorf("keys.%s: %q is already bound to %s", action, k, other))
+				continue
+			}
+			bound[k] = action
+		}
+	}
+
+	for name, colour := range map[string]string{
+		"accent":  c.Theme.Accent,
+		"border":  c.Theme.Border,
+		"error":   c.Theme.Error,
+		"success": c.Theme.Success,
+	} {
+		if colour == "" {
+			continue
+		}
+		if !colourPattern.MatchString(colour) {
+			errs = append(errs, fmt.Errorf("theme.%s: %q is not an ANSI colour number or a #rrggbb hex colour", name, colour))
+		} else if n, err := strconv.Atoi(colour); err == nil && n > 255 {
+			errs = append(errs, fmt.Errorf("theme.%s: ANSI colours go up to 255, got %d", name, n))
+		}
+	}
+
+	if c.Clipboard.Timeout < 0 {
+		errs = append(errs, errors.New("clipboard.timeout: must not be negative, use 0 to never clear"))
+	}
+	if c.Lock.Timeout < 0 {
+		errs = append(errs, errors.New("lock.timeout: must not be negative, use 0 to never lock"))
+	}
+	if err := c.Generator.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("generator: %w", err))
+	}
+	if err := c.Health.Validate(); err != nil {
+		errs = append(errs, fmt.Errorf("health: %w", err))
+	}
+	if c.Backup.Retention < 1 {
+		errs = append(errs, fmt.Errorf("backup.retention: at least one backup must be kept, got %d", c.Backup.Retention))
+	}
+	if c.Compact.Threshold < 0 || c.Compact.Threshold > 1 {
+		errs = append(errs, fmt.Errorf("compact.threshold: must be between 0 and 1, got %g", c.Compact.Threshold))
+	}
+
+	slices.SortFunc(errs, func(a, b error) int {
+		return strings.Compare(a.Error(), b.Error())
+	})
+	return errors.Join(errs...)
+}
+
+// WriteDefault writes the default configuration to a new file at path, as a
+// starting point for editing.
+func WriteDefault(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	err = toml.NewEncoder(f).Encode(Default())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
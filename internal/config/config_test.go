@@ -0,0 +1,121 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	cfg, err := LoadFile(filepath.Join(t.TempDir(), "missing.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = Default().Validate(); err != nil {
+		t.Fatalf("default config is invalid: %v", err)
+	}
+
+	cfg, err = LoadFile(writeConfig(t, `
+[keys]
+up = ["up", "k"]
+down = ["down", "j"]
+
+[theme]
+no_color = true
+
+[clipboard]
+timeout = "45s"
+
+[lock]
+timeout = "0s"
+
+[generator]
+length = 32
+symbols = false
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Keys["down"]; len(got) != 2 || got[1] != "j" {
+		t.Errorf("keys.down = %q", got)
+	}
+	if got := cfg.Keys["quit"]; len(got) != 2 {
+		t.Errorf("unset keys.quit = %q, want the default", got)
+	}
+	if !cfg.Theme.NoColor || cfg.Theme.Accent != "212" {
+		t.Errorf("theme = %+v", cfg.Theme)
+	}
+	if cfg.Clipboard.Timeout != 45*time.Second || cfg.Lock.Timeout != 0 {
+		t.Errorf("clipboard = %v, lock = %v", cfg.Clipboard.Timeout, cfg.Lock.Timeout)
+	}
+	if cfg.Generator.Length != 32 || cfg.Generator.Symbols || !cfg.Generator.Digits {
+		t.Errorf("generator = %+v", cfg.Generator)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		want    []string
+	}{
+		"syntax": {
+			content: "[keys\nup = 1",
+			want:    []string{"line 2"},
+		},
+		"unknown setting": {
+			content: "[lock]\nafter = \"5m\"",
+			want:    []string{"lock.after: unknown setting"},
+		},
+		"invalid values": {
+			content: `
+[keys]
+dwon = ["j"]
+add = ["x"]
+remove = ["x"]
+
+[theme]
+accent = "pink"
+
+[generator]
+length = 4
+
+[backup]
+retention = 0
+
+[compact]
+threshold = 1.5
+`,
+			want: []string{
+				"keys.dwon: unknown action",
+				`"x" is already bound to`,
+				"theme.accent",
+				"generator: length",
+				"backup.retention",
+				"compact.threshold",
+			},
+		},
+	}
+	for name, tt := range tests {
+		_, err := LoadFile(writeConfig(t, tt.content))
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not mention %q", name, err, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Attachments are stored as Attachments/<entry>/<name>, holding the sealed
+// metadata and a "data" bucket with the encrypted stream split into pieces.
+// The stream itself is produced by cipher.NewStreamWriter, so a file never
+// has to be held in memory as a whole.
+const attachmentPieceSize = 256 * 1024
+
+type AttachmentMetadata struct {
+	Size    int64     `json:"size"`
+	Added   time.Time `json:"added"`
+	AddedBy string    `json:"addedBy,omitempty"`
+}
+
+func NewAttachmentMetadata(size int64, addedBy string) AttachmentMetadata {
+	return AttachmentMetadata{Size: size, Added: time.Now(), AddedBy: addedBy}
+}
+
+func (m AttachmentMetadata) Seal(cipherKey32 []byte) ([]byte, error) {
+	return seal(cipherKey32, m)
+}
+
+func OpenAttachmentMetadata(cipherKey32, data []byte) (AttachmentMetadata, error) {
+	var m AttachmentMetadata
+	err := open(cipherKey32, data, &m)
+	return m, err
+}
+
+// FormatSize formats a size in bytes for display, e.g. "1.5 MiB".
+func FormatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// GetAttachments returns the name and sealed metadata of every attachment of
+// an entry, ordered by name.
+func GetAttachments(db *bolt.DB, entry []byte) ([][][]byte, error) {
+	return view(db, func(t boltTx) ([][][]byte, error) {
+		return t.GetAttachments(entry)
+	})
+}
+
+func (t boltTx) GetAttachments(entry []byte) ([][][]byte, error) {
+	b := t.tx.Bucket([]byte("Attachments")).Bucket(entry)
+	if b == nil {
+		return nil, nil
+	}
+	var attachments [][][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		attachments = append(attachments, [][]byte{
+			bytes.Clone(k),
+			bytes.Clone(b.Bucket(k).Get([]byte("metadata"))),
+		})
+		return nil
+	})
+	return attachments, err
+}
+
+// PutAttachment stores a new attachment. write is called inside the
+// transaction with a writer that stores everything written to it as the
+// encrypted content.
+func PutAttachment(db *bolt.DB, entry, name, metadata []byte, write func(io.Writer) error) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return boltTx{tx}.PutAttachment(entry, name, metadata, write)
+	})
+}
+
+func (t boltTx) PutAttachment(entry, name, metadata []byte, write func(io.Writer) error) error {
+	if t.tx.Bucket([]byte("Content")).Bucket(entry) == nil {
+		return fmt.Errorf("entry \"%s\" %w", entry, ErrNotFound)
+	}
+	b, err := t.tx.Bucket([]byte("Attachments")).CreateBucketIfNotExists(entry)
+	if err != nil {
+		return err
+	}
+	if b.Bucket(name) != nil {
+		return fmt.Errorf("attachment \"%s\" %w", name, ErrExists)
+	}
+	a, err := b.CreateBucket(name)
+	if err != nil {
+		return err
+	}
+	if err = a.Put([]byte("metadata"), metadata); err != nil {
+		return err
+	}
+	data, err := a.CreateBucket([]byte("data"))
+	if err != nil {
+		return err
+	}
+
+	w := &pieceWriter{b: data}
+	if err = write(w); err != nil {
+		return err
+	}
+	return w.flush()
+}
+
+// GetAttachment calls read with the encrypted content of an attachment. The
+// reader is only valid until read returns.
+func GetAttachment(db *bolt.DB, entry, name []byte, read func(io.Reader) error) error {
+	return db.View(func(tx *bolt.Tx) error {
+		return boltTx{tx}.GetAttachment(entry, name, read)
+	})
+}
+
+func (t boltTx) GetAttachment(entry, name []byte, read func(io.Reader) error) error {
+	a := attachmentBucket(t.tx, entry, name)
+	if a == nil {
+		return fmt.Errorf("attachment \"%s\" %w", name, ErrNotFound)
+	}
+	data := a.Bucket([]byte("data"))
+	if data == nil {
+		return fmt.Errorf("attachment \"%s\" has no data", name)
+	}
+	return read(&pieceReader{c: data.Cursor()})
+}
+
+// AttachFile encrypts the file at path and attaches it to an entry.
+func AttachFile(store VaultStore, cipherKey32, entry, name []byte, path, addedBy string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+
+	metadata, err := NewAttachmentMetadata(info.Size(), addedBy).Seal(cipherKey32)
+	if err != nil {
+		return err
+	}
+	return store.PutAttachment(entry, name, metadata, func(w io.Writer) error {
+		_, err := cipher.EncryptStream(cipherKey32, w, f)
+		return err
+	})
+}
+
+// ExtractAttachment decrypts an attachment into w.
+func ExtractAttachment(store VaultStore, cipherKey32, entry, name []byte, w io.Writer) error {
+	return store.GetAttachment(entry, name, func(r io.Reader) error {
+		_, err := cipher.DecryptStream(cipherKey32, w, r)
+		return err
+	})
+}
+
+// ExtractAttachmentFile decrypts an attachment into a new file at path,
+// readable only by the current user. Nothing is left behind if decryption
+// fails part of the way through.
+func ExtractAttachmentFile(store VaultStore, cipherKey32, entry, name []byte, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	err = ExtractAttachment(store, cipherKey32, entry, name, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+func RemoveAttachment(db *bolt.DB, entry, name []byte) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return boltTx{tx}.RemoveAttachment(entry, name)
+	})
+}
+
+func (t boltTx) RemoveAttachment(entry, name []byte) error {
+	b := t.tx.Bucket([]byte("Attachments")).Bucket(entry)
+	if b == nil || b.Bucket(name) == nil {
+		return fmt.Errorf("attachment \"%s\" %w", name, ErrNotFound)
+	}
+	if err := b.DeleteBucket(name); err != nil {
+		return err
+	}
+	if k, _ := b.Cursor().First(); k == nil {
+		return t.tx.Bucket([]byte("Attachments")).DeleteBucket(entry)
+	}
+	return nil
+}
+
+func attachmentBucket(tx *bolt.Tx, entry, name []byte) *bolt.Bucket {
+	b := tx.Bucket([]byte("Attachments")).Bucket(entry)
+	if b == nil {
+		return nil
+	}
+	return b.Bucket(name)
+}
+
+// pieceWriter stores what is written to it under sequential keys of at most
+// attachmentPieceSize bytes each.
+type pieceWriter struct {
+	b   *bolt.Bucket
+	buf []byte
+}
+
+func (w *pieceWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if w.buf == nil {
+			w.buf = make([]byte, 0, attachmentPieceSize)
+		}
+		c := min(len(p), attachmentPieceSize-len(w.buf))
+		w.buf = append(w.buf, p[:c]...)
+		p = p[c:]
+		if len(w.buf) == attachmentPieceSize {
+			if err := w.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *pieceWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	seq, err := w.b.NextSequence()
+	if err != nil {
+		return err
+	}
+	// bbolt keeps a reference to the value until the transaction ends, so
+	// every piece needs its own buffer.
+	err = w.b.Put(binary.BigEndian.AppendUint64(nil, seq), w.buf)
+	w.buf = nil
+	return err
+}
+
+type pieceReader struct {
+	c       *bolt.Cursor
+	piece   []byte
+	started bool
+}
+
+func (r *pieceReader) Read(p []byte) (int, error) {
+	for len(r.piece) == 0 {
+		var v []byte
+		if !r.started {
+			_, v = r.c.First()
+			r.started = true
+		} else {
+			_, v = r.c.Next()
+		}
+		if v == nil {
+			return 0, io.EOF
+		}
+		r.piece = v
+	}
+	n := copy(p, r.piece)
+	r.piece = r.piece[n:]
+	return n, nil
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// LogRecord is a record of the audit log as stored, sealed by the auditlog
+// package.
+type LogRecord struct {
+	Seq  uint64
+	Data []byte
+}
+
+// AppendLog adds a record to the audit log. seal is called inside the
+// transaction with the sequence number of the new record and the data of
+// the last record, nil when there is none, and returns the data to store
+// and the new head of the log, which is kept in the header.
+func AppendLog(db *bolt.DB, seal func(seq uint64, last []byte) ([]byte, []byte, error)) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return boltTx{tx}.AppendLog(seal)
+	})
+}
+
+func (t boltTx) AppendLog(seal func(seq uint64, last []byte) ([]byte, []byte, error)) error {
+	b := t.tx.Bucket([]byte("AuditLog"))
+	if b == nil {
+		return errors.New("bucket \"auditlog\" not found")
+	}
+	header := t.tx.Bucket([]byte("Header"))
+	if header == nil {
+		return errors.New("header bucket not found")
+	}
+	// The sequence of the bucket keeps counting when records are deleted,
+	// so that removed records leave a gap
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	_, last := b.Cursor().Last()
+	data, head, err := seal(seq, bytes.Clone(last))
+	if err != nil {
+		return err
+	}
+	if err = b.Put(binary.BigEndian.AppendUint64(nil, seq), data); err != nil {
+		return err
+	}
+	return header.Put([]byte("auditHead"), head)
+}
+
+// GetLog returns every record of the audit log, oldest first, and the head
+// of the log.
+func GetLog(db *bolt.DB) ([]LogRecord, []byte, error) {
+	var records []LogRecord
+	var head []byte
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		records, head, err = boltTx{tx}.GetLog()
+		return err
+	})
+	return records, head, err
+}
+
+func (t boltTx) GetLog() ([]LogRecord, []byte, error) {
+	b := t.tx.Bucket([]byte("AuditLog"))
+	if b == nil {
+		return nil, nil, errors.New("bucket \"auditlog\" not found")
+	}
+	header := t.tx.Bucket([]byte("Header"))
+	if header == nil {
+		return nil, nil, errors.New("header bucket not found")
+	}
+	var records []LogRecord
+	err := b.ForEach(func(k, v []byte) error {
+		if len(k) != 8 {
+			return nil
+		}
+		records = append(records, LogRecord{Seq: binary.BigEndian.Uint64(k), Data: bytes.Clone(v)})
+		return nil
+	})
+	return records, bytes.Clone(header.Get([]byte("auditHead"))), err
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// backupDir returns the directory holding the backups of a vault.
+func backupDir(username string) (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find user config directory: %w", err)
+	}
+	return filepath.Join(configDir, "SentryVault", "backups", username), nil
+}
+
+// Backup writes a consistent copy of the vault into its backup directory and
+// deletes the oldest backups beyond retention. It returns the path of the
+// new backup.
+func Backup(db *bolt.DB, username string, retention int) (string, error) {
+	path, err := Snapshot(db, username)
+	if err != nil {
+		return "", err
+	}
+	return path, PruneBackups(username, retention)
+}
+
+// Snapshot writes a consistent copy of the vault into its backup directory,
+// leaving the older backups alone, and returns its path.
+func Snapshot(db *bolt.DB, username string) (string, error) {
+	dir, err := backupDir(username)
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("error creating directory: %w", err)
+	}
+
+	name := fmt.Sprintf("%s-%s.db", username, time.Now().UTC().Format("20060102-150405.000"))
+	path := filepath.Join(dir, name)
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// PruneBackups deletes the oldest backups of a vault beyond retention.
+func PruneBackups(username string, retention int) error {
+	backups, err := GetBackups(username)
+	if err != nil {
+		return err
+	}
+	for len(backups) > max(retention, 1) {
+		if err = os.Remove(backups[len(backups)-1]); err != nil {
+			return err
+		}
+		backups = backups[:len(backups)-1]
+	}
+	return nil
+}
+
+// GetBackups returns the paths of the backups of a vault, newest first.
+func GetBackups(username string) ([]string, error) {
+	dir, err := backupDir(username)
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading file path: %w", err)
+	}
+
+	var backups []string
+	for _, file := range files {
+		name := file.Name()
+		if !file.IsDir() && strings.HasPrefix(name, username+"-") && strings.HasSuffix(name, ".db") {
+			backups = append(backups, filepath.Join(dir, name))
+		}
+	}
+	// Timestamps in the names sort in chronological order
+	slices.Sort(backups)
+	slices.Reverse(backups)
+	return backups, nil
+}
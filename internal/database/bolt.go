@@ -2,40 +2,114 @@ package database
 
 import (
 	"errors"
+	"fmt"
 	"os"
-	"path/filepath"
+	"time"
 
 	bolt "go.etcd.io/bbolt"
 )
 
+var (
+	ErrExists   = errors.New("already exists")
+	ErrNotFound = errors.New("not found")
+)
+
 func Open(username string) (*bolt.DB, error) {
-	dir, err := os.UserConfigDir()
+	path, err := DBPath(username)
+	if err != nil {
+		return nil, err
+	}
+	return openFile(path, username)
+}
+
+// OpenStore opens a vault as a store without unlocking it, for what works
+// on a locked vault such as recovery and backups.
+func OpenStore(username string) (*BoltStore, error) {
+	db, err := Open(username)
 	if err != nil {
 		return nil, err
 	}
-	path := filepath.Join(dir, "SentryVault", "users", username+".db")
-	db, err := bolt.Open(path, 0600, nil)
+	return NewBoltStore(db), nil
+}
+
+// OpenDecoy opens the decoy of a vault, creating it if needed.
+func OpenDecoy(username string) (*bolt.DB, error) {
+	path, err := DecoyPath(username)
 	if err != nil {
 		return nil, err
 	}
-	if err = createBuckets(db); err != nil {
+	return openFile(path, username)
+}
+
+// OpenReadOnly opens a vault without writing anything to it, not even the
+// buckets a vault of an older version lacks.
+func OpenReadOnly(username string) (*bolt.DB, error) {
+	path, err := DBPath(username)
+	if err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("vault \"%s\" is open in another window", username)
+	}
+	return db, err
+}
+
+// GetDecoyHeaders returns the password check and salt of the decoy of a
+// vault. The decoy is opened read-only and left untouched.
+func GetDecoyHeaders(username string) ([]byte, []byte, error) {
+	path, err := DecoyPath(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = os.Stat(path); err != nil {
+		return nil, nil, err
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+	return GetHeaders(NewBoltStore(db))
+}
+
+func openFile(path, username string) (*bolt.DB, error) {
+	// Fail instead of waiting forever when another process has the vault open
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("vault \"%s\" is open in another window", username)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Only a new file is given its buckets here. Those a vault of an older
+	// version lacks are added by its migration, after the backup
+	err = db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("Header")) != nil {
+			return nil
+		}
+		return addBuckets(tx)
+	})
+	if err != nil {
+		db.Close()
 		return nil, err
 	}
 	return db, nil
 }
 
 func createBuckets(db *bolt.DB) error {
-	return db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte("Header"))
-		if err != nil {
-			return err
-		}
-		_, err = tx.CreateBucketIfNotExists([]byte("Content"))
-		if err != nil {
+	return db.Update(addBuckets)
+}
+
+// addBuckets creates the buckets of a vault that are missing. The
+// Quarantine is only created by Check when it is needed.
+func addBuckets(tx *bolt.Tx) error {
+	for _, name := range []string{"Header", "Content", "Metadata", "History", "Trash", "Attachments", "Members", "AuditLog"} {
+		if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
 			return err
 		}
-		return nil
-	})
+	}
+	return nil
 }
 
 func SetHeaders(db *bolt.DB, combinedTitle, salt []byte) error {
@@ -54,50 +128,86 @@ func SetHeaders(db *bolt.DB, combinedTitle, salt []byte) error {
 	})
 }
 
-func GetHeaders(db *bolt.DB) ([]byte, []byte, error) {
-	var combinedTitle, salt []byte
-	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Header"))
-		if b == nil {
-			return errors.New("header bucket not found")
-		}
-		combinedTitle = b.Get([]byte("combinedTitle"))
-		if combinedTitle == nil {
-			return errors.New("combined title not found")
-		}
-		salt = b.Get([]byte("salt"))
-		if salt == nil {
-			return errors.New("salt not found")
-		}
-		return nil
-	})
-	return combinedTitle, salt, err
+// GetHeaders returns the password check and the salt of a vault.
+func GetHeaders(store VaultStore) ([]byte, []byte, error) {
+	combinedTitle, err := store.GetHeader("combinedTitle")
+	if err != nil {
+		return nil, nil, err
+	}
+	if combinedTitle == nil {
+		return nil, nil, errors.New("combined title not found")
+	}
+	salt, err := store.GetHeader("salt")
+	if err != nil {
+		return nil, nil, err
+	}
+	if salt == nil {
+		return nil, nil, errors.New("salt not found")
+	}
+	return combinedTitle, salt, nil
 }
 
-func CreateEntry(db *bolt.DB, entry []byte) error {
+func CreateEntry(db *bolt.DB, entry, metadata []byte) error {
 	return db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Content"))
-		if b == nil {
-			return errors.New("bucket \"content\" not found")
-		}
-		_, err := b.CreateBucket(entry)
-		if err != nil {
-			return err
-		}
-		return nil
+		return boltTx{tx}.CreateEntry(entry, metadata)
 	})
 }
 
-func RemoveEntry(db *bolt.DB, entry []byte) error {
-	return db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Content"))
-		if b == nil {
-			return errors.New("bucket \"content\" not found")
-		}
-		return b.DeleteBucket(entry)
+func (t boltTx) CreateEntry(entry, metadata []byte) error {
+	b := t.tx.Bucket([]byte("Content"))
+	if b == nil {
+		return errors.New("bucket \"content\" not found")
+	}
+	_, err := b.CreateBucket(entry)
+	if errors.Is(err, bolt.ErrBucketExists) {
+		return fmt.Errorf("entry \"%s\" %w", entry, ErrExists)
+	}
+	if err != nil {
+		return err
+	}
+	m, err := metadataBucket(t.tx, entry, true)
+	if err != nil {
+		return err
+	}
+	return m.Put([]byte("entry"), metadata)
+}
+
+// RemoveEntry moves an entry with all of its fields and history into the
+// trash and returns the ID of the trash item.
+func RemoveEntry(db *bolt.DB, entry []byte) (uint64, error) {
+	return update(db, func(t boltTx) (uint64, error) {
+		return t.RemoveEntry(entry)
 	})
 }
 
+func (t boltTx) RemoveEntry(entry []byte) (uint64, error) {
+	b := t.tx.Bucket([]byte("Content"))
+	if b == nil {
+		return 0, errors.New("bucket \"content\" not found")
+	}
+	if b.Bucket(entry) == nil {
+		return 0, errors.New("bucket \"" + string(entry) + "\" not found")
+	}
+	id, item, err := newTrashItem(t.tx, entry, nil)
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range entryBuckets {
+		parent := t.tx.Bucket([]byte(name))
+		src := parent.Bucket(entry)
+		if src == nil {
+			continue
+		}
+		if err = moveBucket(item, []byte(name), src); err != nil {
+			return 0, err
+		}
+		if err = parent.DeleteBucket(entry); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
 func GetEntries(db *bolt.DB) ([][]byte, error) {
 	var entries [][]byte
 	err := db.View(func(tx *bolt.Tx) error {
@@ -114,54 +224,223 @@ func GetEntries(db *bolt.DB) ([][]byte, error) {
 	return entries, err
 }
 
-func Insert(db *bolt.DB, entry, key, value []byte) error {
-	return db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Content"))
-		if b == nil {
-			return errors.New("bucket \"content\" not found")
-		}
-		b = b.Bucket(entry)
-		if b == nil {
-			return errors.New("bucket \"" + string(entry) + "\" not found")
-		}
-		if err := b.Put(key, value); err != nil {
-			return err
+// GetEntriesMetadata returns every entry name paired with its encrypted
+// metadata, which is nil for entries that have none.
+func GetEntriesMetadata(db *bolt.DB) ([][][]byte, error) {
+	return view(db, boltTx.GetEntriesMetadata)
+}
+
+func (t boltTx) GetEntriesMetadata() ([][][]byte, error) {
+	b := t.tx.Bucket([]byte("Content"))
+	if b == nil {
+		return nil, errors.New("bucket \"content\" not found")
+	}
+	var pairs [][][]byte
+	c := b.Cursor()
+	for key, _ := c.First(); key != nil; key, _ = c.Next() {
+		var metadata []byte
+		if m, _ := metadataBucket(t.tx, key, false); m != nil {
+			metadata = m.Get([]byte("entry"))
 		}
-		return nil
+		pairs = append(pairs, [][]byte{key, metadata})
+	}
+	return pairs, nil
+}
+
+func Insert(db *bolt.DB, entry, key, value, metadata []byte) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return boltTx{tx}.Insert(entry, key, value, metadata)
+	})
+}
+
+func (t boltTx) Insert(entry, key, value, metadata []byte) error {
+	b := t.tx.Bucket([]byte("Content"))
+	if b == nil {
+		return errors.New("bucket \"content\" not found")
+	}
+	b = b.Bucket(entry)
+	if b == nil {
+		return errors.New("bucket \"" + string(entry) + "\" not found")
+	}
+	if err := archive(t.tx, entry, key); err != nil {
+		return err
+	}
+	if err := b.Put(key, value); err != nil {
+		return err
+	}
+	m, err := metadataBucket(t.tx, entry, true)
+	if err != nil {
+		return err
+	}
+	return m.Bucket([]byte("fields")).Put(key, metadata)
+}
+
+func Retrieve(db *bolt.DB, entry, key []byte) ([]byte, []byte, error) {
+	var value, metadata []byte
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		value, metadata, err = boltTx{tx}.Retrieve(entry, key)
+		return err
 	})
+	return value, metadata, err
+}
+
+func (t boltTx) Retrieve(entry, key []byte) ([]byte, []byte, error) {
+	b := t.tx.Bucket([]byte("Content"))
+	if b == nil {
+		return nil, nil, errors.New("bucket \"content\" not found")
+	}
+	b = b.Bucket(entry)
+	if b == nil {
+		return nil, nil, errors.New("bucket \"" + string(entry) + "\" not found")
+	}
+	value := b.Get(key)
+	if value == nil {
+		return nil, nil, fmt.Errorf("key \"%s\" %w", key, ErrNotFound)
+	}
+	var metadata []byte
+	if m, _ := metadataBucket(t.tx, entry, false); m != nil {
+		metadata = m.Bucket([]byte("fields")).Get(key)
+	}
+	return value, metadata, nil
+}
+
+func KeyExists(store VaultStore, entry, key []byte) (bool, error) {
+	_, _, err := store.Retrieve(entry, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
 }
 
 func RetrieveAll(db *bolt.DB, entry []byte) ([][][]byte, error) {
+	return view(db, func(t boltTx) ([][][]byte, error) {
+		return t.RetrieveAll(entry)
+	})
+}
+
+func (t boltTx) RetrieveAll(entry []byte) ([][][]byte, error) {
+	b := t.tx.Bucket([]byte("Content"))
+	if b == nil {
+		return nil, errors.New("bucket \"content\" not found")
+	}
+	b = b.Bucket(entry)
+	if b == nil {
+		return nil, errors.New("bucket \"" + string(entry) + "\" not found")
+	}
+	var fields *bolt.Bucket
+	if m, _ := metadataBucket(t.tx, entry, false); m != nil {
+		fields = m.Bucket([]byte("fields"))
+	}
 	var pairs [][][]byte
-	err := db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Content"))
-		if b == nil {
-			return errors.New("bucket \"content\" not found")
+	c := b.Cursor()
+	for key, value := c.First(); key != nil && value != nil; key, value = c.Next() {
+		var metadata []byte
+		if fields != nil {
+			metadata = fields.Get(key)
 		}
-		b = b.Bucket(entry)
-		if b == nil {
-			return errors.New("bucket \"" + string(entry) + "\" not found")
+		pairs = append(pairs, [][]byte{key, value, metadata})
+	}
+	return pairs, nil
+}
+
+// Remove moves a field together with its metadata and history into the trash
+// and returns the ID of the trash item.
+func Remove(db *bolt.DB, entry, key []byte) (uint64, error) {
+	return update(db, func(t boltTx) (uint64, error) {
+		return t.Remove(entry, key)
+	})
+}
+
+func (t boltTx) Remove(entry, key []byte) (uint64, error) {
+	b := t.tx.Bucket([]byte("Content"))
+	if b == nil {
+		return 0, errors.New("bucket \"content\" not found")
+	}
+	b = b.Bucket(entry)
+	if b == nil {
+		return 0, errors.New("bucket \"" + string(entry) + "\" not found")
+	}
+	value := b.Get(key)
+	if value == nil {
+		return 0, errors.New("key \"" + string(key) + "\" not found")
+	}
+	id, item, err := newTrashItem(t.tx, entry, key)
+	if err != nil {
+		return 0, err
+	}
+	if err = item.Put([]byte("value"), value); err != nil {
+		return 0, err
+	}
+	if err = b.Delete(key); err != nil {
+		return 0, err
+	}
+	if m, _ := metadataBucket(t.tx, entry, false); m != nil {
+		fields := m.Bucket([]byte("fields"))
+		if metadata := fields.Get(key); metadata != nil {
+			if err = item.Put([]byte("metadata"), metadata); err != nil {
+				return 0, err
+			}
 		}
-		c := b.Cursor()
-		for key, value := c.First(); key != nil && value != nil; key, value = c.Next() {
-			pairs = append(pairs, [][]byte{key, value})
+		if err = fields.Delete(key); err != nil {
+			return 0, err
 		}
-		return nil
+	}
+	if h := historyBucket(t.tx, entry, key); h != nil {
+		if err = moveBucket(item, []byte("History"), h); err != nil {
+			return 0, err
+		}
+	}
+	return id, deleteHistory(t.tx, entry, key)
+}
+
+func GetEntryMetadata(db *bolt.DB, entry []byte) ([]byte, error) {
+	return view(db, func(t boltTx) ([]byte, error) {
+		return t.GetEntryMetadata(entry)
 	})
-	return pairs, err
 }
 
-func Remove(db *bolt.DB, entry, key []byte) error {
+func (t boltTx) GetEntryMetadata(entry []byte) ([]byte, error) {
+	m, err := metadataBucket(t.tx, entry, false)
+	if err != nil || m == nil {
+		return nil, err
+	}
+	return m.Get([]byte("entry")), nil
+}
+
+func SetEntryMetadata(db *bolt.DB, entry, metadata []byte) error {
 	return db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("Content"))
-		if b == nil {
-			return errors.New("bucket \"content\" not found")
-		}
-		b = b.Bucket(entry)
-		if b == nil {
-			return errors.New("bucket \"" + string(entry) + "\" not found")
-		}
-		err := b.Delete(key)
-		return err
+		return boltTx{tx}.SetEntryMetadata(entry, metadata)
 	})
 }
+
+func (t boltTx) SetEntryMetadata(entry, metadata []byte) error {
+	if t.tx.Bucket([]byte("Content")).Bucket(entry) == nil {
+		return errors.New("bucket \"" + string(entry) + "\" not found")
+	}
+	m, err := metadataBucket(t.tx, entry, true)
+	if err != nil {
+		return err
+	}
+	return m.Put([]byte("entry"), metadata)
+}
+
+// metadataBucket returns the metadata bucket of an entry. Entries created before
+// metadata existed have none, in which case nil is returned unless create is set.
+func metadataBucket(tx *bolt.Tx, entry []byte, create bool) (*bolt.Bucket, error) {
+	b := tx.Bucket([]byte("Metadata"))
+	if b == nil {
+		return nil, errors.New("bucket \"metadata\" not found")
+	}
+	if !create {
+		return b.Bucket(entry), nil
+	}
+	m, err := b.CreateBucketIfNotExists(entry)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = m.CreateBucketIfNotExists([]byte("fields")); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
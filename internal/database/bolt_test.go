@@ -1,7 +1,690 @@
 package database
 
-import "testing"
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestDB(t *testing.T) *bolt.DB {
+	t.Helper()
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	if err = createBuckets(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
 
 func TestRetrieveAll(t *testing.T) {
-	
+	db := openTestDB(t)
+	if err := CreateEntry(db, []byte("github"), []byte("entry-meta")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Insert(db, []byte("github"), []byte("user"), []byte("alice"), []byte("user-meta")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Insert(db, []byte("github"), []byte("password"), []byte("secret"), []byte("password-meta")); err != nil {
+		t.Fatal(err)
+	}
+
+	pairs, err := RetrieveAll(db, []byte("github"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][][]byte{
+		{[]byte("password"), []byte("secret"), []byte("password-meta")},
+		{[]byte("user"), []byte("alice"), []byte("user-meta")},
+	}
+	if len(pairs) != len(want) {
+		t.Fatalf("got %d pairs, want %d", len(pairs), len(want))
+	}
+	for i := range want {
+		for j := range want[i] {
+			if !bytes.Equal(pairs[i][j], want[i][j]) {
+				t.Errorf("pair %d[%d] = %q, want %q", i, j, pairs[i][j], want[i][j])
+			}
+		}
+	}
+
+	if _, err = Remove(db, []byte("github"), []byte("user")); err != nil {
+		t.Fatal(err)
+	}
+	pairs, err = RetrieveAll(db, []byte("github"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 1 {
+		t.Fatalf("got %d pairs after remove, want 1", len(pairs))
+	}
+	for key, want := range map[string]bool{"user": false, "password": true} {
+		exists, err := KeyExists(NewBoltStore(db), []byte("github"), []byte(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != want {
+			t.Errorf("KeyExists(%q) = %v, want %v", key, exists, want)
+		}
+	}
+
+	metadata, err := GetEntryMetadata(db, []byte("github"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(metadata) != "entry-meta" {
+		t.Errorf("entry metadata = %q, want %q", metadata, "entry-meta")
+	}
+}
+
+func TestInsertArchivesHistory(t *testing.T) {
+	db := openTestDB(t)
+	if err := CreateEntry(db, []byte("github"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetHistoryRetention(NewBoltStore(db), 2); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"v1", "v2", "v3", "v4"} {
+		if err := Insert(db, []byte("github"), []byte("password"), []byte(value), []byte("meta-"+value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions, err := GetHistory(db, []byte("github"), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("got %d versions, want 2", len(versions))
+	}
+	if string(versions[0].Value) != "v3" || string(versions[1].Value) != "v2" {
+		t.Errorf("got versions %q, %q; want v3, v2", versions[0].Value, versions[1].Value)
+	}
+	if string(versions[0].Metadata) != "meta-v3" {
+		t.Errorf("version metadata = %q, want %q", versions[0].Metadata, "meta-v3")
+	}
+
+	if _, err = Remove(db, []byte("github"), []byte("password")); err != nil {
+		t.Fatal(err)
+	}
+	versions, err = GetHistory(db, []byte("github"), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 0 {
+		t.Errorf("got %d versions after remove, want 0", len(versions))
+	}
+}
+
+func TestTrashRestore(t *testing.T) {
+	db := openTestDB(t)
+	if err := CreateEntry(db, []byte("github"), []byte("entry-meta")); err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{"v1", "v2"} {
+		if err := Insert(db, []byte("github"), []byte("password"), []byte(value), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fieldID, err := Remove(db, []byte("github"), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entryID, err := RemoveEntry(db, []byte("github"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := GetTrash(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || !items[0].IsEntry() || items[1].Key != "password" {
+		t.Fatalf("unexpected trash contents: %+v", items)
+	}
+
+	// The field waits for its entry to come back first
+	if err = RestoreTrash(db, fieldID); err == nil {
+		t.Fatal("restoring a field of a trashed entry succeeded")
+	}
+	if err = RestoreTrash(db, entryID); err != nil {
+		t.Fatal(err)
+	}
+	if err = RestoreTrash(db, fieldID); err != nil {
+		t.Fatal(err)
+	}
+
+	value, _, err := Retrieve(db, []byte("github"), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "v2" {
+		t.Errorf("restored value = %q, want %q", value, "v2")
+	}
+	versions, err := GetHistory(db, []byte("github"), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Errorf("got %d restored versions, want 1", len(versions))
+	}
+	metadata, err := GetEntryMetadata(db, []byte("github"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(metadata) != "entry-meta" {
+		t.Errorf("restored entry metadata = %q, want %q", metadata, "entry-meta")
+	}
+
+	if _, err = RemoveEntry(db, []byte("github")); err != nil {
+		t.Fatal(err)
+	}
+	if err = CreateEntry(db, []byte("github"), nil); err != nil {
+		t.Fatal(err)
+	}
+	items, err = GetTrash(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = RestoreTrash(db, items[0].ID); err == nil {
+		t.Error("restoring over an existing entry succeeded")
+	}
+}
+
+func TestRename(t *testing.T) {
+	db := openTestDB(t)
+	for _, entry := range []string{"githbu", "gitlab"} {
+		if err := CreateEntry(db, []byte(entry), []byte("meta-"+entry)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, value := range []string{"v1", "v2"} {
+		if err := Insert(db, []byte("githbu"), []byte("pasword"), []byte(value), []byte("meta-"+value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RenameEntry(db, []byte("githbu"), []byte("gitlab")); !errors.Is(err, ErrExists) {
+		t.Fatalf("renaming onto an existing entry: got %v, want ErrExists", err)
+	}
+	if err := RenameEntry(db, []byte("githbu"), []byte("github")); err != nil {
+		t.Fatal(err)
+	}
+	if err := RenameKey(db, []byte("github"), []byte("pasword"), []byte("password")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := GetEntries(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || string(entries[0]) != "github" {
+		t.Fatalf("got entries %q, want github and gitlab", entries)
+	}
+	value, metadata, err := Retrieve(db, []byte("github"), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "v2" || string(metadata) != "meta-v2" {
+		t.Errorf("renamed field = %q/%q, want v2/meta-v2", value, metadata)
+	}
+	versions, err := GetHistory(db, []byte("github"), []byte("password"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 1 {
+		t.Errorf("got %d versions after rename, want 1", len(versions))
+	}
+	entryMetadata, err := GetEntryMetadata(db, []byte("github"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(entryMetadata) != "meta-githbu" {
+		t.Errorf("entry metadata = %q, want %q", entryMetadata, "meta-githbu")
+	}
+
+	if err = Insert(db, []byte("github"), []byte("user"), []byte("alice"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = RenameKey(db, []byte("github"), []byte("user"), []byte("password")); !errors.Is(err, ErrExists) {
+		t.Errorf("renaming onto an existing key: got %v, want ErrExists", err)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	db := openTestDB(t)
+	key := bytes.Repeat([]byte{7}, 32)
+	data := bytes.Repeat([]byte("licence"), 100000)
+	if err := CreateEntry(db, []byte("github"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	put := func() error {
+		return PutAttachment(db, []byte("github"), []byte("licence.txt"), []byte("meta"), func(w io.Writer) error {
+			_, err := cipher.EncryptStream(key, w, bytes.NewReader(data))
+			return err
+		})
+	}
+	if err := put(); err != nil {
+		t.Fatal(err)
+	}
+	if err := put(); !errors.Is(err, ErrExists) {
+		t.Fatalf("attaching twice: got %v, want ErrExists", err)
+	}
+
+	if _, err := RemoveEntry(db, []byte("github")); err != nil {
+		t.Fatal(err)
+	}
+	items, err := GetTrash(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = RestoreTrash(db, items[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = RenameEntry(db, []byte("github"), []byte("gitlab")); err != nil {
+		t.Fatal(err)
+	}
+
+	attachments, err := GetAttachments(db, []byte("gitlab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attachments) != 1 || string(attachments[0][0]) != "licence.txt" || string(attachments[0][1]) != "meta" {
+		t.Fatalf("unexpected attachments: %q", attachments)
+	}
+	var out bytes.Buffer
+	err = GetAttachment(db, []byte("gitlab"), []byte("licence.txt"), func(r io.Reader) error {
+		_, err := cipher.DecryptStream(key, &out, r)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Error("extracted attachment differs")
+	}
+
+	if err = RemoveAttachment(db, []byte("gitlab"), []byte("licence.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err = GetAttachment(db, []byte("gitlab"), []byte("licence.txt"), nil); !errors.Is(err, ErrNotFound) {
+		t.Errorf("extracting a removed attachment: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestRekey(t *testing.T) {
+	db := openTestDB(t)
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	seal := func(s string) []byte {
+		data, err := cipher.EncryptAESGCM(oldKey, []byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	title := seal("title")
+	must(SetHeaders(db, title, []byte("salt")))
+
+	must(CreateEntry(db, []byte("github"), seal("entry-meta")))
+	must(Insert(db, []byte("github"), []byte("password"), seal("old"), seal("old-meta")))
+	must(Insert(db, []byte("github"), []byte("password"), seal("new"), seal("new-meta")))
+	must(Insert(db, []byte("github"), []byte("user"), seal("alice"), seal("user-meta")))
+	data := bytes.Repeat([]byte("licence"), 100000)
+	must(PutAttachment(db, []byte("github"), []byte("licence.txt"), seal("attachment-meta"), func(w io.Writer) error {
+		_, err := cipher.EncryptStream(oldKey, w, bytes.NewReader(data))
+		return err
+	}))
+	_, err := Remove(db, []byte("github"), []byte("user"))
+	must(err)
+	must(CreateEntry(db, []byte("aws"), seal("aws-meta")))
+	must(Insert(db, []byte("aws"), []byte("key"), seal("AKIA"), seal("key-meta")))
+	_, err = RemoveEntry(db, []byte("aws"))
+	must(err)
+
+	// Quarantined items are rekeyed as far as they can be decrypted
+	damaged := []byte("cannot be decrypted")
+	must(db.Update(func(tx *bolt.Tx) error {
+		c := checker{tx: tx, key: oldKey, repair: true, report: &CheckReport{}}
+		intact, err := c.newQuarantineItem("Content/github/token", "the metadata is damaged", []byte("github"), []byte("token"))
+		if err != nil {
+			return err
+		}
+		if err = intact.Put([]byte("value"), seal("token")); err != nil {
+			return err
+		}
+		if err = intact.Put([]byte("metadata"), damaged); err != nil {
+			return err
+		}
+		version, err := c.newQuarantineItem("History/github/token/1", "cannot be decrypted", []byte("github"), []byte("token"))
+		if err != nil {
+			return err
+		}
+		return version.Put([]byte("value"), []byte(`{"value":"AAAA"}`))
+	}))
+	must(AppendLog(db, func(seq uint64, last []byte) ([]byte, []byte, error) {
+		return []byte("sealed"), []byte("head"), nil
+	}))
+
+	reseal := func(records []LogRecord, head []byte) ([]LogRecord, []byte, error) {
+		if len(records) != 1 || string(records[0].Data) != "sealed" || string(head) != "head" {
+			t.Errorf("reseal was given %+v, %q", records, head)
+		}
+		records[0].Data = []byte("resealed")
+		return records, []byte("new head"), nil
+	}
+	must(Rekey(db, oldKey, newKey, map[string][]byte{"wrapped": []byte("new wrap")}, map[string][]byte{"bob": []byte("record")}, reseal))
+
+	open := func(data []byte, want string) {
+		t.Helper()
+		got, err := cipher.DecryptAESGCM(newKey, data)
+		if err != nil {
+			t.Fatalf("%q is not under the new key: %v", want, err)
+		}
+		if string(got) != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	combinedTitle, _, err := GetHeaders(NewBoltStore(db))
+	must(err)
+	open(combinedTitle, "title")
+	wrapped, err := GetHeader(db, "wrapped")
+	must(err)
+	if string(wrapped) != "new wrap" {
+		t.Errorf("header not set: %q", wrapped)
+	}
+	record, err := GetMember(db, []byte("bob"))
+	must(err)
+	if string(record) != "record" {
+		t.Errorf("member not set: %q", record)
+	}
+
+	value, metadata, err := Retrieve(db, []byte("github"), []byte("password"))
+	must(err)
+	open(value, "new")
+	open(metadata, "new-meta")
+	entryMeta, err := GetEntryMetadata(db, []byte("github"))
+	must(err)
+	open(entryMeta, "entry-meta")
+	versions, err := GetHistory(db, []byte("github"), []byte("password"))
+	must(err)
+	open(versions[0].Value, "old")
+	open(versions[0].Metadata, "old-meta")
+
+	attachments, err := GetAttachments(db, []byte("github"))
+	must(err)
+	open(attachments[0][1], "attachment-meta")
+	var out bytes.Buffer
+	must(GetAttachment(db, []byte("github"), []byte("licence.txt"), func(r io.Reader) error {
+		_, err := cipher.DecryptStream(newKey, &out, r)
+		return err
+	}))
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Error("rekeyed attachment differs")
+	}
+
+	must(db.View(func(tx *bolt.Tx) error {
+		quarantine := tx.Bucket([]byte("Quarantine"))
+		item := quarantine.Bucket(binary.BigEndian.AppendUint64(nil, 1))
+		open(item.Get([]byte("value")), "token")
+		if !bytes.Equal(item.Get([]byte("metadata")), damaged) {
+			t.Error("the damaged metadata was changed")
+		}
+		if v := quarantine.Bucket(binary.BigEndian.AppendUint64(nil, 2)).Get([]byte("value")); string(v) != `{"value":"AAAA"}` {
+			t.Errorf("the damaged version was changed: %q", v)
+		}
+		return nil
+	}))
+	records, head, err := GetLog(db)
+	must(err)
+	if len(records) != 1 || string(records[0].Data) != "resealed" || string(head) != "new head" {
+		t.Errorf("the log was not resealed: %+v, %q", records, head)
+	}
+
+	items, err := GetTrash(db)
+	must(err)
+	for _, item := range items {
+		must(RestoreTrash(db, item.ID))
+	}
+	value, metadata, err = Retrieve(db, []byte("github"), []byte("user"))
+	must(err)
+	open(value, "alice")
+	open(metadata, "user-meta")
+	value, _, err = Retrieve(db, []byte("aws"), []byte("key"))
+	must(err)
+	open(value, "AKIA")
+
+	// A wrong old key leaves the vault as it was
+	if err = Rekey(db, oldKey, newKey, nil, nil, nil); err == nil {
+		t.Fatal("Rekey succeeded with the wrong old key")
+	}
+	combinedTitle, _, err = GetHeaders(NewBoltStore(db))
+	must(err)
+	open(combinedTitle, "title")
+}
+
+func TestCheckRepair(t *testing.T) {
+	db := openTestDB(t)
+	key := bytes.Repeat([]byte{1}, 32)
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	seal := func(s string) []byte {
+		data, err := cipher.EncryptAESGCM(key, []byte(s))
+		must(err)
+		return data
+	}
+	fieldMeta := func() []byte {
+		data, err := NewFieldMetadata("alice", "").Seal(key)
+		must(err)
+		return data
+	}
+	entryMeta, err := NewEntryMetadata().Seal(key)
+	must(err)
+	salt := bytes.Repeat([]byte{3}, 16)
+	must(SetHeaders(db, seal("title"), salt))
+	must(CreateEntry(db, []byte("github"), entryMeta))
+	must(Insert(db, []byte("github"), []byte("user"), seal("alice"), fieldMeta()))
+	must(Insert(db, []byte("github"), []byte("password"), seal("old"), fieldMeta()))
+	must(Insert(db, []byte("github"), []byte("password"), seal("new"), fieldMeta()))
+
+	report, err := Check(db, key, false)
+	must(err)
+	if len(report.Damage) != 0 || report.Checked == 0 {
+		t.Fatalf("Check of an intact vault = %+v", report)
+	}
+
+	// Flip a bit of the current password and of its previous version
+	must(db.Update(func(tx *bolt.Tx) error {
+		content := tx.Bucket([]byte("Content")).Bucket([]byte("github"))
+		value := bytes.Clone(content.Get([]byte("password")))
+		value[len(value)-1] ^= 1
+		if err := content.Put([]byte("password"), value); err != nil {
+			return err
+		}
+		history := tx.Bucket([]byte("History")).Bucket([]byte("github")).Bucket([]byte("password"))
+		k, v := history.Cursor().First()
+		return history.Put(k, bytes.Replace(v, []byte(`"value":"`), []byte(`"value":"AAAA`), 1))
+	}))
+
+	report, err = Check(db, key, false)
+	must(err)
+	if len(report.Damage) != 2 || report.Damage[0].Path != "Content/github/password" || report.Damage[1].Path != "History/github/password/1" {
+		t.Fatalf("Check found %v", report.Damage)
+	}
+	if report.Damage[0].Quarantined {
+		t.Fatal("Check without repair quarantined")
+	}
+
+	report, err = Check(db, key, true)
+	must(err)
+	if len(report.Damage) != 2 || !report.Damage[0].Quarantined || !report.Damage[1].Quarantined {
+		t.Fatalf("repair = %v", report.Damage)
+	}
+	if count, err := QuarantineCount(db); err != nil || count != 2 {
+		t.Fatalf("QuarantineCount = %d, %v", count, err)
+	}
+	if _, _, err = Retrieve(db, []byte("github"), []byte("password")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("the damaged field is still there: %v", err)
+	}
+	value, _, err := Retrieve(db, []byte("github"), []byte("user"))
+	must(err)
+	if plain, err := cipher.DecryptAESGCM(key, value); err != nil || string(plain) != "alice" {
+		t.Fatalf("the intact field = %q, %v", plain, err)
+	}
+
+	report, err = Check(db, key, false)
+	must(err)
+	if len(report.Damage) != 0 {
+		t.Fatalf("Check after the repair = %v", report.Damage)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	db := openTestDB(t)
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(CreateEntry(db, []byte("kept"), nil))
+	must(Insert(db, []byte("kept"), []byte("user"), []byte("alice"), nil))
+	must(CreateEntry(db, []byte("secret"), nil))
+	secret := bytes.Repeat([]byte("s3cr3t"), 1000)
+	for i := range 100 {
+		must(Insert(db, []byte("secret"), fmt.Appendf(nil, "key%d", i), secret, nil))
+	}
+	id, err := RemoveEntry(db, []byte("secret"))
+	must(err)
+	must(PurgeTrash(db, id))
+
+	ratio, err := FreeRatio(db)
+	must(err)
+	if ratio < 0.5 {
+		t.Fatalf("FreeRatio after purging = %.2f", ratio)
+	}
+
+	// The old file is read through a handle kept across the compaction
+	path := db.Path()
+	old, err := os.Open(path)
+	must(err)
+	defer old.Close()
+
+	result, err := Compact(db)
+	must(err)
+	if result.Reclaimed() <= 0 || result.After >= result.Before {
+		t.Fatalf("Compact = %+v", result)
+	}
+	data, err := io.ReadAll(old)
+	must(err)
+	if bytes.Contains(data, []byte("s3cr3t")) || bytes.Contains(data, []byte("kept")) || len(bytes.Trim(data, "\x00")) != 0 {
+		t.Fatal("the old file was not overwritten")
+	}
+	if _, err = os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Fatalf("the temporary file is left behind: %v", err)
+	}
+
+	db, err = bolt.Open(path, 0600, nil)
+	must(err)
+	defer db.Close()
+	value, _, err := Retrieve(db, []byte("kept"), []byte("user"))
+	must(err)
+	if string(value) != "alice" {
+		t.Fatalf("Retrieve after Compact = %q", value)
+	}
+	if _, _, err = Retrieve(db, []byte("secret"), []byte("key0")); err == nil {
+		t.Fatalf("the purged entry survived: %v", err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db := openTestDB(t)
+	saved := migrations
+	t.Cleanup(func() {
+		migrations = saved
+	})
+	var ran []uint64
+	migrations = []migration{
+		{version: 1, name: "first", migrate: func(tx *bolt.Tx, _ Upgrade) error {
+			ran = append(ran, 1)
+			return nil
+		}},
+		{version: 2, name: "second", migrate: func(tx *bolt.Tx, _ Upgrade) error {
+			ran = append(ran, 2)
+			return tx.Bucket([]byte("Header")).Put([]byte("second"), []byte("done"))
+		}},
+	}
+
+	if pending, err := PendingMigrations(NewBoltStore(db)); err != nil || pending != 2 {
+		t.Fatalf("PendingMigrations of an unversioned vault = %d, %v", pending, err)
+	}
+	names, err := Migrate(db, Upgrade{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(names, []string{"first", "second"}) || !slices.Equal(ran, []uint64{1, 2}) {
+		t.Fatalf("Migrate ran %v, %v", names, ran)
+	}
+	if version, err := GetSchemaVersion(NewBoltStore(db)); err != nil || version != 2 {
+		t.Fatalf("GetSchemaVersion = %d, %v", version, err)
+	}
+	if names, err = Migrate(db, Upgrade{}); err != nil || len(names) != 0 {
+		t.Fatalf("Migrate of a current vault = %v, %v", names, err)
+	}
+
+	// A failing migration rolls back the ones before it
+	migrations = append(migrations,
+		migration{version: 3, name: "third", migrate: func(tx *bolt.Tx, _ Upgrade) error {
+			return tx.Bucket([]byte("Header")).Put([]byte("third"), []byte("done"))
+		}},
+		migration{version: 4, name: "broken", migrate: func(*bolt.Tx, Upgrade) error {
+			return errors.New("broken")
+		}},
+	)
+	if _, err = Migrate(db, Upgrade{}); err == nil || !strings.Contains(err.Error(), "schema version 4, broken") {
+		t.Fatalf("Migrate with a failing migration = %v", err)
+	}
+	if version, _ := GetSchemaVersion(NewBoltStore(db)); version != 2 {
+		t.Fatalf("schema version after a failed migration = %d", version)
+	}
+	if third, _ := GetHeader(db, "third"); third != nil {
+		t.Fatal("the migration before the failing one was kept")
+	}
+
+	if err = SetSchemaVersion(NewBoltStore(db), 9); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = PendingMigrations(NewBoltStore(db)); !errors.Is(err, ErrNewerSchema) {
+		t.Fatalf("PendingMigrations of a newer vault = %v", err)
+	}
+	if _, err = Migrate(db, Upgrade{}); !errors.Is(err, ErrNewerSchema) {
+		t.Fatalf("Migrate of a newer vault = %v", err)
+	}
 }
@@ -0,0 +1,109 @@
+package database
+
+import (
+	"fmt"
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// compactTxSize is how many bytes Compact copies per transaction.
+const compactTxSize = 1 << 20
+
+// CompactResult is the size of a vault file before and after Compact.
+type CompactResult struct {
+	Before int64
+	After  int64
+}
+
+// Reclaimed returns the number of bytes Compact freed.
+func (r CompactResult) Reclaimed() int64 {
+	return r.Before - r.After
+}
+
+// FreeRatio returns the share of the vault file taken by free pages, which
+// still hold what was deleted until Compact rewrites the file.
+func FreeRatio(db *bolt.DB) (float64, error) {
+	info, err := os.Stat(db.Path())
+	if err != nil {
+		return 0, err
+	}
+	if info.Size() == 0 {
+		return 0, nil
+	}
+	stats := db.Stats()
+	free := int64(stats.FreePageN+stats.PendingPageN) * int64(db.Info().PageSize)
+	return float64(free) / float64(info.Size()), nil
+}
+
+// Compact rewrites the vault into a fresh file without free pages, replaces
+// the vault file with it, then overwrites the old file with zeros so deleted
+// ciphertexts and entry names cannot be recovered from the disk. It closes
+// db, which must not be in use by any transaction, and the caller opens the
+// vault again if it needs it.
+func Compact(db *bolt.DB) (CompactResult, error) {
+	var result CompactResult
+	path := db.Path()
+	info, err := os.Stat(path)
+	if err != nil {
+		return result, err
+	}
+	result.Before = info.Size()
+
+	tmp := path + ".compact"
+	if err = os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+	dst, err := bolt.Open(tmp, 0600, nil)
+	if err != nil {
+		return result, err
+	}
+	if err = bolt.Compact(dst, db, compactTxSize); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return result, fmt.Errorf("error compacting vault: %w", err)
+	}
+	if err = dst.Close(); err != nil {
+		os.Remove(tmp)
+		return result, err
+	}
+
+	// Keep the old file open past the rename so it can still be scrubbed,
+	// while the vault stays locked against other processes until the new
+	// file is in place
+	old, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		os.Remove(tmp)
+		return result, err
+	}
+	defer old.Close()
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return result, err
+	}
+	if err = db.Close(); err != nil {
+		return result, err
+	}
+	if err = scrub(old, result.Before); err != nil {
+		return result, fmt.Errorf("error overwriting the old vault file: %w", err)
+	}
+
+	if info, err = os.Stat(path); err != nil {
+		return result, err
+	}
+	result.After = info.Size()
+	return result, nil
+}
+
+// scrub overwrites the first size bytes of f with zeros and flushes them to
+// the disk.
+func scrub(f *os.File, size int64) error {
+	zeros := make([]byte, compactTxSize)
+	for off := int64(0); off < size; off += int64(len(zeros)) {
+		n := min(int64(len(zeros)), size-off)
+		if _, err := f.WriteAt(zeros[:n], off); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
@@ -0,0 +1,460 @@
+package database
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Damage is an item of a vault that cannot be read, found by Check.
+type Damage struct {
+	// Path locates the item by its buckets and keys, such as
+	// "Content/github/password".
+	Path   string
+	Reason string
+	// Quarantined reports whether the item was moved into the Quarantine
+	// bucket by a repair.
+	Quarantined bool
+}
+
+func (d Damage) String() string {
+	s := fmt.Sprintf("%s: %s", d.Path, d.Reason)
+	if d.Quarantined {
+		s += " (quarantined)"
+	}
+	return s
+}
+
+// CheckReport is the outcome of Check.
+type CheckReport struct {
+	// Checked counts the ciphertexts that were authenticated.
+	Checked int
+	Damage  []Damage
+}
+
+// Check walks every bucket of a vault, authenticating every ciphertext and
+// checking that the header is complete and the pages of the file are
+// consistent. With repair set, damaged fields, versions, attachments, trash
+// items and entry metadata are moved into the Quarantine bucket, so that
+// the rest of their entries can be used again. Damage to the header and the
+// pages cannot be repaired this way and is only reported.
+func Check(db *bolt.DB, cipherKey32 []byte, repair bool) (CheckReport, error) {
+	var report CheckReport
+	err := db.View(func(tx *bolt.Tx) error {
+		for err := range tx.Check() {
+			report.Damage = append(report.Damage, Damage{Path: "pages", Reason: err.Error()})
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	walk := func(tx *bolt.Tx) error {
+		c := checker{tx: tx, key: cipherKey32, repair: repair, report: &report}
+		return c.walk()
+	}
+	if repair {
+		err = db.Update(walk)
+	} else {
+		err = db.View(walk)
+	}
+	return report, err
+}
+
+type checker struct {
+	tx     *bolt.Tx
+	key    []byte
+	repair bool
+	report *CheckReport
+}
+
+func (c checker) damage(path, reason string, quarantined bool) {
+	c.report.Damage = append(c.report.Damage, Damage{Path: path, Reason: reason, Quarantined: quarantined})
+}
+
+// authenticate decrypts a ciphertext, returning why it cannot be read.
+func (c checker) authenticate(data []byte) error {
+	c.report.Checked++
+	_, err := cipher.DecryptAESGCM(c.key, data)
+	return err
+}
+
+func (c checker) walk() error {
+	missing := false
+	for _, name := range append([]string{"Header", "Trash"}, entryBuckets...) {
+		if c.tx.Bucket([]byte(name)) == nil {
+			c.damage(name, "the bucket is missing", false)
+			missing = true
+		}
+	}
+	if missing {
+		return nil
+	}
+	c.header()
+
+	content := c.tx.Bucket([]byte("Content"))
+	for _, entry := range bucketNames(content) {
+		if err := c.entry(entry, content.Bucket(entry)); err != nil {
+			return err
+		}
+	}
+	c.orphans()
+
+	trash := c.tx.Bucket([]byte("Trash"))
+	for _, id := range bucketNames(trash) {
+		path := fmt.Sprintf("Trash/%d", binary.BigEndian.Uint64(id))
+		if reason := c.trashItem(trash.Bucket(id)); reason != "" {
+			if err := c.quarantineBucket(path, reason, trash.Bucket(id).Get([]byte("entry")), trash, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// header checks the password check, salt, audit log key and settings of the
+// vault.
+func (c checker) header() {
+	header := c.tx.Bucket([]byte("Header"))
+	if combinedTitle := header.Get([]byte("combinedTitle")); combinedTitle == nil {
+		c.damage("Header/combinedTitle", "the password check is missing", false)
+	} else if err := c.authenticate(combinedTitle); err != nil {
+		c.damage("Header/combinedTitle", "the password check cannot be decrypted: "+err.Error(), false)
+	}
+	if salt := header.Get([]byte("salt")); len(salt) != 16 {
+		c.damage("Header/salt", fmt.Sprintf("the salt has %d bytes instead of 16", len(salt)), false)
+	}
+	if auditKey := header.Get([]byte("auditKey")); auditKey != nil {
+		if err := c.authenticate(auditKey); err != nil {
+			c.damage("Header/auditKey", "the audit log key cannot be decrypted: "+err.Error(), false)
+		}
+	}
+	if version, err := schemaVersion(c.tx); err != nil {
+		c.damage("Header/schemaVersion", err.Error(), false)
+	} else if err = checkSchema(version); err != nil {
+		c.damage("Header/schemaVersion", err.Error(), false)
+	}
+	if _, err := historyRetention(c.tx); err != nil {
+		c.damage("Header/historyRetention", err.Error(), false)
+	}
+	if _, err := trashRetention(c.tx); err != nil {
+		c.damage("Header/trashRetention", err.Error(), false)
+	}
+}
+
+// entry checks the fields, metadata, history and attachments of an entry.
+func (c checker) entry(entry []byte, content *bolt.Bucket) error {
+	metadata := c.tx.Bucket([]byte("Metadata")).Bucket(entry)
+	var fields *bolt.Bucket
+	if metadata != nil {
+		// Entry metadata is optional, so a damaged record is replaced by none
+		if data := metadata.Get([]byte("entry")); len(data) > 0 {
+			if reason := c.json(data, &EntryMetadata{}); reason != "" {
+				if err := c.quarantineValue(fmt.Sprintf("Metadata/%s/entry", entry), "the metadata "+reason, entry, nil, metadata, []byte("entry")); err != nil {
+					return err
+				}
+			}
+		}
+		fields = metadata.Bucket([]byte("fields"))
+	}
+
+	var keys [][]byte
+	content.ForEach(func(k, v []byte) error {
+		if v != nil {
+			keys = append(keys, k)
+		}
+		return nil
+	})
+	for _, key := range keys {
+		reason := ""
+		if err := c.authenticate(content.Get(key)); err != nil {
+			reason = "the value cannot be decrypted: " + err.Error()
+		} else if fields != nil && len(fields.Get(key)) > 0 {
+			if r := c.json(fields.Get(key), &FieldMetadata{}); r != "" {
+				reason = "the metadata " + r
+			}
+		}
+		if reason == "" {
+			continue
+		}
+		// The value and its metadata go together, the field is removed
+		if err := c.quarantineField(fmt.Sprintf("Content/%s/%s", entry, key), reason, entry, key, content, fields); err != nil {
+			return err
+		}
+	}
+
+	if history := c.tx.Bucket([]byte("History")).Bucket(entry); history != nil {
+		for _, key := range bucketNames(history) {
+			if err := c.versions(fmt.Sprintf("History/%s/%s", entry, key), entry, key, history.Bucket(key)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if attachments := c.tx.Bucket([]byte("Attachments")).Bucket(entry); attachments != nil {
+		for _, name := range bucketNames(attachments) {
+			if reason := c.attachment(attachments.Bucket(name)); reason != "" {
+				if err := c.quarantineBucket(fmt.Sprintf("Attachments/%s/%s", entry, name), reason, entry, attachments, name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// orphans reports metadata, history and attachments left without an entry.
+// They are not shown anywhere, so they are only reported.
+func (c checker) orphans() {
+	content := c.tx.Bucket([]byte("Content"))
+	for _, name := range entryBuckets[1:] {
+		parent := c.tx.Bucket([]byte(name))
+		for _, entry := range bucketNames(parent) {
+			if content.Bucket(entry) == nil {
+				c.damage(fmt.Sprintf("%s/%s", name, entry), "the entry it belongs to is missing", false)
+			}
+		}
+	}
+}
+
+// json authenticates sealed JSON such as metadata and returns why it cannot
+// be read, or "".
+func (c checker) json(data []byte, v any) string {
+	c.report.Checked++
+	plain, err := cipher.DecryptAESGCM(c.key, data)
+	if err != nil {
+		return "cannot be decrypted: " + err.Error()
+	}
+	if err = json.Unmarshal(plain, v); err != nil {
+		return "is not valid: " + err.Error()
+	}
+	return ""
+}
+
+// versions checks the history of a field, quarantining damaged versions.
+func (c checker) versions(path string, entry, key []byte, b *bolt.Bucket) error {
+	var ids [][]byte
+	b.ForEach(func(k, v []byte) error {
+		if v != nil {
+			ids = append(ids, k)
+		}
+		return nil
+	})
+	for _, id := range ids {
+		if reason := c.version(b.Get(id)); reason != "" {
+			versionPath := fmt.Sprintf("%s/%d", path, binary.BigEndian.Uint64(id))
+			if err := c.quarantineValue(versionPath, reason, entry, key, b, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c checker) version(data []byte) string {
+	var version Version
+	if err := json.Unmarshal(data, &version); err != nil {
+		return "the version is not valid: " + err.Error()
+	}
+	if err := c.authenticate(version.Value); err != nil {
+		return "the value cannot be decrypted: " + err.Error()
+	}
+	if len(version.Metadata) > 0 {
+		if reason := c.json(version.Metadata, &FieldMetadata{}); reason != "" {
+			return "the metadata " + reason
+		}
+	}
+	return ""
+}
+
+// attachment authenticates the metadata and every piece of the content of
+// an attachment, returning why it cannot be read, or "".
+func (c checker) attachment(a *bolt.Bucket) string {
+	if reason := c.json(a.Get([]byte("metadata")), &AttachmentMetadata{}); reason != "" {
+		return "the metadata " + reason
+	}
+	data := a.Bucket([]byte("data"))
+	if data == nil {
+		return "the content is missing"
+	}
+	c.report.Checked++
+	r, err := cipher.NewStreamReader(c.key, &pieceReader{c: data.Cursor()})
+	if err == nil {
+		_, err = io.Copy(io.Discard, r)
+	}
+	if err != nil {
+		return "the content cannot be decrypted: " + err.Error()
+	}
+	return ""
+}
+
+// trashItem checks a deleted field or entry, returning why it cannot be
+// read, or "".
+func (c checker) trashItem(item *bolt.Bucket) string {
+	if item.Get([]byte("key")) != nil {
+		if err := c.authenticate(item.Get([]byte("value"))); err != nil {
+			return "the value cannot be decrypted: " + err.Error()
+		}
+		if data := item.Get([]byte("metadata")); len(data) > 0 {
+			if reason := c.json(data, &FieldMetadata{}); reason != "" {
+				return "the metadata " + reason
+			}
+		}
+		return c.trashVersions(item.Bucket([]byte("History")))
+	}
+	if content := item.Bucket([]byte("Content")); content != nil {
+		var reason string
+		content.ForEach(func(k, v []byte) error {
+			if v != nil && reason == "" {
+				if err := c.authenticate(v); err != nil {
+					reason = fmt.Sprintf("the value of %s cannot be decrypted: %v", k, err)
+				}
+			}
+			return nil
+		})
+		if reason != "" {
+			return reason
+		}
+	}
+	if history := item.Bucket([]byte("History")); history != nil {
+		for _, key := range bucketNames(history) {
+			if reason := c.trashVersions(history.Bucket(key)); reason != "" {
+				return reason
+			}
+		}
+	}
+	if attachments := item.Bucket([]byte("Attachments")); attachments != nil {
+		for _, name := range bucketNames(attachments) {
+			if reason := c.attachment(attachments.Bucket(name)); reason != "" {
+				return fmt.Sprintf("attachment %s: %s", name, reason)
+			}
+		}
+	}
+	return ""
+}
+
+func (c checker) trashVersions(b *bolt.Bucket) string {
+	if b == nil {
+		return ""
+	}
+	var reason string
+	b.ForEach(func(k, v []byte) error {
+		if v != nil && reason == "" {
+			reason = c.version(v)
+		}
+		return nil
+	})
+	return reason
+}
+
+// newQuarantineItem creates the bucket a damaged item is moved into, noting
+// where it came from and why.
+func (c checker) newQuarantineItem(path, reason string, entry, key []byte) (*bolt.Bucket, error) {
+	quarantine, err := c.tx.CreateBucketIfNotExists([]byte("Quarantine"))
+	if err != nil {
+		return nil, err
+	}
+	id, err := quarantine.NextSequence()
+	if err != nil {
+		return nil, err
+	}
+	item, err := quarantine.CreateBucket(binary.BigEndian.AppendUint64(nil, id))
+	if err != nil {
+		return nil, err
+	}
+	values := map[string][]byte{
+		"path":        []byte(path),
+		"reason":      []byte(reason),
+		"entry":       entry,
+		"key":         key,
+		"quarantined": binary.BigEndian.AppendUint64(nil, uint64(time.Now().UnixNano())),
+	}
+	for k, v := range values {
+		if v == nil {
+			continue
+		}
+		if err = item.Put([]byte(k), v); err != nil {
+			return nil, err
+		}
+	}
+	return item, nil
+}
+
+// quarantineValue moves the value stored under name in b into quarantine.
+func (c checker) quarantineValue(path, reason string, entry, key []byte, b *bolt.Bucket, name []byte) error {
+	c.damage(path, reason, c.repair)
+	if !c.repair {
+		return nil
+	}
+	item, err := c.newQuarantineItem(path, reason, entry, key)
+	if err != nil {
+		return err
+	}
+	if err = item.Put([]byte("value"), b.Get(name)); err != nil {
+		return err
+	}
+	return b.Delete(name)
+}
+
+// quarantineField moves a damaged field and its metadata into quarantine,
+// leaving the other fields of the entry in place.
+func (c checker) quarantineField(path, reason string, entry, key []byte, content, fields *bolt.Bucket) error {
+	c.damage(path, reason, c.repair)
+	if !c.repair {
+		return nil
+	}
+	item, err := c.newQuarantineItem(path, reason, entry, key)
+	if err != nil {
+		return err
+	}
+	if err = item.Put([]byte("value"), content.Get(key)); err != nil {
+		return err
+	}
+	if err = content.Delete(key); err != nil {
+		return err
+	}
+	if fields == nil || fields.Get(key) == nil {
+		return nil
+	}
+	if err = item.Put([]byte("metadata"), fields.Get(key)); err != nil {
+		return err
+	}
+	return fields.Delete(key)
+}
+
+// quarantineBucket moves the damaged bucket called name in parent into
+// quarantine.
+func (c checker) quarantineBucket(path, reason string, entry []byte, parent *bolt.Bucket, name []byte) error {
+	c.damage(path, reason, c.repair)
+	if !c.repair {
+		return nil
+	}
+	item, err := c.newQuarantineItem(path, reason, entry, nil)
+	if err != nil {
+		return err
+	}
+	if err = moveBucket(item, []byte("data"), parent.Bucket(name)); err != nil {
+		return err
+	}
+	return parent.DeleteBucket(name)
+}
+
+// QuarantineCount returns the number of items in quarantine.
+func QuarantineCount(db *bolt.DB) (int, error) {
+	count := 0
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte("Quarantine"))
+		if b == nil {
+			return nil
+		}
+		count = len(bucketNames(b))
+		return nil
+	})
+	return count, err
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// GetHeader returns a copy of a value of the Header bucket, nil when it is
+// not set.
+func GetHeader(db *bolt.DB, name string) ([]byte, error) {
+	return view(db, func(t boltTx) ([]byte, error) {
+		return t.GetHeader(name)
+	})
+}
+
+func (t boltTx) GetHeader(name string) ([]byte, error) {
+	b := t.tx.Bucket([]byte("Header"))
+	if b == nil {
+		return nil, errors.New("header bucket not found")
+	}
+	return bytes.Clone(b.Get([]byte(name))), nil
+}
+
+func SetHeader(store VaultStore, name string, value []byte) error {
+	return store.PutHeaders(map[string][]byte{name: value})
+}
+
+// DeleteHeaders removes values of the header in one transaction.
+func DeleteHeaders(store VaultStore, names ...string) error {
+	values := make(map[string][]byte, len(names))
+	for _, name := range names {
+		values[name] = nil
+	}
+	return store.PutHeaders(values)
+}
+
+// PutHeaders sets several values of the Header bucket in one transaction.
+// Nil values are deleted.
+func PutHeaders(db *bolt.DB, values map[string][]byte) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return boltTx{tx}.PutHeaders(values)
+	})
+}
+
+func (t boltTx) PutHeaders(values map[string][]byte) error {
+	b := t.tx.Bucket([]byte("Header"))
+	if b == nil {
+		return errors.New("header bucket not found")
+	}
+	for name, value := range values {
+		var err error
+		if value == nil {
+			err = b.Delete([]byte(name))
+		} else {
+			err = b.Put([]byte(name), value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const DefaultHistoryRetention = 10
+
+// Version is a previous value of a field together with the metadata it had
+// at the time. Both are stored as the ciphertexts they were written with.
+type Version struct {
+	ID       uint64 `json:"-"`
+	Value    []byte `json:"value"`
+	Metadata []byte `json:"metadata,omitempty"`
+}
+
+func GetHistory(db *bolt.DB, entry, key []byte) ([]Version, error) {
+	return view(db, func(t boltTx) ([]Version, error) {
+		return t.GetHistory(entry, key)
+	})
+}
+
+func (t boltTx) GetHistory(entry, key []byte) ([]Version, error) {
+	b := historyBucket(t.tx, entry, key)
+	if b == nil {
+		return nil, nil
+	}
+	var versions []Version
+	c := b.Cursor()
+	for k, v := c.Last(); k != nil; k, v = c.Prev() {
+		var version Version
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, err
+		}
+		version.ID = binary.BigEndian.Uint64(k)
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// RestoreVersion makes a previous version the current value of a field. The
+// value being replaced is archived like any other overwrite.
+func RestoreVersion(store VaultStore, cipherKey32, entry, key []byte, version Version, changedBy string) error {
+	return store.Update(func(store VaultStore) error {
+		_, current, err := store.Retrieve(entry, key)
+		if err != nil {
+			return err
+		}
+		metadata, err := OpenFieldMetadata(cipherKey32, current)
+		if err != nil {
+			return err
+		}
+		metadata = metadata.Touch(changedBy, fmt.Sprintf("restored version %d", version.ID))
+		sealed, err := metadata.Seal(cipherKey32)
+		if err != nil {
+			return err
+		}
+		return store.Insert(entry, key, version.Value, sealed)
+	})
+}
+
+func GetHistoryRetention(store VaultStore) (int, error) {
+	value, err := store.GetHeader("historyRetention")
+	if err != nil {
+		return 0, err
+	}
+	return parseHistoryRetention(value)
+}
+
+func SetHistoryRetention(store VaultStore, retention int) error {
+	if retention < 0 {
+		return errors.New("history retention cannot be negative")
+	}
+	return store.PutHeaders(map[string][]byte{
+		"historyRetention": binary.BigEndian.AppendUint64(nil, uint64(retention)),
+	})
+}
+
+func historyRetention(tx *bolt.Tx) (int, error) {
+	b := tx.Bucket([]byte("Header"))
+	if b == nil {
+		return 0, errors.New("header bucket not found")
+	}
+	return parseHistoryRetention(b.Get([]byte("historyRetention")))
+}
+
+func parseHistoryRetention(value []byte) (int, error) {
+	if value == nil {
+		return DefaultHistoryRetention, nil
+	}
+	if len(value) != 8 {
+		return 0, errors.New("invalid history retention")
+	}
+	return int(binary.BigEndian.Uint64(value)), nil
+}
+
+func historyBucket(tx *bolt.Tx, entry, key []byte) *bolt.Bucket {
+	b := tx.Bucket([]byte("History"))
+	if b == nil {
+		return nil
+	}
+	if b = b.Bucket(entry); b == nil {
+		return nil
+	}
+	return b.Bucket(key)
+}
+
+// archive copies the current value of a field into its history before it is
+// overwritten, dropping the oldest versions beyond the vault's retention.
+func archive(tx *bolt.Tx, entry, key []byte) error {
+	value := tx.Bucket([]byte("Content")).Bucket(entry).Get(key)
+	if value == nil {
+		return nil
+	}
+	retention, err := historyRetention(tx)
+	if err != nil {
+		return err
+	}
+	if retention == 0 {
+		return nil
+	}
+
+	var metadata []byte
+	if m, _ := metadataBucket(tx, entry, false); m != nil {
+		metadata = m.Bucket([]byte("fields")).Get(key)
+	}
+	version, err := json.Marshal(Version{Value: value, Metadata: metadata})
+	if err != nil {
+		return err
+	}
+
+	h := tx.Bucket([]byte("History"))
+	if h == nil {
+		return errors.New("bucket \"history\" not found")
+	}
+	if h, err = h.CreateBucketIfNotExists(entry); err != nil {
+		return err
+	}
+	if h, err = h.CreateBucketIfNotExists(key); err != nil {
+		return err
+	}
+	id, err := h.NextSequence()
+	if err != nil {
+		return err
+	}
+	if err = h.Put(binary.BigEndian.AppendUint64(nil, id), version); err != nil {
+		return err
+	}
+
+	var ids [][]byte
+	c := h.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		ids = append(ids, k)
+	}
+	for len(ids) > retention {
+		if err = h.Delete(ids[0]); err != nil {
+			return err
+		}
+		ids = ids[1:]
+	}
+	return nil
+}
+
+// deleteHistory drops the history of a single field, or of the whole entry
+// when key is nil.
+func deleteHistory(tx *bolt.Tx, entry, key []byte) error {
+	b := tx.Bucket([]byte("History"))
+	if b == nil {
+		return errors.New("bucket \"history\" not found")
+	}
+	name := entry
+	if key != nil {
+		if b = b.Bucket(entry); b == nil {
+			return nil
+		}
+		name = key
+	}
+	if err := b.DeleteBucket(name); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// GetMembers returns the name and record of every member of a shared vault,
+// ordered by name.
+func GetMembers(db *bolt.DB) ([][][]byte, error) {
+	return view(db, boltTx.GetMembers)
+}
+
+func (t boltTx) GetMembers() ([][][]byte, error) {
+	b := t.tx.Bucket([]byte("Members"))
+	if b == nil {
+		// Vaults made before members existed have none until migrated
+		return nil, nil
+	}
+	var members [][][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		members = append(members, [][]byte{bytes.Clone(k), bytes.Clone(v)})
+		return nil
+	})
+	return members, err
+}
+
+// GetMember returns the record of a member, nil when there is no such
+// member.
+func GetMember(db *bolt.DB, name []byte) ([]byte, error) {
+	return view(db, func(t boltTx) ([]byte, error) {
+		return t.GetMember(name)
+	})
+}
+
+func (t boltTx) GetMember(name []byte) ([]byte, error) {
+	b := t.tx.Bucket([]byte("Members"))
+	if b == nil {
+		return nil, nil
+	}
+	return bytes.Clone(b.Get(name)), nil
+}
+
+// AddMember stores the record of a new member.
+func AddMember(db *bolt.DB, name, record []byte) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return boltTx{tx}.AddMember(name, record)
+	})
+}
+
+func (t boltTx) AddMember(name, record []byte) error {
+	b := t.tx.Bucket([]byte("Members"))
+	if b == nil {
+		return errors.New("bucket \"members\" not found")
+	}
+	if b.Get(name) != nil {
+		return fmt.Errorf("member \"%s\" %w", name, ErrExists)
+	}
+	return b.Put(name, record)
+}
+
+// DeleteMembers removes every member record, as when the key material of a
+// vault is wiped.
+func DeleteMembers(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return boltTx{tx}.DeleteMembers()
+	})
+}
+
+func (t boltTx) DeleteMembers() error {
+	if err := t.tx.DeleteBucket([]byte("Members")); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+		return err
+	}
+	_, err := t.tx.CreateBucket([]byte("Members"))
+	return err
+}
+
+func putMembers(tx *bolt.Tx, members map[string][]byte) error {
+	b := tx.Bucket([]byte("Members"))
+	if b == nil {
+		return errors.New("bucket \"members\" not found")
+	}
+	for name, record := range members {
+		var err error
+		if record == nil {
+			err = b.Delete([]byte(name))
+		} else {
+			err = b.Put([]byte(name), record)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
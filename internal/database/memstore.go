@@ -0,0 +1,681 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	_ FileStore  = (*BoltStore)(nil)
+	_ VaultStore = (*MemoryStore)(nil)
+)
+
+// MemoryStore is a VaultStore kept in memory, for tests of the code built
+// on a vault. It behaves like BoltStore, including the history, trash and
+// audit log, but its contents are gone once it is dropped.
+type MemoryStore struct {
+	mu   sync.Mutex
+	data *memoryData
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{data: &memoryData{
+		header:  map[string][]byte{},
+		members: map[string][]byte{},
+		entries: map[string]*memoryEntry{},
+		trash:   map[uint64]*memoryTrashItem{},
+	}}
+}
+
+type memoryData struct {
+	header   map[string][]byte
+	members  map[string][]byte
+	entries  map[string]*memoryEntry
+	trash    map[uint64]*memoryTrashItem
+	trashSeq uint64
+	log      []LogRecord
+	logSeq   uint64
+}
+
+type memoryEntry struct {
+	metadata    []byte
+	fields      map[string]*memoryField
+	attachments map[string]memoryAttachment
+}
+
+type memoryField struct {
+	value    []byte
+	metadata []byte
+	// history holds the previous versions, oldest first
+	history    []Version
+	historySeq uint64
+}
+
+type memoryAttachment struct {
+	metadata []byte
+	data     []byte
+}
+
+// memoryTrashItem holds either a whole entry or a single field.
+type memoryTrashItem struct {
+	entryName string
+	key       string
+	deleted   time.Time
+	entry     *memoryEntry
+	field     *memoryField
+}
+
+// clone copies the structure of the data. Byte slices are shared, they are
+// never changed in place and are copied in and out of the store.
+func (d *memoryData) clone() *memoryData {
+	c := *d
+	c.header = maps.Clone(d.header)
+	c.members = maps.Clone(d.members)
+	c.entries = make(map[string]*memoryEntry, len(d.entries))
+	for name, e := range d.entries {
+		c.entries[name] = e.clone()
+	}
+	c.trash = make(map[uint64]*memoryTrashItem, len(d.trash))
+	for id, item := range d.trash {
+		copied := *item
+		if item.entry != nil {
+			copied.entry = item.entry.clone()
+		}
+		if item.field != nil {
+			copied.field = item.field.clone()
+		}
+		c.trash[id] = &copied
+	}
+	c.log = slices.Clone(d.log)
+	return &c
+}
+
+func (e *memoryEntry) clone() *memoryEntry {
+	c := &memoryEntry{
+		metadata:    e.metadata,
+		fields:      make(map[string]*memoryField, len(e.fields)),
+		attachments: maps.Clone(e.attachments),
+	}
+	for key, f := range e.fields {
+		c.fields[key] = f.clone()
+	}
+	return c
+}
+
+func (f *memoryField) clone() *memoryField {
+	c := *f
+	c.history = slices.Clone(f.history)
+	return &c
+}
+
+func (s *MemoryStore) GetHeader(name string) ([]byte, error) {
+	return memoryView(s, func(t memoryTx) ([]byte, error) {
+		return t.GetHeader(name)
+	})
+}
+
+func (s *MemoryStore) PutHeaders(values map[string][]byte) error {
+	return s.Update(func(store VaultStore) error {
+		return store.PutHeaders(values)
+	})
+}
+
+func (s *MemoryStore) GetMembers() ([][][]byte, error) {
+	return memoryView(s, memoryTx.GetMembers)
+}
+
+func (s *MemoryStore) GetMember(name []byte) ([]byte, error) {
+	return memoryView(s, func(t memoryTx) ([]byte, error) {
+		return t.GetMember(name)
+	})
+}
+
+func (s *MemoryStore) AddMember(name, record []byte) error {
+	return s.Update(func(store VaultStore) error {
+		return store.AddMember(name, record)
+	})
+}
+
+func (s *MemoryStore) DeleteMembers() error {
+	return s.Update(func(store VaultStore) error {
+		return store.DeleteMembers()
+	})
+}
+
+func (s *MemoryStore) CreateEntry(entry, metadata []byte) error {
+	return s.Update(func(store VaultStore) error {
+		return store.CreateEntry(entry, metadata)
+	})
+}
+
+func (s *MemoryStore) RemoveEntry(entry []byte) (uint64, error) {
+	return memoryUpdate(s, func(t memoryTx) (uint64, error) {
+		return t.RemoveEntry(entry)
+	})
+}
+
+func (s *MemoryStore) RenameEntry(entry, newEntry []byte) error {
+	return s.Update(func(store VaultStore) error {
+		return store.RenameEntry(entry, newEntry)
+	})
+}
+
+func (s *MemoryStore) GetEntriesMetadata() ([][][]byte, error) {
+	return memoryView(s, memoryTx.GetEntriesMetadata)
+}
+
+func (s *MemoryStore) GetEntryMetadata(entry []byte) ([]byte, error) {
+	return memoryView(s, func(t memoryTx) ([]byte, error) {
+		return t.GetEntryMetadata(entry)
+	})
+}
+
+func (s *MemoryStore) SetEntryMetadata(entry, metadata []byte) error {
+	return s.Update(func(store VaultStore) error {
+		return store.SetEntryMetadata(entry, metadata)
+	})
+}
+
+func (s *MemoryStore) Insert(entry, key, value, metadata []byte) error {
+	return s.Update(func(store VaultStore) error {
+		return store.Insert(entry, key, value, metadata)
+	})
+}
+
+func (s *MemoryStore) Retrieve(entry, key []byte) ([]byte, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return memoryTx{s.data}.Retrieve(entry, key)
+}
+
+func (s *MemoryStore) RetrieveAll(entry []byte) ([][][]byte, error) {
+	return memoryView(s, func(t memoryTx) ([][][]byte, error) {
+		return t.RetrieveAll(entry)
+	})
+}
+
+func (s *MemoryStore) Remove(entry, key []byte) (uint64, error) {
+	return memoryUpdate(s, func(t memoryTx) (uint64, error) {
+		return t.Remove(entry, key)
+	})
+}
+
+func (s *MemoryStore) RenameKey(entry, key, newKey []byte) error {
+	return s.Update(func(store VaultStore) error {
+		return store.RenameKey(entry, key, newKey)
+	})
+}
+
+func (s *MemoryStore) GetHistory(entry, key []byte) ([]Version, error) {
+	return memoryView(s, func(t memoryTx) ([]Version, error) {
+		return t.GetHistory(entry, key)
+	})
+}
+
+func (s *MemoryStore) GetTrash() ([]TrashItem, error) {
+	return memoryView(s, memoryTx.GetTrash)
+}
+
+func (s *MemoryStore) RestoreTrash(id uint64) error {
+	return s.Update(func(store VaultStore) error {
+		return store.RestoreTrash(id)
+	})
+}
+
+func (s *MemoryStore) PurgeTrash(id uint64) error {
+	return s.Update(func(store VaultStore) error {
+		return store.PurgeTrash(id)
+	})
+}
+
+func (s *MemoryStore) PurgeExpiredTrash() (int, error) {
+	return memoryUpdate(s, memoryTx.PurgeExpiredTrash)
+}
+
+func (s *MemoryStore) GetAttachments(entry []byte) ([][][]byte, error) {
+	return memoryView(s, func(t memoryTx) ([][][]byte, error) {
+		return t.GetAttachments(entry)
+	})
+}
+
+func (s *MemoryStore) PutAttachment(entry, name, metadata []byte, write func(io.Writer) error) error {
+	return s.Update(func(store VaultStore) error {
+		return store.PutAttachment(entry, name, metadata, write)
+	})
+}
+
+func (s *MemoryStore) GetAttachment(entry, name []byte, read func(io.Reader) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return memoryTx{s.data}.GetAttachment(entry, name, read)
+}
+
+func (s *MemoryStore) RemoveAttachment(entry, name []byte) error {
+	return s.Update(func(store VaultStore) error {
+		return store.RemoveAttachment(entry, name)
+	})
+}
+
+func (s *MemoryStore) AppendLog(seal func(seq uint64, last []byte) ([]byte, []byte, error)) error {
+	return s.Update(func(store VaultStore) error {
+		return store.AppendLog(seal)
+	})
+}
+
+func (s *MemoryStore) GetLog() ([]LogRecord, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return memoryTx{s.data}.GetLog()
+}
+
+// Update runs fn on a copy of the contents, which replaces them when fn
+// returns nil.
+func (s *MemoryStore) Update(fn func(VaultStore) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data := s.data.clone()
+	if err := fn(memoryTx{data}); err != nil {
+		return err
+	}
+	s.data = data
+	return nil
+}
+
+// Close does nothing, a MemoryStore holds no resources.
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// memoryView returns what get reads from the contents of s.
+func memoryView[T any](s *MemoryStore, get func(memoryTx) (T, error)) (T, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return get(memoryTx{s.data})
+}
+
+// memoryUpdate returns the result of set run in an update of s.
+func memoryUpdate[T any](s *MemoryStore, set func(memoryTx) (T, error)) (T, error) {
+	var v T
+	err := s.Update(func(store VaultStore) error {
+		var err error
+		v, err = set(store.(memoryTx))
+		return err
+	})
+	return v, err
+}
+
+// memoryTx is the VaultStore of an update of a MemoryStore, working on the
+// contents directly.
+type memoryTx struct {
+	d *memoryData
+}
+
+func (t memoryTx) entry(entry []byte) (*memoryEntry, error) {
+	e, ok := t.d.entries[string(entry)]
+	if !ok {
+		return nil, fmt.Errorf("entry \"%s\" %w", entry, ErrNotFound)
+	}
+	return e, nil
+}
+
+func (t memoryTx) GetHeader(name string) ([]byte, error) {
+	return bytes.Clone(t.d.header[name]), nil
+}
+
+func (t memoryTx) PutHeaders(values map[string][]byte) error {
+	for name, value := range values {
+		if value == nil {
+			delete(t.d.header, name)
+		} else {
+			t.d.header[name] = bytes.Clone(value)
+		}
+	}
+	return nil
+}
+
+func (t memoryTx) GetMembers() ([][][]byte, error) {
+	var members [][][]byte
+	for _, name := range slices.Sorted(maps.Keys(t.d.members)) {
+		members = append(members, [][]byte{[]byte(name), bytes.Clone(t.d.members[name])})
+	}
+	return members, nil
+}
+
+func (t memoryTx) GetMember(name []byte) ([]byte, error) {
+	return bytes.Clone(t.d.members[string(name)]), nil
+}
+
+func (t memoryTx) AddMember(name, record []byte) error {
+	if _, ok := t.d.members[string(name)]; ok {
+		return fmt.Errorf("member \"%s\" %w", name, ErrExists)
+	}
+	t.d.members[string(name)] = bytes.Clone(record)
+	return nil
+}
+
+func (t memoryTx) DeleteMembers() error {
+	clear(t.d.members)
+	return nil
+}
+
+func (t memoryTx) CreateEntry(entry, metadata []byte) error {
+	if len(entry) == 0 {
+		return errors.New("entry name cannot be empty")
+	}
+	if _, ok := t.d.entries[string(entry)]; ok {
+		return fmt.Errorf("entry \"%s\" %w", entry, ErrExists)
+	}
+	t.d.entries[string(entry)] = &memoryEntry{
+		metadata: bytes.Clone(metadata),
+		fields:   map[string]*memoryField{},
+	}
+	return nil
+}
+
+func (t memoryTx) RemoveEntry(entry []byte) (uint64, error) {
+	e, err := t.entry(entry)
+	if err != nil {
+		return 0, err
+	}
+	delete(t.d.entries, string(entry))
+	return t.newTrashItem(&memoryTrashItem{entryName: string(entry), entry: e}), nil
+}
+
+func (t memoryTx) RenameEntry(entry, newEntry []byte) error {
+	if len(newEntry) == 0 {
+		return errors.New("entry name cannot be empty")
+	}
+	e, err := t.entry(entry)
+	if err != nil {
+		return err
+	}
+	if _, ok := t.d.entries[string(newEntry)]; ok {
+		return fmt.Errorf("entry \"%s\" %w", newEntry, ErrExists)
+	}
+	delete(t.d.entries, string(entry))
+	t.d.entries[string(newEntry)] = e
+	return nil
+}
+
+func (t memoryTx) GetEntriesMetadata() ([][][]byte, error) {
+	var pairs [][][]byte
+	for _, name := range slices.Sorted(maps.Keys(t.d.entries)) {
+		pairs = append(pairs, [][]byte{[]byte(name), bytes.Clone(t.d.entries[name].metadata)})
+	}
+	return pairs, nil
+}
+
+func (t memoryTx) GetEntryMetadata(entry []byte) ([]byte, error) {
+	e, ok := t.d.entries[string(entry)]
+	if !ok {
+		return nil, nil
+	}
+	return bytes.Clone(e.metadata), nil
+}
+
+func (t memoryTx) SetEntryMetadata(entry, metadata []byte) error {
+	e, err := t.entry(entry)
+	if err != nil {
+		return err
+	}
+	e.metadata = bytes.Clone(metadata)
+	return nil
+}
+
+func (t memoryTx) Insert(entry, key, value, metadata []byte) error {
+	e, err := t.entry(entry)
+	if err != nil {
+		return err
+	}
+	f, ok := e.fields[string(key)]
+	if !ok {
+		f = &memoryField{}
+		e.fields[string(key)] = f
+	} else {
+		retention, err := parseHistoryRetention(t.d.header["historyRetention"])
+		if err != nil {
+			return err
+		}
+		if retention > 0 {
+			f.historySeq++
+			f.history = append(f.history, Version{ID: f.historySeq, Value: f.value, Metadata: f.metadata})
+			if len(f.history) > retention {
+				f.history = f.history[len(f.history)-retention:]
+			}
+		}
+	}
+	f.value = bytes.Clone(value)
+	f.metadata = bytes.Clone(metadata)
+	return nil
+}
+
+func (t memoryTx) Retrieve(entry, key []byte) ([]byte, []byte, error) {
+	e, err := t.entry(entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, ok := e.fields[string(key)]
+	if !ok {
+		return nil, nil, fmt.Errorf("key \"%s\" %w", key, ErrNotFound)
+	}
+	return bytes.Clone(f.value), bytes.Clone(f.metadata), nil
+}
+
+func (t memoryTx) RetrieveAll(entry []byte) ([][][]byte, error) {
+	e, err := t.entry(entry)
+	if err != nil {
+		return nil, err
+	}
+	var pairs [][][]byte
+	for _, key := range slices.Sorted(maps.Keys(e.fields)) {
+		f := e.fields[key]
+		pairs = append(pairs, [][]byte{[]byte(key), bytes.Clone(f.value), bytes.Clone(f.metadata)})
+	}
+	return pairs, nil
+}
+
+func (t memoryTx) Remove(entry, key []byte) (uint64, error) {
+	e, err := t.entry(entry)
+	if err != nil {
+		return 0, err
+	}
+	f, ok := e.fields[string(key)]
+	if !ok {
+		return 0, fmt.Errorf("key \"%s\" %w", key, ErrNotFound)
+	}
+	delete(e.fields, string(key))
+	return t.newTrashItem(&memoryTrashItem{entryName: string(entry), key: string(key), field: f}), nil
+}
+
+func (t memoryTx) RenameKey(entry, key, newKey []byte) error {
+	if len(newKey) == 0 {
+		return errors.New("key cannot be empty")
+	}
+	e, err := t.entry(entry)
+	if err != nil {
+		return err
+	}
+	f, ok := e.fields[string(key)]
+	if !ok {
+		return fmt.Errorf("key \"%s\" %w", key, ErrNotFound)
+	}
+	if _, ok = e.fields[string(newKey)]; ok {
+		return fmt.Errorf("key \"%s\" %w", newKey, ErrExists)
+	}
+	delete(e.fields, string(key))
+	e.fields[string(newKey)] = f
+	return nil
+}
+
+func (t memoryTx) GetHistory(entry, key []byte) ([]Version, error) {
+	e, ok := t.d.entries[string(entry)]
+	if !ok {
+		return nil, nil
+	}
+	f, ok := e.fields[string(key)]
+	if !ok {
+		return nil, nil
+	}
+	var versions []Version
+	for _, v := range slices.Backward(f.history) {
+		versions = append(versions, Version{ID: v.ID, Value: bytes.Clone(v.Value), Metadata: bytes.Clone(v.Metadata)})
+	}
+	return versions, nil
+}
+
+func (t memoryTx) newTrashItem(item *memoryTrashItem) uint64 {
+	t.d.trashSeq++
+	item.deleted = time.Now()
+	t.d.trash[t.d.trashSeq] = item
+	return t.d.trashSeq
+}
+
+func (t memoryTx) GetTrash() ([]TrashItem, error) {
+	var items []TrashItem
+	for _, id := range slices.Backward(slices.Sorted(maps.Keys(t.d.trash))) {
+		item := t.d.trash[id]
+		items = append(items, TrashItem{ID: id, Entry: item.entryName, Key: item.key, Deleted: item.deleted})
+	}
+	return items, nil
+}
+
+func (t memoryTx) RestoreTrash(id uint64) error {
+	item, ok := t.d.trash[id]
+	if !ok {
+		return errors.New("item not found in trash")
+	}
+	e, exists := t.d.entries[item.entryName]
+	if item.field != nil {
+		if !exists {
+			return errors.New("entry \"" + item.entryName + "\" no longer exists, restore it first")
+		}
+		if _, ok = e.fields[item.key]; ok {
+			return errors.New("key \"" + item.key + "\" already exists in \"" + item.entryName + "\"")
+		}
+		e.fields[item.key] = item.field
+	} else {
+		if exists {
+			return errors.New("entry \"" + item.entryName + "\" already exists")
+		}
+		t.d.entries[item.entryName] = item.entry
+	}
+	delete(t.d.trash, id)
+	return nil
+}
+
+func (t memoryTx) PurgeTrash(id uint64) error {
+	if _, ok := t.d.trash[id]; !ok {
+		return errors.New("item not found in trash")
+	}
+	delete(t.d.trash, id)
+	return nil
+}
+
+func (t memoryTx) PurgeExpiredTrash() (int, error) {
+	retention, err := parseTrashRetention(t.d.header["trashRetention"])
+	if err != nil || retention == 0 {
+		return 0, err
+	}
+	purged := 0
+	cutoff := time.Now().Add(-retention)
+	for id, item := range t.d.trash {
+		if item.deleted.Before(cutoff) {
+			delete(t.d.trash, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (t memoryTx) GetAttachments(entry []byte) ([][][]byte, error) {
+	e, ok := t.d.entries[string(entry)]
+	if !ok {
+		return nil, nil
+	}
+	var attachments [][][]byte
+	for _, name := range slices.Sorted(maps.Keys(e.attachments)) {
+		attachments = append(attachments, [][]byte{[]byte(name), bytes.Clone(e.attachments[name].metadata)})
+	}
+	return attachments, nil
+}
+
+func (t memoryTx) PutAttachment(entry, name, metadata []byte, write func(io.Writer) error) error {
+	e, err := t.entry(entry)
+	if err != nil {
+		return err
+	}
+	if _, ok := e.attachments[string(name)]; ok {
+		return fmt.Errorf("attachment \"%s\" %w", name, ErrExists)
+	}
+	var data bytes.Buffer
+	if err = write(&data); err != nil {
+		return err
+	}
+	if e.attachments == nil {
+		e.attachments = map[string]memoryAttachment{}
+	}
+	e.attachments[string(name)] = memoryAttachment{metadata: bytes.Clone(metadata), data: data.Bytes()}
+	return nil
+}
+
+func (t memoryTx) GetAttachment(entry, name []byte, read func(io.Reader) error) error {
+	e, ok := t.d.entries[string(entry)]
+	if !ok {
+		return fmt.Errorf("attachment \"%s\" %w", name, ErrNotFound)
+	}
+	a, ok := e.attachments[string(name)]
+	if !ok {
+		return fmt.Errorf("attachment \"%s\" %w", name, ErrNotFound)
+	}
+	return read(bytes.NewReader(a.data))
+}
+
+func (t memoryTx) RemoveAttachment(entry, name []byte) error {
+	e, ok := t.d.entries[string(entry)]
+	if !ok {
+		return fmt.Errorf("attachment \"%s\" %w", name, ErrNotFound)
+	}
+	if _, ok = e.attachments[string(name)]; !ok {
+		return fmt.Errorf("attachment \"%s\" %w", name, ErrNotFound)
+	}
+	delete(e.attachments, string(name))
+	return nil
+}
+
+func (t memoryTx) AppendLog(seal func(seq uint64, last []byte) ([]byte, []byte, error)) error {
+	t.d.logSeq++
+	var last []byte
+	if len(t.d.log) > 0 {
+		last = bytes.Clone(t.d.log[len(t.d.log)-1].Data)
+	}
+	data, head, err := seal(t.d.logSeq, last)
+	if err != nil {
+		return err
+	}
+	t.d.log = append(t.d.log, LogRecord{Seq: t.d.logSeq, Data: bytes.Clone(data)})
+	t.d.header["auditHead"] = bytes.Clone(head)
+	return nil
+}
+
+func (t memoryTx) GetLog() ([]LogRecord, []byte, error) {
+	records := make([]LogRecord, len(t.d.log))
+	for i, r := range t.d.log {
+		records[i] = LogRecord{Seq: r.Seq, Data: bytes.Clone(r.Data)}
+	}
+	return records, bytes.Clone(t.d.header["auditHead"]), nil
+}
+
+// Update runs fn within the update already under way.
+func (t memoryTx) Update(fn func(VaultStore) error) error {
+	return fn(t)
+}
+
+func (t memoryTx) Close() error {
+	return errors.New("the vault cannot be closed inside a transaction")
+}
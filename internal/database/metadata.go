@@ -0,0 +1,186 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+)
+
+// EntryMetadata and FieldMetadata are stored encrypted in the "Metadata"
+// bucket, next to the values they describe.
+type EntryMetadata struct {
+	Created  time.Time `json:"created"`
+	Modified time.Time `json:"modified"`
+	Type     string    `json:"type,omitempty"`
+	Folder   string    `json:"folder,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+}
+
+type FieldMetadata struct {
+	Created   time.Time `json:"created"`
+	Modified  time.Time `json:"modified"`
+	ChangedBy string    `json:"changedBy,omitempty"`
+	Note      string    `json:"note,omitempty"`
+}
+
+func NewEntryMetadata() EntryMetadata {
+	now := time.Now()
+	return EntryMetadata{Created: now, Modified: now}
+}
+
+func NewFieldMetadata(changedBy, note string) FieldMetadata {
+	now := time.Now()
+	return FieldMetadata{Created: now, Modified: now, ChangedBy: changedBy, Note: note}
+}
+
+func (m EntryMetadata) HasTag(tag string) bool {
+	return slices.ContainsFunc(m.Tags, func(t string) bool {
+		return strings.EqualFold(t, tag)
+	})
+}
+
+// SplitEntryPath splits a path like "work/aws/prod" into its folder
+// "work/aws" and entry name "prod". Entries are stored under their name
+// alone, the folder is only kept in their encrypted metadata, so the name
+// must be unique in the whole vault, see NameTaken.
+func SplitEntryPath(path string) (string, string) {
+	path = strings.Trim(path, "/")
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return "", path
+	}
+	return CleanFolder(path[:i]), path[i+1:]
+}
+
+// NameTaken explains why an entry cannot be created or renamed as name in
+// folder: another entry already has the name. As names are unique across
+// folders, "work/aws/prod" cannot be added next to "personal/aws/prod"; the
+// error names the folder of the entry in the way. It wraps ErrExists.
+func NameTaken(store VaultStore, cipherKey32 []byte, folder, name string) error {
+	data, err := store.GetEntryMetadata([]byte(name))
+	if err != nil {
+		return fmt.Errorf("entry \"%s\" %w", name, ErrExists)
+	}
+	var metadata EntryMetadata
+	if data != nil {
+		metadata, err = OpenEntryMetadata(cipherKey32, data)
+	}
+	if err != nil || metadata.Folder == folder {
+		return fmt.Errorf("entry \"%s\" %w", JoinEntryPath(folder, name), ErrExists)
+	}
+	if metadata.Folder == "" {
+		return fmt.Errorf("entry \"%s\" %w outside any folder, entry names are unique across folders", name, ErrExists)
+	}
+	return fmt.Errorf("entry \"%s\" %w in folder \"%s\", entry names are unique across folders", name, ErrExists, metadata.Folder)
+}
+
+func JoinEntryPath(folder, entry string) string {
+	if folder == "" {
+		return entry
+	}
+	return folder + "/" + entry
+}
+
+// CleanFolder normalises a folder path, dropping empty segments and
+// surrounding whitespace.
+func CleanFolder(folder string) string {
+	var segments []string
+	for _, segment := range strings.Split(folder, "/") {
+		if segment = strings.TrimSpace(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// ParseTags splits a comma separated list of tags, ignoring duplicates.
+func ParseTags(tags string) []string {
+	var parsed []string
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !slices.ContainsFunc(parsed, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			parsed = append(parsed, tag)
+		}
+	}
+	return parsed
+}
+
+// Touch returns a copy of m marking a new change while keeping the creation time.
+func (m FieldMetadata) Touch(changedBy, note string) FieldMetadata {
+	if m.Created.IsZero() {
+		return NewFieldMetadata(changedBy, note)
+	}
+	m.Modified = time.Now()
+	m.ChangedBy = changedBy
+	m.Note = note
+	return m
+}
+
+func (m EntryMetadata) Seal(cipherKey32 []byte) ([]byte, error) {
+	return seal(cipherKey32, m)
+}
+
+func (m FieldMetadata) Seal(cipherKey32 []byte) ([]byte, error) {
+	return seal(cipherKey32, m)
+}
+
+// OpenEntryMetadata decrypts entry metadata. Entries created before metadata
+// was recorded have none, which yields the zero value.
+func OpenEntryMetadata(cipherKey32, data []byte) (EntryMetadata, error) {
+	var m EntryMetadata
+	err := open(cipherKey32, data, &m)
+	return m, err
+}
+
+func OpenFieldMetadata(cipherKey32, data []byte) (FieldMetadata, error) {
+	var m FieldMetadata
+	err := open(cipherKey32, data, &m)
+	return m, err
+}
+
+// UpdateEntryMetadata decrypts the metadata of an entry, applies update to it
+// and stores the result. Entries without metadata start from a fresh record.
+func UpdateEntryMetadata(store VaultStore, cipherKey32, entry []byte, update func(*EntryMetadata)) error {
+	return store.Update(func(store VaultStore) error {
+		data, err := store.GetEntryMetadata(entry)
+		if err != nil {
+			return err
+		}
+		metadata, err := OpenEntryMetadata(cipherKey32, data)
+		if err != nil {
+			return err
+		}
+		if metadata.Created.IsZero() {
+			metadata = NewEntryMetadata()
+		}
+		update(&metadata)
+		sealed, err := metadata.Seal(cipherKey32)
+		if err != nil {
+			return err
+		}
+		return store.SetEntryMetadata(entry, sealed)
+	})
+}
+
+func seal(cipherKey32 []byte, v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.EncryptAESGCM(cipherKey32, data)
+}
+
+func open(cipherKey32, data []byte, v any) error {
+	if data == nil {
+		return nil
+	}
+	plain, err := cipher.DecryptAESGCM(cipherKey32, data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(plain, v)
+}
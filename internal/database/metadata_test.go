@@ -0,0 +1,58 @@
+package database
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitEntryPath(t *testing.T) {
+	tests := []struct {
+		path, folder, entry string
+	}{
+		{"github", "", "github"},
+		{"work/aws/prod", "work/aws", "prod"},
+		{"/work//aws/ prod", "work/aws", " prod"},
+		{"work/", "", "work"},
+	}
+	for _, test := range tests {
+		folder, entry := SplitEntryPath(test.path)
+		if folder != test.folder || entry != test.entry {
+			t.Errorf("SplitEntryPath(%q) = %q, %q; want %q, %q", test.path, folder, entry, test.folder, test.entry)
+		}
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags := ParseTags(" prod, AWS,,aws , team-a")
+	if want := []string{"prod", "AWS", "team-a"}; !slices.Equal(tags, want) {
+		t.Errorf("ParseTags = %q, want %q", tags, want)
+	}
+	if !(EntryMetadata{Tags: tags}).HasTag("aws") {
+		t.Error("HasTag is not case insensitive")
+	}
+}
+
+func TestNameTaken(t *testing.T) {
+	store := NewMemoryStore()
+	cipherKey32 := make([]byte, 32)
+	metadata := NewEntryMetadata()
+	metadata.Folder = "personal/aws"
+	sealed, err := metadata.Seal(cipherKey32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.CreateEntry([]byte("prod"), sealed); err != nil {
+		t.Fatal(err)
+	}
+
+	err = NameTaken(store, cipherKey32, "work/aws", "prod")
+	if !errors.Is(err, ErrExists) || !strings.Contains(err.Error(), `in folder "personal/aws"`) {
+		t.Fatalf("NameTaken in another folder = %v", err)
+	}
+	err = NameTaken(store, cipherKey32, "personal/aws", "prod")
+	if !errors.Is(err, ErrExists) || err.Error() != `entry "personal/aws/prod" already exists` {
+		t.Fatalf("NameTaken in the same folder = %v", err)
+	}
+}
@@ -0,0 +1,341 @@
+package database
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Rekey encrypts everything in the vault again under newKey: the values,
+// metadata, history, trash, attachments and quarantine, and the password
+// check and audit log key in the header. The headers and member records
+// given are set in the same transaction, nil values being deleted, so that
+// the wrapped copies of the new key are written together with the data they
+// open. A header given replaces the old one instead of being rekeyed.
+// Either everything is rekeyed or nothing is.
+//
+// When reseal is not nil, the audit log is sealed again with it. It is given
+// the records and head of the log as stored and returns them as they are to
+// be stored instead, with the same sequence numbers.
+func Rekey(db *bolt.DB, oldKey, newKey []byte, headers, members map[string][]byte, reseal func([]LogRecord, []byte) ([]LogRecord, []byte, error)) error {
+	r := rekeyer{oldKey: oldKey, newKey: newKey}
+	return db.Update(func(tx *bolt.Tx) error {
+		header := tx.Bucket([]byte("Header"))
+		if header == nil {
+			return errors.New("header bucket not found")
+		}
+		// The key of the audit log is kept encrypted under the vault key
+		for _, name := range []string{"combinedTitle", "auditKey"} {
+			if _, ok := headers[name]; ok {
+				continue
+			}
+			if err := r.value(header, []byte(name)); err != nil {
+				return fmt.Errorf("header %s: %w", name, err)
+			}
+		}
+		for name, value := range headers {
+			var err error
+			if value == nil {
+				err = header.Delete([]byte(name))
+			} else {
+				err = header.Put([]byte(name), value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := putMembers(tx, members); err != nil {
+			return err
+		}
+
+		for _, name := range entryBuckets {
+			parent := tx.Bucket([]byte(name))
+			for _, entry := range bucketNames(parent) {
+				if err := r.entryBucket(name, parent.Bucket(entry)); err != nil {
+					return fmt.Errorf("%s of \"%s\": %w", name, entry, err)
+				}
+			}
+		}
+
+		trash := tx.Bucket([]byte("Trash"))
+		for _, id := range bucketNames(trash) {
+			if err := r.trashItem(trash.Bucket(id)); err != nil {
+				return fmt.Errorf("trash item %x: %w", id, err)
+			}
+		}
+		for _, id := range bucketNames(tx.Bucket([]byte("Quarantine"))) {
+			if err := r.quarantineItem(tx.Bucket([]byte("Quarantine")).Bucket(id)); err != nil {
+				return fmt.Errorf("quarantine item %x: %w", id, err)
+			}
+		}
+
+		if reseal == nil {
+			return nil
+		}
+		return resealLog(tx, reseal)
+	})
+}
+
+// resealLog replaces the records and head of the audit log with what reseal
+// returns for them.
+func resealLog(tx *bolt.Tx, reseal func([]LogRecord, []byte) ([]LogRecord, []byte, error)) error {
+	records, head, err := boltTx{tx}.GetLog()
+	if err != nil {
+		return err
+	}
+	if records, head, err = reseal(records, head); err != nil {
+		return err
+	}
+	b := tx.Bucket([]byte("AuditLog"))
+	for _, record := range records {
+		if err = b.Put(binary.BigEndian.AppendUint64(nil, record.Seq), record.Data); err != nil {
+			return err
+		}
+	}
+	if head == nil {
+		return nil
+	}
+	return tx.Bucket([]byte("Header")).Put([]byte("auditHead"), head)
+}
+
+// bucketNames returns the names of the buckets nested in b, so that they can
+// be changed without iterating b at the same time.
+func bucketNames(b *bolt.Bucket) [][]byte {
+	var names [][]byte
+	if b == nil {
+		return nil
+	}
+	b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			names = append(names, k)
+		}
+		return nil
+	})
+	return names
+}
+
+type rekeyer struct {
+	oldKey, newKey []byte
+	// dryRun only decrypts, to find out whether rekeying would succeed
+	// without changing anything.
+	dryRun bool
+}
+
+func (r rekeyer) reencrypt(data []byte) ([]byte, error) {
+	plain, err := cipher.DecryptAESGCM(r.oldKey, data)
+	if err != nil || r.dryRun {
+		return nil, err
+	}
+	return cipher.EncryptAESGCM(r.newKey, plain)
+}
+
+// value encrypts the value stored under k in b again, if there is one.
+func (r rekeyer) value(b *bolt.Bucket, k []byte) error {
+	data := b.Get(k)
+	if len(data) == 0 {
+		return nil
+	}
+	data, err := r.reencrypt(data)
+	if err != nil || r.dryRun {
+		return err
+	}
+	return b.Put(k, data)
+}
+
+// values encrypts every value of b again, leaving nested buckets alone.
+func (r rekeyer) values(b *bolt.Bucket) error {
+	if b == nil {
+		return nil
+	}
+	var keys [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		if v != nil {
+			keys = append(keys, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err = r.value(b, k); err != nil {
+			return fmt.Errorf("%s: %w", k, err)
+		}
+	}
+	return nil
+}
+
+// entryBucket rekeys the bucket an entry has in one of entryBuckets.
+func (r rekeyer) entryBucket(name string, b *bolt.Bucket) error {
+	if b == nil {
+		return nil
+	}
+	switch name {
+	case "Content":
+		return r.values(b)
+	case "Metadata":
+		if err := r.value(b, []byte("entry")); err != nil {
+			return err
+		}
+		return r.values(b.Bucket([]byte("fields")))
+	case "History":
+		for _, key := range bucketNames(b) {
+			if err := r.versions(b.Bucket(key)); err != nil {
+				return err
+			}
+		}
+	case "Attachments":
+		for _, attachment := range bucketNames(b) {
+			if err := r.attachment(b.Bucket(attachment)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// versions rekeys the history of one field.
+func (r rekeyer) versions(b *bolt.Bucket) error {
+	if b == nil {
+		return nil
+	}
+	var ids [][]byte
+	b.ForEach(func(k, _ []byte) error {
+		ids = append(ids, k)
+		return nil
+	})
+	for _, id := range ids {
+		if err := r.version(b, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// version rekeys the version stored under k in b.
+func (r rekeyer) version(b *bolt.Bucket, k []byte) error {
+	var version Version
+	if err := json.Unmarshal(b.Get(k), &version); err != nil {
+		return err
+	}
+	var err error
+	if version.Value, err = r.reencrypt(version.Value); err != nil {
+		return err
+	}
+	if len(version.Metadata) > 0 {
+		if version.Metadata, err = r.reencrypt(version.Metadata); err != nil {
+			return err
+		}
+	}
+	if r.dryRun {
+		return nil
+	}
+	data, err := json.Marshal(version)
+	if err != nil {
+		return err
+	}
+	return b.Put(k, data)
+}
+
+// attachment rekeys the metadata and content of an attachment. The content
+// is streamed into a new data bucket, which then replaces the old one.
+func (r rekeyer) attachment(a *bolt.Bucket) error {
+	if err := r.value(a, []byte("metadata")); err != nil {
+		return err
+	}
+	data := a.Bucket([]byte("data"))
+	if data == nil {
+		return nil
+	}
+	dec, err := cipher.NewStreamReader(r.oldKey, &pieceReader{c: data.Cursor()})
+	if err != nil {
+		return err
+	}
+	if r.dryRun {
+		_, err = io.Copy(io.Discard, dec)
+		return err
+	}
+	rekeyed, err := a.CreateBucket([]byte("rekey"))
+	if err != nil {
+		return err
+	}
+	w := &pieceWriter{b: rekeyed}
+	enc, err := cipher.NewStreamWriter(r.newKey, w)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(enc, dec); err != nil {
+		return err
+	}
+	if err = enc.Close(); err != nil {
+		return err
+	}
+	if err = w.flush(); err != nil {
+		return err
+	}
+	if err = a.DeleteBucket([]byte("data")); err != nil {
+		return err
+	}
+	if err = moveBucket(a, []byte("data"), rekeyed); err != nil {
+		return err
+	}
+	return a.DeleteBucket([]byte("rekey"))
+}
+
+// trashItem rekeys a deleted field, with its history, or a deleted entry.
+func (r rekeyer) trashItem(item *bolt.Bucket) error {
+	if item.Get([]byte("key")) != nil {
+		if err := r.value(item, []byte("value")); err != nil {
+			return err
+		}
+		if err := r.value(item, []byte("metadata")); err != nil {
+			return err
+		}
+		return r.versions(item.Bucket([]byte("History")))
+	}
+	for _, name := range entryBuckets {
+		if err := r.entryBucket(name, item.Bucket([]byte(name))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// quarantineItem rekeys what can still be decrypted of a quarantined item,
+// which is damaged by definition. Parts that cannot be decrypted under the
+// old key are left as they are, the new key cannot open them either.
+func (r rekeyer) quarantineItem(item *bolt.Bucket) error {
+	path := string(item.Get([]byte("path")))
+	data := item.Bucket([]byte("data"))
+	var parts []func(rekeyer) error
+	switch {
+	case strings.HasPrefix(path, "History/"):
+		parts = append(parts, func(r rekeyer) error { return r.version(item, []byte("value")) })
+	case strings.HasPrefix(path, "Attachments/") && data != nil:
+		parts = append(parts, func(r rekeyer) error { return r.attachment(data) })
+	case strings.HasPrefix(path, "Trash/") && data != nil:
+		parts = append(parts, func(r rekeyer) error { return r.trashItem(data) })
+	default:
+		parts = append(parts,
+			func(r rekeyer) error { return r.value(item, []byte("value")) },
+			func(r rekeyer) error { return r.value(item, []byte("metadata")) },
+		)
+	}
+	for _, part := range parts {
+		check := r
+		check.dryRun = true
+		if part(check) != nil {
+			continue
+		}
+		if err := part(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
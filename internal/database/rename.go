@@ -0,0 +1,109 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// RenameEntry gives an entry a new name. bbolt cannot rename buckets, so the
+// entry is copied under the new name and the old buckets are deleted within
+// the same transaction.
+func RenameEntry(db *bolt.DB, entry, newEntry []byte) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return boltTx{tx}.RenameEntry(entry, newEntry)
+	})
+}
+
+func (t boltTx) RenameEntry(entry, newEntry []byte) error {
+	if len(newEntry) == 0 {
+		return errors.New("entry name cannot be empty")
+	}
+	b := t.tx.Bucket([]byte("Content"))
+	if b == nil {
+		return errors.New("bucket \"content\" not found")
+	}
+	if b.Bucket(entry) == nil {
+		return errors.New("bucket \"" + string(entry) + "\" not found")
+	}
+	if b.Bucket(newEntry) != nil {
+		return fmt.Errorf("entry \"%s\" %w", newEntry, ErrExists)
+	}
+	for _, name := range entryBuckets {
+		parent := t.tx.Bucket([]byte(name))
+		src := parent.Bucket(entry)
+		if src == nil {
+			continue
+		}
+		if err := parent.DeleteBucket(newEntry); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+		if err := moveBucket(parent, newEntry, src); err != nil {
+			return err
+		}
+		if err := parent.DeleteBucket(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenameKey moves a field to a new key together with its metadata and history.
+func RenameKey(db *bolt.DB, entry, key, newKey []byte) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return boltTx{tx}.RenameKey(entry, key, newKey)
+	})
+}
+
+func (t boltTx) RenameKey(entry, key, newKey []byte) error {
+	if len(newKey) == 0 {
+		return errors.New("key cannot be empty")
+	}
+	b := t.tx.Bucket([]byte("Content"))
+	if b == nil {
+		return errors.New("bucket \"content\" not found")
+	}
+	b = b.Bucket(entry)
+	if b == nil {
+		return errors.New("bucket \"" + string(entry) + "\" not found")
+	}
+	value := b.Get(key)
+	if value == nil {
+		return errors.New("key \"" + string(key) + "\" not found")
+	}
+	if b.Get(newKey) != nil {
+		return fmt.Errorf("key \"%s\" %w", newKey, ErrExists)
+	}
+	if err := b.Put(newKey, value); err != nil {
+		return err
+	}
+	if err := b.Delete(key); err != nil {
+		return err
+	}
+
+	if m, _ := metadataBucket(t.tx, entry, false); m != nil {
+		fields := m.Bucket([]byte("fields"))
+		if metadata := fields.Get(key); metadata != nil {
+			if err := fields.Put(newKey, metadata); err != nil {
+				return err
+			}
+			if err := fields.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	// History left behind by an earlier field with the new key would
+	// otherwise be attributed to the renamed one.
+	if err := deleteHistory(t.tx, entry, newKey); err != nil {
+		return err
+	}
+	if h := historyBucket(t.tx, entry, key); h != nil {
+		parent := t.tx.Bucket([]byte("History")).Bucket(entry)
+		if err := moveBucket(parent, newKey, h); err != nil {
+			return err
+		}
+	}
+	return deleteHistory(t.tx, entry, key)
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNewerSchema is returned for a vault written by a newer version of
+// SentryVault, which this version cannot read safely.
+var ErrNewerSchema = errors.New("written by a newer version of SentryVault")
+
+// Upgrade is what migrations need from the caller of Migrate: the key of
+// the unlocked vault, and how the packages above this one start what they
+// keep in a vault. The functions are called inside the transaction of
+// Migrate with a store of it, a nil one is skipped.
+type Upgrade struct {
+	CipherKey32 []byte
+	// StartUnlockState gives the vault a record of failed unlocks when it
+	// has none.
+	StartUnlockState func(store VaultStore) error
+	// StartLog gives the vault an audit log when it has none.
+	StartLog func(store VaultStore) error
+	// AddDecoy gives the vault a decoy file when it has none.
+	AddDecoy func() error
+}
+
+// migration upgrades a vault from the version before it to version.
+type migration struct {
+	version uint64
+	name    string
+	migrate func(tx *bolt.Tx, up Upgrade) error
+}
+
+// LogVersion is the schema version from which every vault has an audit log:
+// Init starts it for new vaults and the migration to it for older ones.
+const LogVersion = 4
+
+// migrations are run in order by Migrate. Their versions count up from 1
+// without gaps. A change to the vault format adds one at the end, which
+// raises SchemaVersion.
+var migrations = []migration{
+	{
+		// Vaults made before the schema was versioned only lack the header
+		version: 1,
+		name:    "record the schema version",
+		migrate: func(*bolt.Tx, Upgrade) error { return nil },
+	},
+	{
+		version: 2,
+		name:    "add the buckets of metadata, history, trash, attachments, members and the audit log",
+		migrate: func(tx *bolt.Tx, _ Upgrade) error { return addBuckets(tx) },
+	},
+	{
+		version: 3,
+		name:    "record failed unlocks",
+		migrate: func(tx *bolt.Tx, up Upgrade) error {
+			return callStore(tx, up.StartUnlockState)
+		},
+	},
+	{
+		version: LogVersion,
+		name:    "start the audit log",
+		migrate: func(tx *bolt.Tx, up Upgrade) error {
+			return callStore(tx, up.StartLog)
+		},
+	},
+	{
+		version: 5,
+		name:    "add a decoy",
+		migrate: func(_ *bolt.Tx, up Upgrade) error {
+			if up.AddDecoy == nil {
+				return nil
+			}
+			return up.AddDecoy()
+		},
+	},
+}
+
+// callStore calls start, when given, with a store of tx.
+func callStore(tx *bolt.Tx, start func(VaultStore) error) error {
+	if start == nil {
+		return nil
+	}
+	return start(boltTx{tx})
+}
+
+// SchemaVersion returns the version of the vault format this version of
+// SentryVault writes, that of its last migration.
+func SchemaVersion() uint64 {
+	return migrations[len(migrations)-1].version
+}
+
+// GetSchemaVersion returns the schema version of a vault, 0 for one written
+// before versions were recorded.
+func GetSchemaVersion(store VaultStore) (uint64, error) {
+	value, err := store.GetHeader("schemaVersion")
+	if err != nil {
+		return 0, err
+	}
+	return parseSchemaVersion(value)
+}
+
+// SetSchemaVersion records the schema version of a vault. New vaults are
+// given SchemaVersion, older ones are upgraded by Migrate.
+func SetSchemaVersion(store VaultStore, version uint64) error {
+	return SetHeader(store, "schemaVersion", binary.BigEndian.AppendUint64(nil, version))
+}
+
+// PendingMigrations returns how many migrations a vault needs. It fails
+// with ErrNewerSchema for a vault written by a newer version.
+func PendingMigrations(store VaultStore) (int, error) {
+	version, err := GetSchemaVersion(store)
+	if err != nil {
+		return 0, err
+	}
+	if err = checkSchema(version); err != nil {
+		return 0, err
+	}
+	return int(SchemaVersion() - version), nil
+}
+
+// Migrate runs the migrations a vault needs in one transaction, so a
+// failing one leaves the vault as it was, save for files outside it such as
+// the decoy. It returns the names of the migrations run.
+func Migrate(db *bolt.DB, up Upgrade) ([]string, error) {
+	var names []string
+	err := db.Update(func(tx *bolt.Tx) error {
+		version, err := schemaVersion(tx)
+		if err != nil {
+			return err
+		}
+		if err = checkSchema(version); err != nil {
+			return err
+		}
+		for _, m := range migrations[version:] {
+			if err = m.migrate(tx, up); err != nil {
+				return fmt.Errorf("error migrating to schema version %d, %s: %w", m.version, m.name, err)
+			}
+			names = append(names, m.name)
+		}
+		return setSchemaVersion(tx, SchemaVersion())
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+func checkSchema(version uint64) error {
+	if version > SchemaVersion() {
+		return fmt.Errorf("vault %w, it has schema version %d and this version reads up to %d, update SentryVault to open it", ErrNewerSchema, version, SchemaVersion())
+	}
+	return nil
+}
+
+func schemaVersion(tx *bolt.Tx) (uint64, error) {
+	b := tx.Bucket([]byte("Header"))
+	if b == nil {
+		return 0, errors.New("header bucket not found")
+	}
+	return parseSchemaVersion(b.Get([]byte("schemaVersion")))
+}
+
+func parseSchemaVersion(value []byte) (uint64, error) {
+	if value == nil {
+		return 0, nil
+	}
+	if len(value) != 8 {
+		return 0, errors.New("invalid schema version")
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+func setSchemaVersion(tx *bolt.Tx, version uint64) error {
+	b := tx.Bucket([]byte("Header"))
+	if b == nil {
+		return errors.New("header bucket not found")
+	}
+	return b.Put([]byte("schemaVersion"), binary.BigEndian.AppendUint64(nil, version))
+}
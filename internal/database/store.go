@@ -1,7 +1,9 @@
 package database
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -26,10 +28,56 @@ func GetDBFiles() ([]string, error) {
 	}
 	for _, file := range dir {
 		fileName := file.Name()
-		if !file.IsDir() && strings.HasSuffix(fileName, ".db") {
+		// Dot files are the decoys of the vaults, see DecoyPath
+		if !file.IsDir() && strings.HasSuffix(fileName, ".db") && !strings.HasPrefix(fileName, ".") {
 			files = append(files, fileName)
 		}
 	}
 
 	return files, nil
 }
+
+// DBPath returns the path of the database file of a vault.
+func DBPath(username string) (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to find user config directory: %w", err)
+	}
+	return filepath.Join(configDir, "SentryVault", "users", username+".db"), nil
+}
+
+// DecoyPath returns the path of the companion file of a vault, holding the
+// decoy dataset opened by its duress password. Vault names cannot start
+// with a dot, so it never clashes with a vault.
+func DecoyPath(username string) (string, error) {
+	path, err := DBPath(username)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)), nil
+}
+
+// DeleteDecoy removes the decoy file of a vault, if it has one.
+func DeleteDecoy(username string) error {
+	path, err := DecoyPath(username)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// DeleteDB removes the database file of a vault and its decoy. The vault
+// must be closed.
+func DeleteDB(username string) error {
+	path, err := DBPath(username)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil {
+		return err
+	}
+	return DeleteDecoy(username)
+}
@@ -0,0 +1,255 @@
+package database
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+// entryBuckets are the top-level buckets holding one nested bucket per entry.
+// Whatever happens to an entry as a whole has to happen in all of them.
+var entryBuckets = []string{"Content", "Metadata", "History", "Attachments"}
+
+type TrashItem struct {
+	ID      uint64
+	Entry   string
+	Key     string
+	Deleted time.Time
+}
+
+// IsEntry reports whether the item is a whole entry rather than a single field.
+func (t TrashItem) IsEntry() bool {
+	return t.Key == ""
+}
+
+func GetTrash(db *bolt.DB) ([]TrashItem, error) {
+	return view(db, boltTx.GetTrash)
+}
+
+func (t boltTx) GetTrash() ([]TrashItem, error) {
+	b := t.tx.Bucket([]byte("Trash"))
+	if b == nil {
+		return nil, errors.New("bucket \"trash\" not found")
+	}
+	var items []TrashItem
+	c := b.Cursor()
+	for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+		items = append(items, trashItem(k, b.Bucket(k)))
+	}
+	return items, nil
+}
+
+func RestoreTrash(db *bolt.DB, id uint64) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return boltTx{tx}.RestoreTrash(id)
+	})
+}
+
+func (t boltTx) RestoreTrash(id uint64) error {
+	trash := t.tx.Bucket([]byte("Trash"))
+	if trash == nil {
+		return errors.New("bucket \"trash\" not found")
+	}
+	k := binary.BigEndian.AppendUint64(nil, id)
+	item := trash.Bucket(k)
+	if item == nil {
+		return errors.New("item not found in trash")
+	}
+	entry := item.Get([]byte("entry"))
+	content := t.tx.Bucket([]byte("Content"))
+
+	if key := item.Get([]byte("key")); key != nil {
+		// A field cannot go back into an entry that is itself in the trash
+		b := content.Bucket(entry)
+		if b == nil {
+			return errors.New("entry \"" + string(entry) + "\" no longer exists, restore it first")
+		}
+		if b.Get(key) != nil {
+			return errors.New("key \"" + string(key) + "\" already exists in \"" + string(entry) + "\"")
+		}
+		if err := b.Put(key, item.Get([]byte("value"))); err != nil {
+			return err
+		}
+		if metadata := item.Get([]byte("metadata")); metadata != nil {
+			m, err := metadataBucket(t.tx, entry, true)
+			if err != nil {
+				return err
+			}
+			if err = m.Bucket([]byte("fields")).Put(key, metadata); err != nil {
+				return err
+			}
+		}
+		if h := item.Bucket([]byte("History")); h != nil {
+			dst, err := t.tx.Bucket([]byte("History")).CreateBucketIfNotExists(entry)
+			if err != nil {
+				return err
+			}
+			if err = moveBucket(dst, key, h); err != nil {
+				return err
+			}
+		}
+	} else {
+		if content.Bucket(entry) != nil {
+			return errors.New("entry \"" + string(entry) + "\" already exists")
+		}
+		for _, name := range entryBuckets {
+			src := item.Bucket([]byte(name))
+			if src == nil {
+				continue
+			}
+			if err := moveBucket(t.tx.Bucket([]byte(name)), entry, src); err != nil {
+				return err
+			}
+		}
+	}
+	return trash.DeleteBucket(k)
+}
+
+func PurgeTrash(db *bolt.DB, id uint64) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return boltTx{tx}.PurgeTrash(id)
+	})
+}
+
+func (t boltTx) PurgeTrash(id uint64) error {
+	b := t.tx.Bucket([]byte("Trash"))
+	if b == nil {
+		return errors.New("bucket \"trash\" not found")
+	}
+	return b.DeleteBucket(binary.BigEndian.AppendUint64(nil, id))
+}
+
+// PurgeExpiredTrash permanently deletes items that have been in the trash for
+// longer than the vault's retention period and returns how many were removed.
+func PurgeExpiredTrash(db *bolt.DB) (int, error) {
+	return update(db, boltTx.PurgeExpiredTrash)
+}
+
+func (t boltTx) PurgeExpiredTrash() (int, error) {
+	retention, err := trashRetention(t.tx)
+	if err != nil || retention == 0 {
+		return 0, err
+	}
+	b := t.tx.Bucket([]byte("Trash"))
+	if b == nil {
+		return 0, errors.New("bucket \"trash\" not found")
+	}
+	var expired [][]byte
+	cutoff := time.Now().Add(-retention)
+	c := b.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if trashItem(k, b.Bucket(k)).Deleted.Before(cutoff) {
+			expired = append(expired, k)
+		}
+	}
+	for _, k := range expired {
+		if err = b.DeleteBucket(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+func GetTrashRetention(store VaultStore) (time.Duration, error) {
+	value, err := store.GetHeader("trashRetention")
+	if err != nil {
+		return 0, err
+	}
+	return parseTrashRetention(value)
+}
+
+// SetTrashRetention configures how long deleted items are kept. A retention
+// of zero keeps them until they are purged by hand.
+func SetTrashRetention(store VaultStore, retention time.Duration) error {
+	if retention < 0 {
+		return errors.New("trash retention cannot be negative")
+	}
+	return store.PutHeaders(map[string][]byte{
+		"trashRetention": binary.BigEndian.AppendUint64(nil, uint64(retention)),
+	})
+}
+
+func trashRetention(tx *bolt.Tx) (time.Duration, error) {
+	b := tx.Bucket([]byte("Header"))
+	if b == nil {
+		return 0, errors.New("header bucket not found")
+	}
+	return parseTrashRetention(b.Get([]byte("trashRetention")))
+}
+
+func parseTrashRetention(value []byte) (time.Duration, error) {
+	if value == nil {
+		return DefaultTrashRetention, nil
+	}
+	if len(value) != 8 {
+		return 0, errors.New("invalid trash retention")
+	}
+	return time.Duration(binary.BigEndian.Uint64(value)), nil
+}
+
+func trashItem(k []byte, b *bolt.Bucket) TrashItem {
+	item := TrashItem{
+		ID:    binary.BigEndian.Uint64(k),
+		Entry: string(b.Get([]byte("entry"))),
+		Key:   string(b.Get([]byte("key"))),
+	}
+	if deleted := b.Get([]byte("deleted")); len(deleted) == 8 {
+		item.Deleted = time.Unix(0, int64(binary.BigEndian.Uint64(deleted)))
+	}
+	return item
+}
+
+// newTrashItem creates the bucket a deleted entry or field is moved into.
+func newTrashItem(tx *bolt.Tx, entry, key []byte) (uint64, *bolt.Bucket, error) {
+	trash := tx.Bucket([]byte("Trash"))
+	if trash == nil {
+		return 0, nil, errors.New("bucket \"trash\" not found")
+	}
+	id, err := trash.NextSequence()
+	if err != nil {
+		return 0, nil, err
+	}
+	item, err := trash.CreateBucket(binary.BigEndian.AppendUint64(nil, id))
+	if err != nil {
+		return 0, nil, err
+	}
+	if err = item.Put([]byte("entry"), entry); err != nil {
+		return 0, nil, err
+	}
+	if key != nil {
+		if err = item.Put([]byte("key"), key); err != nil {
+			return 0, nil, err
+		}
+	}
+	deleted := binary.BigEndian.AppendUint64(nil, uint64(time.Now().UnixNano()))
+	if err = item.Put([]byte("deleted"), deleted); err != nil {
+		return 0, nil, err
+	}
+	return id, item, nil
+}
+
+// moveBucket copies src into a new bucket called name inside dst. The caller
+// deletes src afterwards, bbolt has no way of moving buckets.
+func moveBucket(dst *bolt.Bucket, name []byte, src *bolt.Bucket) error {
+	b, err := dst.CreateBucket(name)
+	if err != nil {
+		return err
+	}
+	return copyBucket(b, src)
+}
+
+func copyBucket(dst, src *bolt.Bucket) error {
+	if err := dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+	return src.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return dst.Put(k, v)
+		}
+		return moveBucket(dst, k, src.Bucket(k))
+	})
+}
@@ -0,0 +1,287 @@
+package database
+
+import (
+	"errors"
+	"io"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// VaultStore keeps the contents of an unlocked vault: its header, members,
+// entries, fields with their history, the trash, attachments and the audit
+// log.
+// Values are the ciphertexts written, a store never sees the vault key.
+// BoltStore keeps a vault in its file and MemoryStore in memory.
+type VaultStore interface {
+	// GetHeader returns a value of the header, nil when it is not set.
+	GetHeader(name string) ([]byte, error)
+	// PutHeaders sets several values of the header, deleting nil ones.
+	PutHeaders(values map[string][]byte) error
+
+	// GetMembers returns the name and record of every member of a shared
+	// vault, ordered by name.
+	GetMembers() ([][][]byte, error)
+	// GetMember returns the record of a member, nil when there is no such
+	// member.
+	GetMember(name []byte) ([]byte, error)
+	AddMember(name, record []byte) error
+	// DeleteMembers removes every member record.
+	DeleteMembers() error
+
+	CreateEntry(entry, metadata []byte) error
+	// RemoveEntry moves an entry into the trash and returns the ID of the
+	// trash item.
+	RemoveEntry(entry []byte) (uint64, error)
+	RenameEntry(entry, newEntry []byte) error
+	// GetEntriesMetadata returns every entry name, in order, paired with
+	// its metadata.
+	GetEntriesMetadata() ([][][]byte, error)
+	GetEntryMetadata(entry []byte) ([]byte, error)
+	SetEntryMetadata(entry, metadata []byte) error
+
+	// Insert sets a field, archiving the value it replaces in its history.
+	Insert(entry, key, value, metadata []byte) error
+	// Retrieve returns the value and metadata of a field, failing with
+	// ErrNotFound when the entry has no such key.
+	Retrieve(entry, key []byte) ([]byte, []byte, error)
+	// RetrieveAll returns the key, value and metadata of every field of an
+	// entry, ordered by key.
+	RetrieveAll(entry []byte) ([][][]byte, error)
+	// Remove moves a field into the trash and returns the ID of the trash
+	// item.
+	Remove(entry, key []byte) (uint64, error)
+	RenameKey(entry, key, newKey []byte) error
+	// GetHistory returns the previous versions of a field, newest first.
+	GetHistory(entry, key []byte) ([]Version, error)
+
+	// GetTrash returns the items in the trash, newest first.
+	GetTrash() ([]TrashItem, error)
+	RestoreTrash(id uint64) error
+	PurgeTrash(id uint64) error
+	PurgeExpiredTrash() (int, error)
+
+	GetAttachments(entry []byte) ([][][]byte, error)
+	PutAttachment(entry, name, metadata []byte, write func(io.Writer) error) error
+	GetAttachment(entry, name []byte, read func(io.Reader) error) error
+	RemoveAttachment(entry, name []byte) error
+
+	AppendLog(seal func(seq uint64, last []byte) ([]byte, []byte, error)) error
+	GetLog() ([]LogRecord, []byte, error)
+
+	// Update calls fn with a store in one transaction. Its changes are all
+	// kept when fn returns nil and all discarded otherwise.
+	Update(fn func(VaultStore) error) error
+	Close() error
+}
+
+// FileStore is a VaultStore kept in a file, which is also looked after as a
+// whole: checked, compacted, backed up and encrypted again under a new key.
+// BoltStore is one.
+type FileStore interface {
+	VaultStore
+	// Check authenticates everything in the file, see Check.
+	Check(cipherKey32 []byte, repair bool) (CheckReport, error)
+	QuarantineCount() (int, error)
+	// FreeRatio returns the share of the file taken by free pages.
+	FreeRatio() (float64, error)
+	// Compact rewrites the file without free pages and closes the store,
+	// see Compact.
+	Compact() (CompactResult, error)
+	// Backup copies the file into the backups of the vault, see Backup.
+	Backup(username string, retention int) (string, error)
+	// Rekey encrypts everything again under newKey, see Rekey.
+	Rekey(oldKey, newKey []byte, headers, members map[string][]byte, reseal func([]LogRecord, []byte) ([]LogRecord, []byte, error)) error
+}
+
+// BoltStore is the VaultStore of a vault file.
+type BoltStore struct {
+	db *bolt.DB
+}
+
+func NewBoltStore(db *bolt.DB) *BoltStore {
+	return &BoltStore{db: db}
+}
+
+func (s *BoltStore) GetHeader(name string) ([]byte, error) {
+	return GetHeader(s.db, name)
+}
+
+func (s *BoltStore) PutHeaders(values map[string][]byte) error {
+	return PutHeaders(s.db, values)
+}
+
+func (s *BoltStore) GetMembers() ([][][]byte, error) {
+	return GetMembers(s.db)
+}
+
+func (s *BoltStore) GetMember(name []byte) ([]byte, error) {
+	return GetMember(s.db, name)
+}
+
+func (s *BoltStore) AddMember(name, record []byte) error {
+	return AddMember(s.db, name, record)
+}
+
+func (s *BoltStore) DeleteMembers() error {
+	return DeleteMembers(s.db)
+}
+
+func (s *BoltStore) CreateEntry(entry, metadata []byte) error {
+	return CreateEntry(s.db, entry, metadata)
+}
+
+func (s *BoltStore) RemoveEntry(entry []byte) (uint64, error) {
+	return RemoveEntry(s.db, entry)
+}
+
+func (s *BoltStore) RenameEntry(entry, newEntry []byte) error {
+	return RenameEntry(s.db, entry, newEntry)
+}
+
+func (s *BoltStore) GetEntriesMetadata() ([][][]byte, error) {
+	return GetEntriesMetadata(s.db)
+}
+
+func (s *BoltStore) GetEntryMetadata(entry []byte) ([]byte, error) {
+	return GetEntryMetadata(s.db, entry)
+}
+
+func (s *BoltStore) SetEntryMetadata(entry, metadata []byte) error {
+	return SetEntryMetadata(s.db, entry, metadata)
+}
+
+func (s *BoltStore) Insert(entry, key, value, metadata []byte) error {
+	return Insert(s.db, entry, key, value, metadata)
+}
+
+func (s *BoltStore) Retrieve(entry, key []byte) ([]byte, []byte, error) {
+	return Retrieve(s.db, entry, key)
+}
+
+func (s *BoltStore) RetrieveAll(entry []byte) ([][][]byte, error) {
+	return RetrieveAll(s.db, entry)
+}
+
+func (s *BoltStore) Remove(entry, key []byte) (uint64, error) {
+	return Remove(s.db, entry, key)
+}
+
+func (s *BoltStore) RenameKey(entry, key, newKey []byte) error {
+	return RenameKey(s.db, entry, key, newKey)
+}
+
+func (s *BoltStore) GetHistory(entry, key []byte) ([]Version, error) {
+	return GetHistory(s.db, entry, key)
+}
+
+func (s *BoltStore) GetTrash() ([]TrashItem, error) {
+	return GetTrash(s.db)
+}
+
+func (s *BoltStore) RestoreTrash(id uint64) error {
+	return RestoreTrash(s.db, id)
+}
+
+func (s *BoltStore) PurgeTrash(id uint64) error {
+	return PurgeTrash(s.db, id)
+}
+
+func (s *BoltStore) PurgeExpiredTrash() (int, error) {
+	return PurgeExpiredTrash(s.db)
+}
+
+func (s *BoltStore) GetAttachments(entry []byte) ([][][]byte, error) {
+	return GetAttachments(s.db, entry)
+}
+
+func (s *BoltStore) PutAttachment(entry, name, metadata []byte, write func(io.Writer) error) error {
+	return PutAttachment(s.db, entry, name, metadata, write)
+}
+
+func (s *BoltStore) GetAttachment(entry, name []byte, read func(io.Reader) error) error {
+	return GetAttachment(s.db, entry, name, read)
+}
+
+func (s *BoltStore) RemoveAttachment(entry, name []byte) error {
+	return RemoveAttachment(s.db, entry, name)
+}
+
+func (s *BoltStore) AppendLog(seal func(seq uint64, last []byte) ([]byte, []byte, error)) error {
+	return AppendLog(s.db, seal)
+}
+
+func (s *BoltStore) GetLog() ([]LogRecord, []byte, error) {
+	return GetLog(s.db)
+}
+
+func (s *BoltStore) Update(fn func(VaultStore) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) Check(cipherKey32 []byte, repair bool) (CheckReport, error) {
+	return Check(s.db, cipherKey32, repair)
+}
+
+func (s *BoltStore) QuarantineCount() (int, error) {
+	return QuarantineCount(s.db)
+}
+
+func (s *BoltStore) FreeRatio() (float64, error) {
+	return FreeRatio(s.db)
+}
+
+func (s *BoltStore) Compact() (CompactResult, error) {
+	return Compact(s.db)
+}
+
+func (s *BoltStore) Backup(username string, retention int) (string, error) {
+	return Backup(s.db, username, retention)
+}
+
+func (s *BoltStore) Rekey(oldKey, newKey []byte, headers, members map[string][]byte, reseal func([]LogRecord, []byte) ([]LogRecord, []byte, error)) error {
+	return Rekey(s.db, oldKey, newKey, headers, members, reseal)
+}
+
+// boltTx is the VaultStore of a transaction of a vault file, given out by
+// BoltStore.Update. The package functions taking a *bolt.DB run one of its
+// methods in a transaction of their own.
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+// Update runs fn within the transaction already open.
+func (t boltTx) Update(fn func(VaultStore) error) error {
+	return fn(t)
+}
+
+func (t boltTx) Close() error {
+	return errors.New("the vault cannot be closed inside a transaction")
+}
+
+// view returns what get reads in a read-only transaction of db.
+func view[T any](db *bolt.DB, get func(boltTx) (T, error)) (T, error) {
+	var v T
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		v, err = get(boltTx{tx})
+		return err
+	})
+	return v, err
+}
+
+// update returns the result of set run in a read-write transaction of db.
+func update[T any](db *bolt.DB, set func(boltTx) (T, error)) (T, error) {
+	var v T
+	err := db.Update(func(tx *bolt.Tx) error {
+		var err error
+		v, err = set(boltTx{tx})
+		return err
+	})
+	return v, err
+}
@@ -0,0 +1,215 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestBoltStore(t *testing.T) {
+	testVaultStore(t, NewBoltStore(openTestDB(t)))
+}
+
+func TestMemoryStore(t *testing.T) {
+	testVaultStore(t, NewMemoryStore())
+}
+
+// testVaultStore checks the behaviour every VaultStore shares.
+func testVaultStore(t *testing.T, store VaultStore) {
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	value := func(entry, key string) string {
+		t.Helper()
+		v, _, err := store.Retrieve([]byte(entry), []byte(key))
+		must(err)
+		return string(v)
+	}
+
+	must(store.PutHeaders(map[string][]byte{"salt": []byte("pepper"), "title": []byte("vault")}))
+	must(store.PutHeaders(map[string][]byte{"title": nil}))
+	if salt, err := store.GetHeader("salt"); err != nil || string(salt) != "pepper" {
+		t.Fatalf("GetHeader(salt) = %q, %v", salt, err)
+	}
+	if title, err := store.GetHeader("title"); err != nil || title != nil {
+		t.Fatalf("GetHeader of a deleted header = %q, %v", title, err)
+	}
+
+	must(store.AddMember([]byte("carol"), []byte("record c")))
+	must(store.AddMember([]byte("bob"), []byte("record b")))
+	if err := store.AddMember([]byte("bob"), nil); !errors.Is(err, ErrExists) {
+		t.Fatalf("AddMember of an existing member = %v, want ErrExists", err)
+	}
+	if members, err := store.GetMembers(); err != nil || len(members) != 2 || string(members[0][0]) != "bob" || string(members[1][1]) != "record c" {
+		t.Fatalf("GetMembers = %q, %v", members, err)
+	}
+	if record, err := store.GetMember([]byte("dave")); err != nil || record != nil {
+		t.Fatalf("GetMember of a missing member = %q, %v", record, err)
+	}
+	must(store.DeleteMembers())
+	if record, err := store.GetMember([]byte("bob")); err != nil || record != nil {
+		t.Fatalf("GetMember after DeleteMembers = %q, %v", record, err)
+	}
+
+	must(store.CreateEntry([]byte("github"), []byte("meta")))
+	must(store.CreateEntry([]byte("aws"), nil))
+	if err := store.CreateEntry([]byte("github"), nil); !errors.Is(err, ErrExists) {
+		t.Fatalf("CreateEntry of an existing entry = %v, want ErrExists", err)
+	}
+	pairs, err := store.GetEntriesMetadata()
+	must(err)
+	if len(pairs) != 2 || string(pairs[0][0]) != "aws" || string(pairs[1][0]) != "github" || string(pairs[1][1]) != "meta" {
+		t.Fatalf("GetEntriesMetadata = %q", pairs)
+	}
+	must(store.SetEntryMetadata([]byte("aws"), []byte("aws meta")))
+	if metadata, err := store.GetEntryMetadata([]byte("aws")); err != nil || string(metadata) != "aws meta" {
+		t.Fatalf("GetEntryMetadata = %q, %v", metadata, err)
+	}
+
+	// Overwritten values are kept in the history, newest first
+	must(store.Insert([]byte("github"), []byte("password"), []byte("v1"), []byte("m1")))
+	must(store.Insert([]byte("github"), []byte("password"), []byte("v2"), []byte("m2")))
+	must(store.Insert([]byte("github"), []byte("password"), []byte("v3"), []byte("m3")))
+	must(store.Insert([]byte("github"), []byte("user"), []byte("alice"), nil))
+	if v, metadata, err := store.Retrieve([]byte("github"), []byte("password")); err != nil || string(v) != "v3" || string(metadata) != "m3" {
+		t.Fatalf("Retrieve = %q, %q, %v", v, metadata, err)
+	}
+	if _, _, err = store.Retrieve([]byte("github"), []byte("token")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Retrieve of a missing key = %v, want ErrNotFound", err)
+	}
+	if exists, err := KeyExists(store, []byte("github"), []byte("user")); err != nil || !exists {
+		t.Fatalf("KeyExists = %v, %v", exists, err)
+	}
+	fields, err := store.RetrieveAll([]byte("github"))
+	must(err)
+	if len(fields) != 2 || string(fields[0][0]) != "password" || string(fields[1][0]) != "user" || string(fields[1][1]) != "alice" {
+		t.Fatalf("RetrieveAll = %q", fields)
+	}
+	versions, err := store.GetHistory([]byte("github"), []byte("password"))
+	must(err)
+	if len(versions) != 2 || string(versions[0].Value) != "v2" || string(versions[0].Metadata) != "m2" || versions[0].ID != 2 || string(versions[1].Value) != "v1" {
+		t.Fatalf("GetHistory = %+v", versions)
+	}
+
+	// Renamed and deleted fields take their history along
+	must(store.RenameKey([]byte("github"), []byte("password"), []byte("pass")))
+	if err = store.RenameKey([]byte("github"), []byte("pass"), []byte("user")); !errors.Is(err, ErrExists) {
+		t.Fatalf("RenameKey onto an existing key = %v, want ErrExists", err)
+	}
+	id, err := store.Remove([]byte("github"), []byte("pass"))
+	must(err)
+	if exists, _ := KeyExists(store, []byte("github"), []byte("pass")); exists {
+		t.Fatal("Remove left the field")
+	}
+	items, err := store.GetTrash()
+	must(err)
+	if len(items) != 1 || items[0].ID != id || items[0].Entry != "github" || items[0].Key != "pass" || items[0].IsEntry() || items[0].Deleted.IsZero() {
+		t.Fatalf("GetTrash = %+v", items)
+	}
+	must(store.RestoreTrash(id))
+	if v := value("github", "pass"); v != "v3" {
+		t.Fatalf("restored value = %q", v)
+	}
+	if versions, _ = store.GetHistory([]byte("github"), []byte("pass")); len(versions) != 2 {
+		t.Fatalf("restored history = %+v", versions)
+	}
+
+	// Whole entries go to the trash with their fields and attachments
+	must(store.PutAttachment([]byte("github"), []byte("key.pem"), []byte("pem meta"), func(w io.Writer) error {
+		_, err := w.Write(bytes.Repeat([]byte("x"), 3*attachmentPieceSize/2))
+		return err
+	}))
+	if err = store.PutAttachment([]byte("github"), []byte("key.pem"), nil, func(io.Writer) error { return nil }); !errors.Is(err, ErrExists) {
+		t.Fatalf("PutAttachment of an existing name = %v, want ErrExists", err)
+	}
+	must(store.RenameEntry([]byte("github"), []byte("work/github")))
+	fieldID, err := store.Remove([]byte("work/github"), []byte("pass"))
+	must(err)
+	id, err = store.RemoveEntry([]byte("work/github"))
+	must(err)
+	if pairs, _ = store.GetEntriesMetadata(); len(pairs) != 1 {
+		t.Fatalf("entries after RemoveEntry = %q", pairs)
+	}
+	if err = store.RestoreTrash(fieldID); err == nil {
+		t.Fatal("RestoreTrash of a field of a trashed entry succeeded")
+	}
+	must(store.RestoreTrash(id))
+	must(store.RestoreTrash(fieldID))
+	if v := value("work/github", "user"); v != "alice" {
+		t.Fatalf("field of the restored entry = %q", v)
+	}
+	attachments, err := store.GetAttachments([]byte("work/github"))
+	must(err)
+	if len(attachments) != 1 || string(attachments[0][0]) != "key.pem" || string(attachments[0][1]) != "pem meta" {
+		t.Fatalf("GetAttachments = %q", attachments)
+	}
+	must(store.GetAttachment([]byte("work/github"), []byte("key.pem"), func(r io.Reader) error {
+		data, err := io.ReadAll(r)
+		if len(data) != 3*attachmentPieceSize/2 {
+			t.Errorf("attachment has %d bytes", len(data))
+		}
+		return err
+	}))
+	must(store.RemoveAttachment([]byte("work/github"), []byte("key.pem")))
+	if err = store.RemoveAttachment([]byte("work/github"), []byte("key.pem")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("RemoveAttachment of a missing attachment = %v, want ErrNotFound", err)
+	}
+
+	id, err = store.Remove([]byte("work/github"), []byte("user"))
+	must(err)
+	must(store.PurgeTrash(id))
+	if items, _ = store.GetTrash(); len(items) != 0 {
+		t.Fatalf("trash after purging = %+v", items)
+	}
+	if purged, err := store.PurgeExpiredTrash(); err != nil || purged != 0 {
+		t.Fatalf("PurgeExpiredTrash = %d, %v", purged, err)
+	}
+
+	// The log hands the last record to the next one
+	var lasts []string
+	for _, data := range []string{"first", "second"} {
+		must(store.AppendLog(func(seq uint64, last []byte) ([]byte, []byte, error) {
+			lasts = append(lasts, string(last))
+			return []byte(data), []byte("head " + data), nil
+		}))
+	}
+	records, head, err := store.GetLog()
+	must(err)
+	if len(records) != 2 || records[0].Seq != 1 || string(records[1].Data) != "second" || string(head) != "head second" || !slices.Equal(lasts, []string{"", "first"}) {
+		t.Fatalf("GetLog = %+v, %q after %q", records, head, lasts)
+	}
+
+	// A failing update leaves no trace
+	err = store.Update(func(tx VaultStore) error {
+		if err := tx.Insert([]byte("aws"), []byte("key"), []byte("AKIA"), nil); err != nil {
+			return err
+		}
+		if _, err := tx.RemoveEntry([]byte("work/github")); err != nil {
+			return err
+		}
+		if exists, _ := KeyExists(tx, []byte("aws"), []byte("key")); !exists {
+			t.Error("an update does not see its own changes")
+		}
+		return errors.New("abort")
+	})
+	if err == nil || err.Error() != "abort" {
+		t.Fatalf("Update = %v", err)
+	}
+	if exists, _ := KeyExists(store, []byte("aws"), []byte("key")); exists {
+		t.Fatal("the failed update was kept")
+	}
+	if pairs, _ = store.GetEntriesMetadata(); len(pairs) != 2 {
+		t.Fatalf("entries after the failed update = %q", pairs)
+	}
+	must(store.Update(func(tx VaultStore) error {
+		return tx.Insert([]byte("aws"), []byte("key"), []byte("AKIA"), nil)
+	}))
+	if v := value("aws", "key"); v != "AKIA" {
+		t.Fatalf("value after the update = %q", v)
+	}
+}
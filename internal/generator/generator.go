@@ -0,0 +1,123 @@
+package generator
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const (
+	lowercase = "abcdefghijklmnopqrstuvwxyz"
+	uppercase = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	digits    = "0123456789"
+	symbols   = "!#$%&()*+,-./:;<=>?@[]^_{|}~"
+
+	// ambiguous characters are easily confused when a password is read out
+	// or typed from paper.
+	ambiguous = "Il1O0o|"
+
+	MinLength = 8
+	MaxLength = 1024
+)
+
+// Policy describes the passwords to generate.
+type Policy struct {
+	Length           int  `toml:"length"`
+	Lowercase        bool `toml:"lowercase"`
+	Uppercase        bool `toml:"uppercase"`
+	Digits           bool `toml:"digits"`
+	Symbols          bool `toml:"symbols"`
+	ExcludeAmbiguous bool `toml:"exclude_ambiguous"`
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		Length:    20,
+		Lowercase: true,
+		Uppercase: true,
+		Digits:    true,
+		Symbols:   true,
+	}
+}
+
+func (p Policy) Validate() error {
+	if p.Length < MinLength || p.Length > MaxLength {
+		return fmt.Errorf("length must be between %d and %d, got %d", MinLength, MaxLength, p.Length)
+	}
+	if len(p.sets()) == 0 {
+		return errors.New("at least one of lowercase, uppercase, digits and symbols must be enabled")
+	}
+	return nil
+}
+
+// sets returns the character classes enabled by the policy.
+func (p Policy) sets() []string {
+	var sets []string
+	for _, class := range []struct {
+		enabled bool
+		chars   string
+	}{
+		{p.Lowercase, lowercase},
+		{p.Uppercase, uppercase},
+		{p.Digits, digits},
+		{p.Symbols, symbols},
+	} {
+		if !class.enabled {
+			continue
+		}
+		chars := class.chars
+		if p.ExcludeAmbiguous {
+			chars = strings.Map(func(r rune) rune {
+				if strings.ContainsRune(ambiguous, r) {
+					return -1
+				}
+				return r
+			}, chars)
+		}
+		sets = append(sets, chars)
+	}
+	return sets
+}
+
+// Generate returns a random password following the policy. Every enabled
+// character class appears at least once.
+func Generate(p Policy) (string, error) {
+	if err := p.Validate(); err != nil {
+		return "", err
+	}
+	sets := p.sets()
+	all := strings.Join(sets, "")
+
+	password := make([]byte, p.Length)
+	for i := range password {
+		chars := all
+		if i < len(sets) {
+			chars = sets[i]
+		}
+		c, err := randomChar(chars)
+		if err != nil {
+			return "", err
+		}
+		password[i] = c
+	}
+
+	// Shuffle so that the guaranteed characters are not always at the front
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		password[i], password[j.Int64()] = password[j.Int64()], password[i]
+	}
+	return string(password), nil
+}
+
+func randomChar(chars string) (byte, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+	if err != nil {
+		return 0, err
+	}
+	return chars[n.Int64()], nil
+}
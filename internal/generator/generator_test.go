@@ -0,0 +1,49 @@
+package generator
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	policies := []Policy{
+		DefaultPolicy(),
+		{Length: 8, Digits: true},
+		{Length: 12, Lowercase: true, Uppercase: true, ExcludeAmbiguous: true},
+	}
+	for _, policy := range policies {
+		for range 50 {
+			password, err := Generate(policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(password) != policy.Length {
+				t.Fatalf("len(%q) = %d, want %d", password, len(password), policy.Length)
+			}
+			for _, set := range policy.sets() {
+				if !strings.ContainsAny(password, set) {
+					t.Fatalf("%q has no character from %q", password, set)
+				}
+			}
+			if policy.ExcludeAmbiguous && strings.ContainsAny(password, ambiguous) {
+				t.Fatalf("%q contains ambiguous characters", password)
+			}
+			if !policy.Symbols && strings.ContainsAny(password, symbols) {
+				t.Fatalf("%q contains symbols", password)
+			}
+		}
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	invalid := []Policy{
+		{Length: 20},
+		{Length: 4, Lowercase: true},
+		{Length: 2000, Lowercase: true},
+	}
+	for _, policy := range invalid {
+		if err := policy.Validate(); err == nil {
+			t.Errorf("%+v: expected an error", policy)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package health
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/AdityaKK0407/sentryvault/internal/breach"
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+)
+
+type Kind string
+
+const (
+	Weak     Kind = "weak"
+	Reused   Kind = "reused"
+	Stale    Kind = "stale"
+	Breached Kind = "breached"
+)
+
+// Policy sets the thresholds of the health report.
+type Policy struct {
+	// MinEntropy is the estimated strength in bits below which a secret is
+	// weak.
+	MinEntropy float64 `toml:"min_entropy"`
+	// MaxAge after which a secret should have been rotated, 0 to never
+	// report stale secrets.
+	MaxAge time.Duration `toml:"max_age"`
+	// BreachList is a local Have I Been Pwned hash list, see breach.Open.
+	// Values are not checked against breaches when it is empty.
+	BreachList string `toml:"breach_list"`
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		MinEntropy: 60,
+		MaxAge:     180 * 24 * time.Hour,
+	}
+}
+
+func (p Policy) Validate() error {
+	var errs []error
+	if p.MinEntropy < 0 {
+		errs = append(errs, fmt.Errorf("min_entropy must not be negative, got %g", p.MinEntropy))
+	}
+	if p.MaxAge < 0 {
+		errs = append(errs, errors.New("max_age must not be negative, use 0 to never report stale secrets"))
+	}
+	if p.BreachList != "" {
+		if _, err := os.Stat(p.BreachList); err != nil {
+			errs = append(errs, fmt.Errorf("breach_list: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Secret is a decrypted value checked by the report. Values of fields that
+// are not password-like are only checked against breaches.
+type Secret struct {
+	Entry    string
+	Folder   string
+	Key      string
+	Value    string
+	Modified time.Time
+	Secret   bool
+}
+
+// Path returns the folder path of the entry holding the secret.
+func (s Secret) Path() string {
+	return database.JoinEntryPath(s.Folder, s.Entry)
+}
+
+type Finding struct {
+	Kind   Kind   `json:"kind"`
+	Entry  string `json:"entry"`
+	Path   string `json:"path"`
+	Key    string `json:"key"`
+	Detail string `json:"detail"`
+	// Entropy is the estimated strength of a weak secret in bits.
+	Entropy float64 `json:"entropy,omitempty"`
+	// AgeDays is the number of days since a stale secret changed.
+	AgeDays int `json:"ageDays,omitempty"`
+	// ReusedBy lists the other entry/key pairs holding the same value.
+	ReusedBy []string `json:"reusedBy,omitempty"`
+	// Occurrences is the number of times a breached value was seen.
+	Occurrences int `json:"occurrences,omitempty"`
+}
+
+type Report struct {
+	Generated time.Time `json:"generated"`
+	Checked   int       `json:"checked"`
+	Findings  []Finding `json:"findings"`
+}
+
+// Count returns the number of findings of the given kind.
+func (r Report) Count(kind Kind) int {
+	n := 0
+	for _, f := range r.Findings {
+		if f.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// secretKeys are the parts of field names that hold passwords and other
+// secrets which should be strong, unique and rotated.
+var secretKeys = []string{"password", "passphrase", "passwd", "pass", "pin", "secret", "token", "api key", "apikey"}
+
+// IsSecret reports whether a field holds a password-like secret.
+func IsSecret(key string) bool {
+	key = strings.ToLower(key)
+	return slices.ContainsFunc(secretKeys, func(s string) bool {
+		return strings.Contains(key, s)
+	})
+}
+
+// Check decrypts the values of every entry and reports on them.
+func Check(store database.VaultStore, cipherKey32 []byte, policy Policy, now time.Time) (Report, error) {
+	secrets, err := collect(store, cipherKey32)
+	if err != nil {
+		return Report{}, err
+	}
+	report, err := Analyse(secrets, policy, now)
+	if err != nil || policy.BreachList == "" {
+		return report, err
+	}
+
+	list, err := breach.Open(policy.BreachList)
+	if err != nil {
+		return report, err
+	}
+	defer list.Close()
+	findings, err := CheckBreaches(secrets, list)
+	if err != nil {
+		return report, err
+	}
+	report.Findings = append(report.Findings, findings...)
+	sortFindings(report.Findings)
+	return report, nil
+}
+
+func collect(store database.VaultStore, cipherKey32 []byte) ([]Secret, error) {
+	pairs, err := store.GetEntriesMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	var secrets []Secret
+	for _, pair := range pairs {
+		entryMetadata, err := database.OpenEntryMetadata(cipherKey32, pair[1])
+		if err != nil {
+			return nil, err
+		}
+		fields, err := store.RetrieveAll(pair[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range fields {
+			value, err := cipher.DecryptAESGCM(cipherKey32, f[1])
+			if err != nil {
+				return nil, err
+			}
+			if len(value) == 0 {
+				continue
+			}
+			metadata, err := database.OpenFieldMetadata(cipherKey32, f[2])
+			if err != nil {
+				return nil, err
+			}
+			secrets = append(secrets, Secret{
+				Entry:    string(pair[0]),
+				Folder:   entryMetadata.Folder,
+				Key:      string(f[0]),
+				Value:    string(value),
+				Modified: metadata.Modified,
+				Secret:   IsSecret(string(f[0])),
+			})
+		}
+	}
+	return secrets, nil
+}
+
+// Analyse reports weak, reused and stale secrets. Values are only compared
+// through keyed hashes under a key that lives for a single report.
+func Analyse(secrets []Secret, policy Policy, now time.Time) (Report, error) {
+	report := Report{Generated: now, Findings: []Finding{}}
+	secrets = slices.DeleteFunc(slices.Clone(secrets), func(s Secret) bool {
+		return !s.Secret
+	})
+	report.Checked = len(secrets)
+
+	hashKey := make([]byte, 32)
+	if _, err := rand.Read(hashKey); err != nil {
+		return report, err
+	}
+	digests := make([]string, len(secrets))
+	owners := make(map[string][]int)
+	for i, s := range secrets {
+		mac := hmac.New(sha256.New, hashKey)
+		mac.Write([]byte(s.Value))
+		digests[i] = string(mac.Sum(nil))
+		owners[digests[i]] = append(owners[digests[i]], i)
+	}
+
+	for i, s := range secrets {
+		finding := Finding{Entry: s.Entry, Path: s.Path(), Key: s.Key}
+
+		if bits := Entropy(s.Value); bits < policy.MinEntropy {
+			f := finding
+			f.Kind = Weak
+			f.Entropy = math.Round(bits*10) / 10
+			f.Detail = fmt.Sprintf("about %.0f bits, at least %.0f expected", bits, policy.MinEntropy)
+			report.Findings = append(report.Findings, f)
+		}
+
+		if same := owners[digests[i]]; len(same) > 1 {
+			f := finding
+			f.Kind = Reused
+			for _, j := range same {
+				if j != i {
+					f.ReusedBy = append(f.ReusedBy, secrets[j].Path()+" / "+secrets[j].Key)
+				}
+			}
+			f.Detail = "also used by " + strings.Join(f.ReusedBy, ", ")
+			report.Findings = append(report.Findings, f)
+		}
+
+		// Fields from before metadata was recorded have no known age
+		if policy.MaxAge > 0 && !s.Modified.IsZero() {
+			if age := now.Sub(s.Modified); age > policy.MaxAge {
+				f := finding
+				f.Kind = Stale
+				f.AgeDays = int(age.Hours() / 24)
+				f.Detail = fmt.Sprintf("last changed %d days ago", f.AgeDays)
+				report.Findings = append(report.Findings, f)
+			}
+		}
+	}
+
+	sortFindings(report.Findings)
+	return report, nil
+}
+
+// CheckBreaches reports values found in a breached password list. Each
+// distinct value is looked up once.
+func CheckBreaches(secrets []Secret, list breach.List) ([]Finding, error) {
+	counts := make(map[[sha1.Size]byte]int)
+	var findings []Finding
+	for _, s := range secrets {
+		hash := sha1.Sum([]byte(s.Value))
+		count, ok := counts[hash]
+		if !ok {
+			var err error
+			if count, err = list.Count(hash); err != nil {
+				return nil, err
+			}
+			counts[hash] = count
+		}
+		if count > 0 {
+			findings = append(findings, Finding{
+				Kind:        Breached,
+				Entry:       s.Entry,
+				Path:        s.Path(),
+				Key:         s.Key,
+				Detail:      fmt.Sprintf("seen %d times in data breaches", count),
+				Occurrences: count,
+			})
+		}
+	}
+	return findings, nil
+}
+
+func sortFindings(findings []Finding) {
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		if c := strings.Compare(string(a.Kind), string(b.Kind)); c != 0 {
+			return c
+		}
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+}
+
+// Entropy estimates the strength of a password in bits from the character
+// classes it uses. Characters that repeat the previous one or continue a
+// sequence such as "abc" or "321" count for a single bit.
+func Entropy(password string) float64 {
+	runes := []rune(password)
+	if len(runes) == 0 {
+		return 0
+	}
+
+	var lower, upper, digit, symbol, other bool
+	for _, r := range runes {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+	pool := 0
+	for _, class := range []struct {
+		used bool
+		size int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.used {
+			pool += class.size
+		}
+	}
+	perChar := math.Log2(float64(pool))
+
+	bits := 0.0
+	for i, r := range runes {
+		if i > 0 {
+			d := r - runes[i-1]
+			if d >= -1 && d <= 1 {
+				bits++
+				continue
+			}
+		}
+		bits += perChar
+	}
+	return bits
+}
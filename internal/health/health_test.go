@@ -0,0 +1,108 @@
+package health
+
+import (
+	"crypto/sha1"
+	"testing"
+	"time"
+)
+
+func TestEntropy(t *testing.T) {
+	for _, tc := range []struct {
+		password string
+		min, max float64
+	}{
+		{"", 0, 0},
+		{"aaaaaaaa", 0, 12},
+		{"abcdefgh", 0, 12},
+		{"password", 30, 40},
+		{"xK9#mQ2$vL7!pR4&", 90, 110},
+	} {
+		if bits := Entropy(tc.password); bits < tc.min || bits > tc.max {
+			t.Errorf("Entropy(%q) = %.1f, want between %g and %g", tc.password, bits, tc.min, tc.max)
+		}
+	}
+}
+
+func TestAnalyse(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	strong := "xK9#mQ2$vL7!pR4&"
+	secrets := []Secret{
+		{Entry: "github", Folder: "work", Key: "password", Value: strong, Modified: now.AddDate(0, 0, -10), Secret: true},
+		{Entry: "gitlab", Key: "password", Value: strong, Modified: now.AddDate(0, 0, -10), Secret: true},
+		{Entry: "bank", Key: "pin", Value: "1234", Modified: now.AddDate(-1, 0, 0), Secret: true},
+		{Entry: "legacy", Key: "password", Value: "tR5$wQ8!zN3&kM6#", Secret: true},
+		{Entry: "github", Folder: "work", Key: "username", Value: "octocat"},
+	}
+	report, err := Analyse(secrets, DefaultPolicy(), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 4 {
+		t.Errorf("Checked = %d, want 4", report.Checked)
+	}
+
+	got := map[Kind][]string{}
+	for _, f := range report.Findings {
+		got[f.Kind] = append(got[f.Kind], f.Path)
+	}
+	if w := got[Weak]; len(w) != 1 || w[0] != "bank" {
+		t.Errorf("weak = %v, want [bank]", w)
+	}
+	if r := got[Reused]; len(r) != 2 || r[0] != "gitlab" || r[1] != "work/github" {
+		t.Errorf("reused = %v, want [gitlab work/github]", r)
+	}
+	if s := got[Stale]; len(s) != 1 || s[0] != "bank" {
+		t.Errorf("stale = %v, want [bank]", s)
+	}
+	for _, f := range report.Findings {
+		if f.Kind == Reused && f.Path == "gitlab" && (len(f.ReusedBy) != 1 || f.ReusedBy[0] != "work/github / password") {
+			t.Errorf("ReusedBy = %v", f.ReusedBy)
+		}
+	}
+}
+
+func TestIsSecret(t *testing.T) {
+	for key, want := range map[string]bool{
+		"password":   true,
+		"Passphrase": true,
+		"API Key":    true,
+		"pin":        true,
+		"username":   false,
+		"url":        false,
+	} {
+		if IsSecret(key) != want {
+			t.Errorf("IsSecret(%q) = %v, want %v", key, !want, want)
+		}
+	}
+}
+
+type fakeList map[[sha1.Size]byte]int
+
+func (l fakeList) Count(hash [sha1.Size]byte) (int, error) {
+	return l[hash], nil
+}
+
+func (l fakeList) Close() error {
+	return nil
+}
+
+func TestCheckBreaches(t *testing.T) {
+	list := fakeList{sha1.Sum([]byte("hunter2")): 17043}
+	secrets := []Secret{
+		{Entry: "irc", Key: "password", Value: "hunter2", Secret: true},
+		{Entry: "irc", Key: "nick", Value: "hunter2"},
+		{Entry: "bank", Key: "password", Value: "tR5$wQ8!zN3&kM6#", Secret: true},
+	}
+	findings, err := CheckBreaches(secrets, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 2 {
+		t.Fatalf("findings = %+v, want both irc fields", findings)
+	}
+	for _, f := range findings {
+		if f.Kind != Breached || f.Entry != "irc" || f.Occurrences != 17043 {
+			t.Errorf("finding = %+v", f)
+		}
+	}
+}
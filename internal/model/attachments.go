@@ -0,0 +1,286 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type attachmentState uint8
+
+const (
+	tableAttachments attachmentState = iota
+	attachFile
+	extractFile
+	removeAttachment
+)
+
+type AttachmentModel struct {
+	tableView   table.Model
+	pathInput   textinput.Model
+	help        help.Model
+	state       attachmentState
+	names       []string
+	Entry       string
+	store       database.VaultStore
+	username    string
+	cipherKey32 []byte
+	audit       auditlog.Logger
+	message     string
+	messageErr  bool
+}
+
+func (m AttachmentModel) setTableRows() (AttachmentModel, error) {
+	attachments, err := m.store.GetAttachments([]byte(m.Entry))
+	if err != nil {
+		return m, err
+	}
+
+	m.names = nil
+	var rows []table.Row
+	for _, attachment := range attachments {
+		metadata, err := database.OpenAttachmentMetadata(m.cipherKey32, attachment[1])
+		if err != nil {
+			return m, err
+		}
+		m.names = append(m.names, string(attachment[0]))
+		rows = append(rows, table.Row{
+			string(attachment[0]),
+			database.FormatSize(metadata.Size),
+			metadata.Added.Local().Format("2006-01-02 15:04"),
+		})
+	}
+	setRows(&m.tableView, rows)
+	return m, nil
+}
+
+// setSize fits the table and path input into the given width and height.
+func (m *AttachmentModel) setSize(width, height int) {
+	fitColumns(&m.tableView, width, true, 0)
+	m.tableView.SetHeight(tableHeight(height))
+	m.pathInput.Width = inputWidth(width, m.pathInput.Prompt)
+	m.help.Width = width
+}
+
+func (m AttachmentModel) selectBoundsCheck() bool {
+	if m.tableView.Cursor() >= 0 && m.tableView.Cursor() < len(m.names) {
+		return true
+	}
+	return false
+}
+
+// typing reports whether a path is being entered, when keys go to the input.
+func (m AttachmentModel) typing() bool {
+	return m.state == attachFile || m.state == extractFile
+}
+
+func (m *AttachmentModel) resetInputs() {
+	m.pathInput.Reset()
+	m.pathInput.Blur()
+	m.tableView.Focus()
+	m.state = tableAttachments
+}
+
+// expandPath resolves a leading ~ to the home directory.
+func expandPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+func initialAttachmentModel(store database.VaultStore, username string, audit auditlog.Logger, cipherKey32 []byte) AttachmentModel {
+	cols := []table.Column{
+		{Title: "Attachment", Width: 40},
+		{Title: "Size", Width: 10},
+		{Title: "Added", Width: 16},
+	}
+
+	t := table.New(
+		table.WithKeyMap(tableKeyMap()),
+		table.WithStyles(tableStyles()),
+		table.WithColumns(cols),
+		table.WithRows([]table.Row{}),
+		table.WithHeight(10),
+		table.WithFocused(true),
+	)
+
+	pathInput := textinput.New()
+	pathInput.Prompt = "Path: "
+	pathInput.Width = 50
+
+	return AttachmentModel{
+		tableView:   t,
+		pathInput:   pathInput,
+		help:        help.New(),
+		state:       tableAttachments,
+		store:       store,
+		username:    username,
+		cipherKey32: cipherKey32,
+		audit:       audit,
+	}
+}
+
+func (m AttachmentModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m AttachmentModel) Update(msg tea.Msg) (AttachmentModel, tea.Cmd) {
+	var cmd tea.Cmd
+	kb := keybindings()
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, kb.Quit) && !m.typing():
+			return m, tea.Quit
+		case key.Matches(msg, kb.Escape):
+			if m.state == tableAttachments {
+				m.message = ""
+				return m, func() tea.Msg {
+					return selectEntryMsg{Entry: m.Entry}
+				}
+			}
+			m.resetInputs()
+		case key.Matches(msg, kb.Enter):
+			switch m.state {
+			case tableAttachments:
+				if m.selectBoundsCheck() {
+					m.tableView.Blur()
+					m.pathInput.SetValue(filepath.Base(m.names[m.tableView.Cursor()]))
+					m.pathInput.Focus()
+					m.state = extractFile
+				}
+				return m, nil
+			case attachFile:
+				path := expandPath(m.pathInput.Value())
+				if path == "" {
+					return m, nil
+				}
+				name := filepath.Base(path)
+				err := database.AttachFile(m.store, m.cipherKey32, []byte(m.Entry), []byte(name), path, m.username)
+				if err == nil {
+					err = m.audit.Log(auditlog.Attach, m.Entry, name, "")
+				}
+				if err == nil {
+					m, err = m.setTableRows()
+				}
+				if err != nil {
+					m.message = err.Error()
+					m.messageErr = true
+					return m, nil
+				}
+				m.resetInputs()
+				m.message = fmt.Sprintf("Attached \"%s\"", name)
+				m.messageErr = false
+				return m, nil
+			case extractFile:
+				name := m.names[m.tableView.Cursor()]
+				path := expandPath(m.pathInput.Value())
+				if path == "" {
+					return m, nil
+				}
+				err := database.ExtractAttachmentFile(m.store, m.cipherKey32, []byte(m.Entry), []byte(name), path)
+				if errors.Is(err, os.ErrExist) {
+					m.message = fmt.Sprintf("%s already exists", path)
+					m.messageErr = true
+					return m, nil
+				}
+				if err == nil {
+					err = m.audit.Log(auditlog.Export, m.Entry, name, "extracted to "+path)
+				}
+				if err != nil {
+					m.message = err.Error()
+					m.messageErr = true
+					return m, nil
+				}
+				m.resetInputs()
+				m.message = fmt.Sprintf("Extracted \"%s\" to %s", name, path)
+				m.messageErr = false
+				return m, nil
+			}
+		case key.Matches(msg, kb.Add):
+			if m.state == tableAttachments {
+				m.tableView.Blur()
+				m.pathInput.Focus()
+				m.state = attachFile
+				return m, nil
+			}
+		case key.Matches(msg, kb.Remove):
+			if m.state == tableAttachments && m.selectBoundsCheck() {
+				m.tableView.Blur()
+				m.state = removeAttachment
+			}
+		case key.Matches(msg, kb.Confirm):
+			if m.state == removeAttachment {
+				name := m.names[m.tableView.Cursor()]
+				err := m.store.RemoveAttachment([]byte(m.Entry), []byte(name))
+				if err == nil {
+					err = m.audit.Log(auditlog.Remove, m.Entry, name, "attachment")
+				}
+				if err == nil {
+					m, err = m.setTableRows()
+				}
+				if err != nil {
+					return m, func() tea.Msg {
+						return errMsg{Err: err}
+					}
+				}
+				m.message = fmt.Sprintf("Deleted \"%s\"", name)
+				m.messageErr = false
+			}
+			fallthrough
+		case key.Matches(msg, kb.Cancel):
+			if m.state == removeAttachment {
+				m.tableView.Focus()
+				m.state = tableAttachments
+			}
+		}
+	}
+
+	switch m.state {
+	case tableAttachments:
+		m.tableView, cmd = m.tableView.Update(msg)
+	case attachFile, extractFile:
+		m.pathInput, cmd = m.pathInput.Update(msg)
+	}
+	return m, cmd
+}
+
+func (m AttachmentModel) View() string {
+	s := fmt.Sprintf("Attachments of %s\n\n", m.Entry)
+	s += tableStyle.Render(m.tableView.View())
+
+	switch m.state {
+	case attachFile:
+		s += fmt.Sprintf("\n\nFile to attach\n%s", m.pathInput.View())
+	case extractFile:
+		s += fmt.Sprintf("\n\nExtract %s to\n%s", m.names[m.tableView.Cursor()], m.pathInput.View())
+	case removeAttachment:
+		s += fmt.Sprintf("\n\nPermanently delete %s?\n", m.names[m.tableView.Cursor()])
+		s += confirmHint() + "\n\n"
+	case tableAttachments:
+		if len(m.names) == 0 {
+			s += "\n\nNo attachments"
+		}
+		kb := keybindings()
+		s += "\n\n" + keyHints(keyHint(kb.Add, "Attach file"), keyHint(kb.Enter, "Extract"), keyHint(kb.Remove, "Delete"), keyHint(kb.Escape, "Back"))
+	}
+
+	s += messageView(m.message, m.messageErr)
+	s += fmt.Sprintf("\n\n%s\n", helpView(m.help))
+
+	return s
+}
@@ -0,0 +1,232 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type auditState uint8
+
+const (
+	tableAudit auditState = iota
+	filterAudit
+)
+
+// AuditModel shows the audit log of the vault, newest first, and whether
+// its chain is intact.
+type AuditModel struct {
+	tableView   table.Model
+	filterInput textinput.Model
+	help        help.Model
+	state       auditState
+	records     []auditlog.Record
+	result      auditlog.Result
+	filter      string
+	store       database.VaultStore
+	cipherKey32 []byte
+}
+
+func (m AuditModel) setTableRows() (AuditModel, error) {
+	records, err := auditlog.Read(m.store, m.cipherKey32)
+	if err != nil {
+		return m, err
+	}
+	if m.result, err = auditlog.Verify(m.store, m.cipherKey32); err != nil {
+		return m, err
+	}
+	slices.Reverse(records)
+	m.records = records
+	m.refreshRows()
+	return m, nil
+}
+
+// refreshRows shows the records matching the filter.
+func (m *AuditModel) refreshRows() {
+	var rows []table.Row
+	for _, r := range m.records {
+		if !matchesAuditFilter(r, m.filter) {
+			continue
+		}
+		rows = append(rows, table.Row{
+			r.Time.Local().Format("2006-01-02 15:04:05"),
+			r.Actor,
+			string(r.Action),
+			r.Entry,
+			r.Key,
+			r.Detail,
+		})
+	}
+	setRows(&m.tableView, rows)
+}
+
+// matchesAuditFilter reports whether a record matches every term of a
+// filter. Terms such as "actor:bob", "action:copy", "entry:aws" or
+// "key:password" match that column, other terms match any of them.
+func matchesAuditFilter(r auditlog.Record, filter string) bool {
+	columns := map[string]string{
+		"actor":  r.Actor,
+		"action": string(r.Action),
+		"entry":  r.Entry,
+		"key":    r.Key,
+		"detail": r.Detail,
+	}
+	for _, term := range strings.Fields(strings.ToLower(filter)) {
+		name, value, found := strings.Cut(term, ":")
+		if column, ok := columns[name]; found && ok {
+			if !strings.Contains(strings.ToLower(column), value) {
+				return false
+			}
+			continue
+		}
+		matched := false
+		for _, column := range columns {
+			if strings.Contains(strings.ToLower(column), term) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// setSize fits the table and filter into the given width and height.
+func (m *AuditModel) setSize(width, height int) {
+	fitColumns(&m.tableView, width, true, 3, 5)
+	m.tableView.SetHeight(tableHeight(height))
+	m.filterInput.Width = inputWidth(width, m.filterInput.Prompt)
+	m.help.Width = width
+}
+
+func (m AuditModel) typing() bool {
+	return m.state == filterAudit
+}
+
+func initialAuditModel(store database.VaultStore, cipherKey32 []byte) AuditModel {
+	cols := []table.Column{
+		{Title: "Time", Width: 19},
+		{Title: "Actor", Width: 12},
+		{Title: "Action", Width: 8},
+		{Title: "Entry", Width: 25},
+		{Title: "Field", Width: 16},
+		{Title: "Detail", Width: 30},
+	}
+
+	t := table.New(
+		table.WithKeyMap(tableKeyMap()),
+		table.WithStyles(tableStyles()),
+		table.WithColumns(cols),
+		table.WithRows([]table.Row{}),
+		table.WithHeight(10),
+		table.WithFocused(true),
+	)
+
+	filterInput := textinput.New()
+	filterInput.Width = 50
+	filterInput.Prompt = "Filter: "
+	filterInput.Placeholder = "e.g. actor:bob action:copy aws"
+
+	return AuditModel{
+		tableView:   t,
+		filterInput: filterInput,
+		help:        help.New(),
+		state:       tableAudit,
+		store:       store,
+		cipherKey32: cipherKey32,
+	}
+}
+
+func (m AuditModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m AuditModel) Update(msg tea.Msg) (AuditModel, tea.Cmd) {
+	var cmd tea.Cmd
+	kb := keybindings()
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, kb.Quit) && !m.typing():
+			return m, tea.Quit
+		case key.Matches(msg, kb.Escape):
+			if m.state == tableAudit {
+				return m, func() tea.Msg {
+					return returnEntryMsg{}
+				}
+			}
+			m.filterInput.Blur()
+			m.tableView.Focus()
+			m.state = tableAudit
+			return m, nil
+		case key.Matches(msg, kb.Enter):
+			if m.state == filterAudit {
+				m.filter = strings.TrimSpace(m.filterInput.Value())
+				m.refreshRows()
+				m.filterInput.Blur()
+				m.tableView.Focus()
+				m.state = tableAudit
+				return m, nil
+			}
+		case key.Matches(msg, kb.Filter):
+			if m.state == tableAudit {
+				m.tableView.Blur()
+				m.filterInput.SetValue(m.filter)
+				m.filterInput.Focus()
+				m.state = filterAudit
+				return m, nil
+			}
+		}
+	}
+
+	if m.state == filterAudit {
+		m.filterInput, cmd = m.filterInput.Update(msg)
+		return m, cmd
+	}
+	m.tableView, cmd = m.tableView.Update(msg)
+	return m, cmd
+}
+
+func (m AuditModel) View() string {
+	s := fmt.Sprintf("Audit log: %d records", m.result.Records)
+	if m.filter != "" {
+		s += fmt.Sprintf(", %d shown", len(m.tableView.Rows()))
+	}
+	s += "\n\n"
+	s += tableStyle.Render(m.tableView.View())
+
+	if m.filter != "" {
+		s += fmt.Sprintf("\nFiltered by: %s", m.filter)
+	}
+	if m.result.OK() {
+		s += messageView("The chain of records is intact", false)
+	} else {
+		problems := make([]string, len(m.result.Problems))
+		for i, p := range m.result.Problems {
+			problems[i] = p.String()
+		}
+		s += messageView("The log was tampered with: "+strings.Join(problems, "; "), true)
+	}
+
+	kb := keybindings()
+	switch m.state {
+	case filterAudit:
+		s += fmt.Sprintf("\n\n%s", m.filterInput.View())
+	default:
+		s += "\n\n" + keyHints(keyHint(kb.Filter, "Filter"), keyHint(kb.Escape, "Back"))
+	}
+	s += fmt.Sprintf("\n\n%s\n", helpView(m.help))
+
+	return s
+}
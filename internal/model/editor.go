@@ -0,0 +1,102 @@
+package model
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// editorMsg carries the value written in an external editor back to the
+// model once the editor exits.
+type editorMsg struct {
+	Value string
+	Err   error
+}
+
+// privateTempDir creates a directory only readable by the current user,
+// preferring a tmpfs so that values never reach a disk.
+func privateTempDir() (string, error) {
+	base := os.TempDir()
+	if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+		base = "/dev/shm"
+	}
+	return os.MkdirTemp(base, "sentryvault-")
+}
+
+// editorCommand returns the editor configured through $VISUAL or $EDITOR.
+func editorCommand(path string) *exec.Cmd {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	args := strings.Fields(editor)
+	return exec.Command(args[0], append(args[1:], path)...)
+}
+
+// openEditor writes value to a temporary file and opens it in the user's
+// editor. The file is shredded after the editor exits.
+func openEditor(value string) tea.Cmd {
+	dir, err := privateTempDir()
+	if err != nil {
+		return func() tea.Msg {
+			return editorMsg{Err: err}
+		}
+	}
+	path := filepath.Join(dir, "value.txt")
+	if err = os.WriteFile(path, []byte(value), 0600); err != nil {
+		os.RemoveAll(dir)
+		return func() tea.Msg {
+			return editorMsg{Err: err}
+		}
+	}
+
+	return tea.ExecProcess(editorCommand(path), func(err error) tea.Msg {
+		var data []byte
+		if err == nil {
+			data, err = os.ReadFile(path)
+		}
+		err = errors.Join(err, shred(path), os.RemoveAll(dir))
+		return editorMsg{Value: strings.TrimSuffix(string(data), "\n"), Err: err}
+	})
+}
+
+// shred overwrites a file with random bytes before removing it.
+func shred(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err == nil {
+		_, err = io.CopyN(f, rand.Reader, info.Size())
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// summary shortens a multi-line value to its first line for the table.
+func summary(value string) string {
+	first, _, found := strings.Cut(value, "\n")
+	if !found {
+		return value
+	}
+	return fmt.Sprintf("%s … (%d lines)", first, strings.Count(value, "\n")+1)
+}
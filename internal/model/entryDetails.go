@@ -1,17 +1,25 @@
 package model
 
 import (
+	"errors"
 	"fmt"
 	"slices"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
 	"github.com/AdityaKK0407/sentryvault/internal/cipher"
 	"github.com/AdityaKK0407/sentryvault/internal/database"
+	"github.com/AdityaKK0407/sentryvault/internal/generator"
+	"github.com/AdityaKK0407/sentryvault/internal/templates"
+	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
-	bolt "go.etcd.io/bbolt"
 )
 
 type state uint8
@@ -21,41 +29,330 @@ const (
 	addDetails
 	updateDetails
 	removeDetails
+	historyDetails
+	renameDetails
+	overwriteDetails
 )
 
+type sortOrder uint8
+
+const (
+	sortByKey sortOrder = iota
+	sortByNewest
+	sortByOldest
+)
+
+type field struct {
+	key      string
+	value    string
+	metadata database.FieldMetadata
+}
+
 type DetailsModel struct {
 	tableView   table.Model
+	historyView table.Model
+	versions    []database.Version
 	keyInput    textinput.Model
 	valueInput  textinput.Model
+	valueArea   textarea.Model
+	multiline   bool
+	noteInput   textinput.Model
 	help        help.Model
 	state       state
+	sortOrder   sortOrder
+	fields      []field
+	reveal      bool
 	Entry       string
-	db          *bolt.DB
+	entryType   string
+	store       database.VaultStore
+	username    string
 	cipherKey32 []byte
 	cipherKey64 []byte
+	audit       auditlog.Logger
+	message     string
+	messageErr  bool
+	// damaged counts the fields that cannot be decrypted and are not shown.
+	damaged int
 }
 
+const maskedValue = "••••••••"
+
 func (m DetailsModel) setTableRows() (DetailsModel, error) {
-	pairs, err := database.RetrieveAll(m.db, []byte(m.Entry))
+	data, err := m.store.GetEntryMetadata([]byte(m.Entry))
+	if err != nil {
+		return m, err
+	}
+	m.damaged = 0
+	// A damaged entry is still shown, without a template
+	entryMetadata, err := database.OpenEntryMetadata(m.cipherKey32, data)
+	if err != nil {
+		entryMetadata = database.EntryMetadata{}
+		m.damaged++
+	}
+	m.entryType = entryMetadata.Type
+
+	pairs, err := m.store.RetrieveAll([]byte(m.Entry))
 	if err != nil {
 		return m, err
 	}
 
-	var rows []table.Row
+	m.fields = nil
 	for _, pair := range pairs {
 		val, err := cipher.DecryptAESGCM(m.cipherKey32, pair[1])
+		if err != nil {
+			m.damaged++
+			continue
+		}
+		metadata, err := database.OpenFieldMetadata(m.cipherKey32, pair[2])
+		if err != nil {
+			m.damaged++
+			continue
+		}
+		m.fields = append(m.fields, field{
+			key:      string(pair[0]),
+			value:    string(val),
+			metadata: metadata,
+		})
+	}
+	m.refreshRows()
+	return m, nil
+}
+
+// refreshRows rebuilds the table from m.fields in the current sort order.
+func (m *DetailsModel) refreshRows() {
+	switch m.sortOrder {
+	case sortByKey:
+		sort.SliceStable(m.fields, func(i, j int) bool {
+			return m.fields[i].key < m.fields[j].key
+		})
+	case sortByNewest:
+		sort.SliceStable(m.fields, func(i, j int) bool {
+			return m.fields[i].metadata.Modified.After(m.fields[j].metadata.Modified)
+		})
+	case sortByOldest:
+		sort.SliceStable(m.fields, func(i, j int) bool {
+			return m.fields[i].metadata.Modified.Before(m.fields[j].metadata.Modified)
+		})
+	}
+
+	var rows []table.Row
+	for _, f := range m.fields {
+		rows = append(rows, table.Row{
+			f.key,
+			m.display(f.key, f.value),
+			lastChanged(f.metadata),
+		})
+	}
+	setRows(&m.tableView, rows)
+}
+
+// storeField encrypts and stores a field, keeping the creation time of an
+// existing field with the same key. The rows are reloaded from the bucket
+// afterwards so that they always match what was stored.
+func (m DetailsModel) storeField(keyEntry, value, note string) (DetailsModel, error) {
+	metadata := database.NewFieldMetadata(m.username, note)
+	detail := "added"
+	_, current, err := m.store.Retrieve([]byte(m.Entry), []byte(keyEntry))
+	if err == nil {
+		detail = "changed"
+		existing, err := database.OpenFieldMetadata(m.cipherKey32, current)
+		if err != nil {
+			return m, err
+		}
+		metadata = existing.Touch(m.username, note)
+	} else if !errors.Is(err, database.ErrNotFound) {
+		return m, err
+	}
+
+	cipherValue, err := cipher.EncryptAESGCM(m.cipherKey32, []byte(value))
+	if err != nil {
+		return m, err
+	}
+	cipherMetadata, err := metadata.Seal(m.cipherKey32)
+	if err != nil {
+		return m, err
+	}
+	if err = m.store.Insert([]byte(m.Entry), []byte(keyEntry), cipherValue, cipherMetadata); err != nil {
+		return m, err
+	}
+	if err = m.touchEntry(); err != nil {
+		return m, err
+	}
+	if err = m.audit.Log(auditlog.Insert, m.Entry, keyEntry, detail); err != nil {
+		return m, err
+	}
+	return m.setTableRows()
+}
+
+// touchEntry updates the modification time of the current entry.
+func (m DetailsModel) touchEntry() error {
+	return database.UpdateEntryMetadata(m.store, m.cipherKey32, []byte(m.Entry), func(metadata *database.EntryMetadata) {
+		metadata.Modified = time.Now()
+	})
+}
+
+// openHistory loads the previous versions of the selected field.
+func (m DetailsModel) openHistory() (DetailsModel, error) {
+	keyEntry := m.tableView.SelectedRow()[0]
+	versions, err := m.store.GetHistory([]byte(m.Entry), []byte(keyEntry))
+	if err != nil {
+		return m, err
+	}
+
+	var rows []table.Row
+	for _, version := range versions {
+		value, err := cipher.DecryptAESGCM(m.cipherKey32, version.Value)
+		if err != nil {
+			return m, err
+		}
+		metadata, err := database.OpenFieldMetadata(m.cipherKey32, version.Metadata)
 		if err != nil {
 			return m, err
 		}
 		rows = append(rows, table.Row{
-			string(pair[0]),
-			string(val),
+			fmt.Sprint(version.ID),
+			m.display(keyEntry, string(value)),
+			lastChanged(metadata),
+			metadata.Note,
 		})
 	}
-	m.tableView.SetRows(rows)
+	m.versions = versions
+	setRows(&m.historyView, rows)
+	m.historyView.SetCursor(0)
 	return m, nil
 }
 
+// display masks the value of a sensitive field unless values are revealed.
+func (m DetailsModel) display(key, value string) string {
+	if value == "" || m.reveal || !templates.IsSensitive(m.entryType, key) {
+		return summary(value)
+	}
+	return maskedValue
+}
+
+// value returns the value being entered in whichever editor is in use.
+func (m DetailsModel) value() string {
+	if m.multiline {
+		return m.valueArea.Value()
+	}
+	return m.valueInput.Value()
+}
+
+// editValue focuses the value editor for key, switching to the multi-line
+// editor for fields that expect one. Multi-line values are edited in place,
+// so the current value is loaded into the editor.
+func (m *DetailsModel) editValue(key, current string) tea.Cmd {
+	field, _ := templates.FieldOf(m.entryType, key)
+	m.multiline = field.Multiline || strings.Contains(current, "\n")
+	if m.multiline {
+		m.valueArea.SetValue(current)
+		return m.valueArea.Focus()
+	}
+	return m.valueInput.Focus()
+}
+
+// toggleMultiline moves the value between the single and multi-line editors.
+func (m *DetailsModel) toggleMultiline() tea.Cmd {
+	value := m.value()
+	m.multiline = !m.multiline
+	if m.multiline {
+		m.valueInput.Blur()
+		m.valueArea.SetValue(value)
+		return m.valueArea.Focus()
+	}
+	m.valueArea.Blur()
+	m.valueInput.SetValue(strings.ReplaceAll(value, "\n", " "))
+	return m.valueInput.Focus()
+}
+
+// submitValue validates the value and moves on to the note.
+func (m *DetailsModel) submitValue(key string) {
+	if !m.validate(key, m.value()) {
+		return
+	}
+	m.valueInput.Blur()
+	m.valueArea.Blur()
+	m.noteInput.Focus()
+}
+
+// editingValue reports whether the value of a field is being entered.
+func (m DetailsModel) editingValue() bool {
+	return (m.state == addDetails || m.state == updateDetails) && (m.valueInput.Focused() || m.valueArea.Focused())
+}
+
+// editingKey returns the key of the field whose value is being entered.
+func (m DetailsModel) editingKey() string {
+	if m.state == addDetails {
+		return m.keyInput.Value()
+	}
+	return m.tableView.SelectedRow()[0]
+}
+
+// validate checks a value against the template of the entry, showing the
+// problem as a message when it is rejected.
+func (m *DetailsModel) validate(key, value string) bool {
+	if err := templates.Validate(m.entryType, key, value); err != nil {
+		m.message = fmt.Sprintf("Invalid %s: %v", key, err)
+		m.messageErr = true
+		return false
+	}
+	m.message = ""
+	return true
+}
+
+func lastChanged(metadata database.FieldMetadata) string {
+	if metadata.Modified.IsZero() {
+		return "-"
+	}
+	return metadata.Modified.Local().Format("2006-01-02 15:04")
+}
+
+// clear empties the model when no entry is selected.
+func (m *DetailsModel) clear() {
+	m.Entry = ""
+	m.entryType = ""
+	m.fields = nil
+	setRows(&m.tableView, nil)
+}
+
+// setSize fits the tables and inputs into the given width and height.
+func (m *DetailsModel) setSize(width, height int) {
+	fitColumns(&m.tableView, width, false, 0, 1)
+	m.tableView.SetHeight(tableHeight(height))
+	fitColumns(&m.historyView, width, false, 1, 3)
+	m.historyView.SetHeight(tableHeight(height))
+	for _, input := range []*textinput.Model{&m.keyInput, &m.valueInput, &m.noteInput} {
+		input.Width = inputWidth(width, input.Prompt)
+	}
+	m.valueArea.SetWidth(width - 2)
+	m.help.Width = width
+}
+
+// typing reports whether one of the inputs has focus, when keys go to the
+// input rather than to the bindings.
+func (m DetailsModel) typing() bool {
+	switch m.state {
+	case addDetails, updateDetails, renameDetails:
+		return true
+	}
+	return false
+}
+
+func (m *DetailsModel) resetInputs() {
+	m.keyInput.Reset()
+	m.keyInput.Blur()
+	m.valueInput.Reset()
+	m.valueInput.Blur()
+	m.valueArea.Reset()
+	m.valueArea.Blur()
+	m.multiline = false
+	m.noteInput.Reset()
+	m.noteInput.Blur()
+	m.historyView.Blur()
+	m.tableView.Focus()
+	m.state = tableDetails
+}
+
 func (m DetailsModel) selectBoundsCheck() bool {
 	if m.tableView.Cursor() >= 0 && m.tableView.Cursor() < len(m.tableView.Rows()) {
 		return true
@@ -63,13 +360,16 @@ func (m DetailsModel) selectBoundsCheck() bool {
 	return false
 }
 
-func initialEntryDetailsModel(db *bolt.DB, cipherKey32, cipherKey64 []byte) DetailsModel {
+func initialEntryDetailsModel(store database.VaultStore, username string, audit auditlog.Logger, cipherKey32, cipherKey64 []byte) DetailsModel {
 	cols := []table.Column{
 		{Title: "Key", Width: 35},
 		{Title: "Value", Width: 35},
+		{Title: "Last Changed", Width: 16},
 	}
 
 	t := table.New(
+		table.WithKeyMap(tableKeyMap()),
+		table.WithStyles(tableStyles()),
 		table.WithColumns(cols),
 		table.WithRows([]table.Row{}),
 		table.WithHeight(10),
@@ -77,6 +377,19 @@ func initialEntryDetailsModel(db *bolt.DB, cipherKey32, cipherKey64 []byte) Deta
 	)
 	t.Focus()
 
+	historyView := table.New(
+		table.WithKeyMap(tableKeyMap()),
+		table.WithStyles(tableStyles()),
+		table.WithColumns([]table.Column{
+			{Title: "Version", Width: 8},
+			{Title: "Value", Width: 35},
+			{Title: "Changed", Width: 16},
+			{Title: "Note", Width: 20},
+		}),
+		table.WithRows([]table.Row{}),
+		table.WithHeight(10),
+	)
+
 	keyInput := textinput.New()
 	keyInput.Prompt = "Enter Key: "
 	keyInput.Width = 20
@@ -85,15 +398,31 @@ func initialEntryDetailsModel(db *bolt.DB, cipherKey32, cipherKey64 []byte) Deta
 	valueInput.Prompt = "Enter your value: "
 	valueInput.Width = 20
 
+	valueArea := textarea.New()
+	valueArea.Placeholder = "Enter your value"
+	valueArea.ShowLineNumbers = false
+	valueArea.CharLimit = 0
+	valueArea.SetWidth(70)
+	valueArea.SetHeight(8)
+
+	noteInput := textinput.New()
+	noteInput.Prompt = "Note (optional): "
+	noteInput.Width = 20
+
 	return DetailsModel{
 		tableView:   t,
+		historyView: historyView,
 		keyInput:    keyInput,
 		valueInput:  valueInput,
+		valueArea:   valueArea,
+		noteInput:   noteInput,
 		help:        help.New(),
 		Entry:       "",
-		db:          db,
+		store:       store,
+		username:    username,
 		cipherKey32: cipherKey32,
 		cipherKey64: cipherKey64,
+		audit:       audit,
 	}
 }
 
@@ -107,79 +436,139 @@ func (m DetailsModel) Update(msg tea.Msg) (DetailsModel, tea.Cmd) {
 	kb := keybindings()
 
 	switch msg := msg.(type) {
+	case editorMsg:
+		if msg.Err != nil {
+			m.message = fmt.Sprintf("Editor failed: %v", msg.Err)
+			m.messageErr = true
+			return m, nil
+		}
+		if !m.multiline {
+			m.toggleMultiline()
+		}
+		m.valueArea.SetValue(msg.Value)
+		m.message = ""
+		return m, nil
 	case tea.KeyMsg:
 		switch {
-		case key.Matches(msg, kb.Quit):
+		case key.Matches(msg, kb.Quit) && !m.typing():
 			return m, tea.Quit
+		case key.Matches(msg, kb.Submit):
+			if m.editingValue() {
+				m.submitValue(m.editingKey())
+				return m, nil
+			}
+		case key.Matches(msg, kb.Expand):
+			if m.editingValue() {
+				return m, m.toggleMultiline()
+			}
+		case key.Matches(msg, kb.Editor):
+			if m.editingValue() {
+				return m, openEditor(m.value())
+			}
 		case key.Matches(msg, kb.Escape):
 			if m.state == tableDetails {
+				m.message = ""
 				return m, func() tea.Msg {
 					return returnEntryMsg{}
 				}
 			} else {
-				m.keyInput.Reset()
-				m.valueInput.Reset()
-				m.keyInput.Blur()
-				m.valueInput.Blur()
-				m.tableView.Focus()
-				m.state = tableDetails
+				m.resetInputs()
 			}
 		case key.Matches(msg, kb.Enter):
+			if m.valueArea.Focused() {
+				break
+			}
 			if m.state == addDetails {
 				if m.keyInput.Focused() {
-					m.keyInput.Blur()
-					m.valueInput.Focus()
-				} else if m.valueInput.Focused() {
 					keyEntry := m.keyInput.Value()
-					value := m.valueInput.Value()
-					cipherValue, err := cipher.EncryptAESGCM(m.cipherKey32, []byte(value))
+					if keyEntry == "" {
+						m.message = "Key cannot be empty"
+						m.messageErr = true
+						return m, nil
+					}
+					exists, err := database.KeyExists(m.store, []byte(m.Entry), []byte(keyEntry))
 					if err != nil {
 						return m, func() tea.Msg {
 							return errMsg{Err: err}
 						}
 					}
-					if err = database.Insert(m.db, []byte(m.Entry), []byte(keyEntry), cipherValue); err != nil {
+					m.message = ""
+					m.keyInput.Blur()
+					if exists {
+						m.state = overwriteDetails
+						return m, nil
+					}
+					return m, m.editValue(keyEntry, "")
+				} else if m.valueInput.Focused() {
+					m.submitValue(m.keyInput.Value())
+				} else if m.noteInput.Focused() {
+					var err error
+					m, err = m.storeField(m.keyInput.Value(), m.value(), m.noteInput.Value())
+					if err != nil {
 						return m, func() tea.Msg {
 							return errMsg{Err: err}
 						}
 					}
-					rows := m.tableView.Rows()
-					rows = append(rows, table.Row{
-						keyEntry,
-						value,
-					})
-					m.tableView.SetRows(rows)
-					m.keyInput.Reset()
-					m.keyInput.Blur()
-					m.valueInput.Reset()
-					m.valueInput.Blur()
-					m.tableView.Focus()
-					m.state = tableDetails
+					m.resetInputs()
 				}
 			} else if m.state == updateDetails {
-				keyEntry := m.tableView.SelectedRow()[0]
-				value := m.valueInput.Value()
-				cipherValue, err := cipher.EncryptAESGCM(m.cipherKey32, []byte(value))
-				if err != nil {
-					return m, func() tea.Msg {
-						return errMsg{Err: err}
+				if m.valueInput.Focused() {
+					m.submitValue(m.tableView.SelectedRow()[0])
+				} else if m.noteInput.Focused() {
+					var err error
+					m, err = m.storeField(m.tableView.SelectedRow()[0], m.value(), m.noteInput.Value())
+					if err != nil {
+						return m, func() tea.Msg {
+							return errMsg{Err: err}
+						}
 					}
+					m.resetInputs()
 				}
-				if err = database.Insert(m.db, []byte(m.Entry), []byte(keyEntry), cipherValue); err != nil {
-					return m, func() tea.Msg {
-						return errMsg{Err: err}
+			} else if m.state == renameDetails {
+				index := m.tableView.Cursor()
+				keyEntry := m.fields[index].key
+				newKey := m.keyInput.Value()
+				if newKey != "" && newKey != keyEntry {
+					err := m.store.RenameKey([]byte(m.Entry), []byte(keyEntry), []byte(newKey))
+					if errors.Is(err, database.ErrExists) {
+						m.message = fmt.Sprintf("Key \"%s\" already exists", newKey)
+						m.messageErr = true
+						return m, nil
+					}
+					if err == nil {
+						err = m.audit.Log(auditlog.Rename, m.Entry, keyEntry, fmt.Sprintf("to \"%s\"", newKey))
+					}
+					if err != nil {
+						return m, func() tea.Msg {
+							return errMsg{Err: err}
+						}
 					}
+					m.fields[index].key = newKey
+					m.refreshRows()
+					m.message = fmt.Sprintf("Renamed \"%s\" to \"%s\"", keyEntry, newKey)
+					m.messageErr = false
 				}
-				rows := m.tableView.Rows()
-				index := m.tableView.Cursor()
-				rows[index][1] = value
-				m.tableView.SetRows(rows)
-				m.keyInput.Reset()
-				m.keyInput.Blur()
-				m.valueInput.Reset()
-				m.valueInput.Blur()
-				m.tableView.Focus()
-				m.state = tableDetails
+				m.resetInputs()
+				return m, nil
+			} else if m.state == historyDetails {
+				index := m.historyView.Cursor()
+				if index >= 0 && index < len(m.versions) {
+					keyEntry := m.tableView.SelectedRow()[0]
+					err := database.RestoreVersion(m.store, m.cipherKey32, []byte(m.Entry), []byte(keyEntry), m.versions[index], m.username)
+					if err == nil {
+						err = m.audit.Log(auditlog.Restore, m.Entry, keyEntry, "previous version")
+					}
+					if err == nil {
+						m, err = m.setTableRows()
+					}
+					if err != nil {
+						return m, func() tea.Msg {
+							return errMsg{Err: err}
+						}
+					}
+				}
+				m.resetInputs()
+				return m, nil
 			}
 		case key.Matches(msg, kb.Add):
 			if m.state == tableDetails {
@@ -191,8 +580,130 @@ func (m DetailsModel) Update(msg tea.Msg) (DetailsModel, tea.Cmd) {
 		case key.Matches(msg, kb.Update):
 			if m.state == tableDetails && m.selectBoundsCheck() {
 				m.tableView.Blur()
-				m.valueInput.Focus()
 				m.state = updateDetails
+				f := m.fields[m.tableView.Cursor()]
+				return m, m.editValue(f.key, f.value)
+			} else if m.state == overwriteDetails {
+				keyEntry := m.keyInput.Value()
+				index := slices.IndexFunc(m.fields, func(f field) bool {
+					return f.key == keyEntry
+				})
+				if index < 0 {
+					var err error
+					if m, err = m.setTableRows(); err != nil {
+						return m, func() tea.Msg {
+							return errMsg{Err: err}
+						}
+					}
+					index = slices.IndexFunc(m.fields, func(f field) bool {
+						return f.key == keyEntry
+					})
+				}
+				if index >= 0 {
+					m.tableView.SetCursor(index)
+					m.keyInput.Reset()
+					m.state = updateDetails
+					return m, m.editValue(keyEntry, m.fields[index].value)
+				}
+				return m, nil
+			}
+		case key.Matches(msg, kb.Rename):
+			if m.state == tableDetails && m.selectBoundsCheck() {
+				m.tableView.Blur()
+				m.keyInput.SetValue(m.tableView.SelectedRow()[0])
+				m.keyInput.Focus()
+				m.state = renameDetails
+				return m, nil
+			}
+		case key.Matches(msg, kb.Undo):
+			if m.state == tableDetails {
+				return m, func() tea.Msg {
+					return undoMsg{}
+				}
+			}
+		case key.Matches(msg, kb.History):
+			if m.state == tableDetails && m.selectBoundsCheck() {
+				var err error
+				if m, err = m.openHistory(); err != nil {
+					return m, func() tea.Msg {
+						return errMsg{Err: err}
+					}
+				}
+				m.tableView.Blur()
+				m.historyView.Focus()
+				m.state = historyDetails
+				return m, nil
+			}
+		case key.Matches(msg, kb.Reveal):
+			if m.state == tableDetails || m.state == historyDetails {
+				m.reveal = !m.reveal
+				if m.reveal {
+					if err := m.audit.Log(auditlog.Reveal, m.Entry, "", ""); err != nil {
+						return m, func() tea.Msg {
+							return errMsg{Err: err}
+						}
+					}
+				}
+				m.refreshRows()
+				if m.state == historyDetails {
+					var err error
+					if m, err = m.openHistory(); err != nil {
+						return m, func() tea.Msg {
+							return errMsg{Err: err}
+						}
+					}
+				}
+				return m, nil
+			}
+		case key.Matches(msg, kb.Copy):
+			if m.state == tableDetails && m.selectBoundsCheck() {
+				f := m.fields[m.tableView.Cursor()]
+				if err := clipboard.WriteAll(f.value); err != nil {
+					m.message = fmt.Sprintf("Could not copy to the clipboard: %v", err)
+					m.messageErr = true
+					return m, nil
+				}
+				if err := m.audit.Log(auditlog.Copy, m.Entry, f.key, ""); err != nil {
+					return m, func() tea.Msg {
+						return errMsg{Err: err}
+					}
+				}
+				m.message = fmt.Sprintf("Copied \"%s\" to the clipboard", f.key)
+				if settings.Clipboard.Timeout > 0 {
+					m.message += fmt.Sprintf(", clearing it in %s", settings.Clipboard.Timeout)
+				}
+				m.messageErr = false
+				return m, func() tea.Msg {
+					return copiedMsg{Value: f.value}
+				}
+			}
+		case key.Matches(msg, kb.Generate):
+			if m.editingValue() {
+				password, err := generator.Generate(settings.Generator)
+				if err != nil {
+					m.message = err.Error()
+					m.messageErr = true
+					return m, nil
+				}
+				if m.multiline {
+					m.valueArea.InsertString(password)
+				} else {
+					m.valueInput.SetValue(password)
+				}
+				m.message = fmt.Sprintf("Generated a %d character password", len(password))
+				m.messageErr = false
+				return m, nil
+			}
+		case key.Matches(msg, kb.Files):
+			if m.state == tableDetails {
+				return m, func() tea.Msg {
+					return openAttachmentsMsg{Entry: m.Entry}
+				}
+			}
+		case key.Matches(msg, kb.Sort):
+			if m.state == tableDetails {
+				m.sortOrder = (m.sortOrder + 1) % 3
+				m.refreshRows()
 				return m, nil
 			}
 		case key.Matches(msg, kb.Remove):
@@ -201,21 +712,46 @@ func (m DetailsModel) Update(msg tea.Msg) (DetailsModel, tea.Cmd) {
 				m.state = removeDetails
 			}
 		case key.Matches(msg, kb.Confirm):
+			if m.state == overwriteDetails {
+				m.state = addDetails
+				return m, m.editValue(m.keyInput.Value(), "")
+			}
 			if m.state == removeDetails {
 				entry := m.tableView.SelectedRow()[0]
-				if err := database.Remove(m.db, []byte(m.Entry), []byte(entry)); err != nil {
+				id, err := m.store.Remove([]byte(m.Entry), []byte(entry))
+				if err == nil {
+					err = m.audit.Log(auditlog.Remove, m.Entry, entry, "moved to trash")
+				}
+				if err != nil {
 					return m, func() tea.Msg {
 						return errMsg{Err: err}
 					}
 				}
 				index := m.tableView.Cursor()
-				m.tableView.SetRows(slices.Delete(m.tableView.Rows(), index, index+1))
+				m.fields = slices.Delete(m.fields, index, index+1)
+				m.refreshRows()
+				if err := m.touchEntry(); err != nil {
+					return m, func() tea.Msg {
+						return errMsg{Err: err}
+					}
+				}
+				m.message = fmt.Sprintf("Moved key \"%s\" to trash, press z to undo", entry)
+				m.messageErr = false
+				m.tableView.Focus()
+				m.state = tableDetails
+				return m, func() tea.Msg {
+					return deletedMsg{ID: id}
+				}
 			}
 			fallthrough
 		case key.Matches(msg, kb.Cancel):
 			if m.state == removeDetails {
 				m.tableView.Focus()
 				m.state = tableDetails
+			} else if m.state == overwriteDetails {
+				m.keyInput.Focus()
+				m.state = addDetails
+				return m, nil
 			}
 		}
 	}
@@ -227,33 +763,96 @@ func (m DetailsModel) Update(msg tea.Msg) (DetailsModel, tea.Cmd) {
 		commands = append(commands, cmd)
 		m.valueInput, cmd = m.valueInput.Update(msg)
 		commands = append(commands, cmd)
+		m.valueArea, cmd = m.valueArea.Update(msg)
+		commands = append(commands, cmd)
+		m.noteInput, cmd = m.noteInput.Update(msg)
+		commands = append(commands, cmd)
+	} else if m.state == renameDetails {
+		m.keyInput, cmd = m.keyInput.Update(msg)
+		commands = append(commands, cmd)
+	} else if m.state == historyDetails {
+		m.historyView, cmd = m.historyView.Update(msg)
+		commands = append(commands, cmd)
 	} else if m.state == updateDetails {
 		m.valueInput, cmd = m.valueInput.Update(msg)
 		commands = append(commands, cmd)
+		m.valueArea, cmd = m.valueArea.Update(msg)
+		commands = append(commands, cmd)
+		m.noteInput, cmd = m.noteInput.Update(msg)
+		commands = append(commands, cmd)
 	}
 
 	return m, tea.Batch(commands...)
 }
 
+// valueView renders the editor in use for the value, with the keys that
+// switch between them.
+func (m DetailsModel) valueView() string {
+	kb := keybindings()
+	if !m.multiline {
+		return m.valueInput.View() + "\n" + keyHints(keyHint(kb.Expand, "multi-line"), keyHint(kb.Generate, "generate"), keyHint(kb.Editor, "$EDITOR"))
+	}
+	return m.valueArea.View() + "\n" + keyHints(keyHint(kb.Submit, "done"), keyHint(kb.Expand, "single line"), keyHint(kb.Generate, "generate"), keyHint(kb.Editor, "$EDITOR"))
+}
+
 func (m DetailsModel) View() string {
+	return m.viewPane() + fmt.Sprintf("\n\n%s\n", helpView(m.help))
+}
+
+// viewPane renders the model without the help line, so that it can be shown
+// next to the entry list.
+func (m DetailsModel) viewPane() string {
+	if m.Entry == "" {
+		return "No entry selected"
+	}
 	s := fmt.Sprintf("Entry: %s\n\n", m.Entry)
 	s += m.tableView.View()
 
 	switch m.state {
 	case addDetails:
 		s += fmt.Sprintf("\n\n%s", m.keyInput.View())
-		s += fmt.Sprintf("\n%s", m.valueInput.View())
+		s += fmt.Sprintf("\n%s", m.valueView())
+		s += fmt.Sprintf("\n%s", m.noteInput.View())
 	case updateDetails:
-		s += fmt.Sprintf("\n\n%s", m.valueInput.View())
+		s += fmt.Sprintf("\n\n%s", m.valueView())
+		s += fmt.Sprintf("\n%s", m.noteInput.View())
 	case removeDetails:
 		row := m.tableView.SelectedRow()
 		s += fmt.Sprintf("\n\nDelete Key: %s, Value: %s?\n", row[0], row[1])
-		s += fmt.Sprintf("[y] Yes  [n] No\n\n")
+		s += confirmHint() + "\n\n"
+	case overwriteDetails:
+		s += fmt.Sprintf("\n\nKey \"%s\" already exists.\n", m.keyInput.Value())
+		kb := keybindings()
+		s += keyHints(keyHint(kb.Confirm, "Overwrite"), keyHint(kb.Update, "Update existing"), keyHint(kb.Cancel, "Choose another key")) + "\n\n"
+	case renameDetails:
+		s += fmt.Sprintf("\n\nRename Key: %s", m.tableView.SelectedRow()[0])
+		s += fmt.Sprintf("\n%s", m.keyInput.View())
+	case historyDetails:
+		s += fmt.Sprintf("\n\nHistory of %s\n", m.tableView.SelectedRow()[0])
+		s += m.historyView.View()
+		if len(m.versions) == 0 {
+			s += "\nNo previous versions"
+		}
+		kb := keybindings()
+		s += "\n" + keyHints(keyHint(kb.Enter, "Restore"), keyHint(kb.Escape, "Back"))
 	case tableDetails:
+		if m.selectBoundsCheck() {
+			f := m.fields[m.tableView.Cursor()]
+			if f.metadata.ChangedBy != "" || f.metadata.Note != "" {
+				s += fmt.Sprintf("\n\nChanged by: %s  Note: %s", f.metadata.ChangedBy, f.metadata.Note)
+			}
+			if value := m.display(f.key, f.value); value != f.value && value != maskedValue {
+				s += fmt.Sprintf("\n\n%s", detailPaneStyle.Render(f.value))
+			}
+		}
 	default:
 	}
 
-	s += fmt.Sprintf("\n\n%s\n", m.help.View(keybindings()))
+	if m.message == "" && m.damaged > 0 {
+		s += messageView(damagedMessage(m.damaged), true)
+	} else {
+		s += messageView(m.message, m.messageErr)
+	}
 
 	return s
 }
@@ -1,79 +1,255 @@
 package model
 
 import (
+	"errors"
 	"fmt"
-	"slices"
+	"strings"
 
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
 	"github.com/AdityaKK0407/sentryvault/internal/database"
+	"github.com/AdityaKK0407/sentryvault/internal/templates"
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
-	bolt "go.etcd.io/bbolt"
 )
 
 type entryListState uint8
 
 const (
 	tableEntry entryListState = iota
+	pickType
 	addEntry
 	removeEntry
+	renameEntry
+	tagEntry
+	filterEntry
 )
 
 type EntryModel struct {
 	tableView   table.Model
+	typeView    table.Model
+	newType     string
 	inputField  textinput.Model
+	renameInput textinput.Model
+	tagInput    textinput.Model
+	filterInput textinput.Model
 	help        help.Model
 	state       entryListState
-	db          *bolt.DB
+	entries     map[string]database.EntryMetadata
+	nodes       []treeNode
+	collapsed   map[string]bool
+	tagFilter   string
+	store       database.VaultStore
+	cipherKey32 []byte
 	cipherKey64 []byte
+	audit       auditlog.Logger
 	message     string
 	messageErr  bool
+	// damaged counts the entries whose metadata cannot be decrypted, they
+	// are shown at the top level.
+	damaged int
 }
 
 func (m EntryModel) selectBoundsCheck() bool {
-	if m.tableView.Cursor() >= 0 && m.tableView.Cursor() < len(m.tableView.Rows()) {
+	if m.tableView.Cursor() >= 0 && m.tableView.Cursor() < len(m.nodes) {
 		return true
 	}
 	return false
 }
 
-func initialEntryListModel(db *bolt.DB, cipherKey64 []byte) EntryModel {
-	cols := []table.Column{
-		{Title: "Entries", Width: 50},
+func (m EntryModel) selectedNode() (treeNode, bool) {
+	if !m.selectBoundsCheck() {
+		return treeNode{}, false
 	}
+	return m.nodes[m.tableView.Cursor()], true
+}
+
+func (m EntryModel) selectedEntry() (treeNode, bool) {
+	node, ok := m.selectedNode()
+	return node, ok && !node.isFolder()
+}
 
-	entries, err := database.GetEntries(db)
+func (m EntryModel) setTableRows() (EntryModel, error) {
+	pairs, err := m.store.GetEntriesMetadata()
 	if err != nil {
-		return EntryModel{}
+		return m, err
+	}
+
+	entries := map[string]database.EntryMetadata{}
+	m.damaged = 0
+	for _, pair := range pairs {
+		metadata, err := database.OpenEntryMetadata(m.cipherKey32, pair[1])
+		if err != nil {
+			metadata = database.EntryMetadata{}
+			m.damaged++
+		}
+		entries[string(pair[0])] = metadata
 	}
+	m.entries = entries
+	m.refreshRows()
+	return m, nil
+}
 
+func (m *EntryModel) refreshRows() {
 	var rows []table.Row
-	for _, entry := range entries {
-		rows = append(rows, table.Row{string(entry)})
+	m.nodes, rows = buildTree(m.entries, m.collapsed, m.tagFilter)
+	setRows(&m.tableView, rows)
+}
+
+// createEntry creates an entry of the given type, pre-populated with the
+// empty fields of its template.
+func (m EntryModel) createEntry(folder, entry, typ string) error {
+	metadata := database.NewEntryMetadata()
+	metadata.Folder = folder
+	metadata.Type = typ
+	cipherMetadata, err := metadata.Seal(m.cipherKey32)
+	if err != nil {
+		return err
+	}
+	err = m.store.CreateEntry([]byte(entry), cipherMetadata)
+	if errors.Is(err, database.ErrExists) {
+		return database.NameTaken(m.store, m.cipherKey32, folder, entry)
+	}
+	if err != nil {
+		return err
+	}
+
+	t, _ := templates.Lookup(typ)
+	for _, f := range t.Fields {
+		cipherValue, err := cipher.EncryptAESGCM(m.cipherKey32, []byte{})
+		if err != nil {
+			return err
+		}
+		cipherFieldMetadata, err := database.NewFieldMetadata("", "").Seal(m.cipherKey32)
+		if err != nil {
+			return err
+		}
+		if err = m.store.Insert([]byte(entry), []byte(f.Key), cipherValue, cipherFieldMetadata); err != nil {
+			return err
+		}
+	}
+	detail := "new entry"
+	if typ != templates.Custom {
+		detail = fmt.Sprintf("new %s entry", typ)
+	}
+	return m.audit.Log(auditlog.Insert, database.JoinEntryPath(folder, entry), "", detail)
+}
+
+// selectedFolder is the folder new entries are added to, taken from the
+// selected row.
+func (m EntryModel) selectedFolder() string {
+	node, ok := m.selectedNode()
+	if !ok {
+		return ""
+	}
+	return node.folder
+}
+
+// setSize fits the table and inputs into the given width and height.
+func (m *EntryModel) setSize(width, height int) {
+	fitColumns(&m.tableView, width, true, 0, 2)
+	m.tableView.SetHeight(tableHeight(height))
+	for _, input := range []*textinput.Model{&m.inputField, &m.renameInput, &m.tagInput, &m.filterInput} {
+		input.Width = inputWidth(width, input.Prompt)
+	}
+	m.help.Width = width
+}
+
+// typing reports whether one of the inputs has focus, when keys go to the
+// input rather than to the bindings.
+func (m EntryModel) typing() bool {
+	switch m.state {
+	case addEntry, renameEntry, tagEntry, filterEntry:
+		return true
+	}
+	return false
+}
+
+func (m *EntryModel) resetInputs() {
+	m.typeView.Blur()
+	m.newType = templates.Custom
+	m.inputField.Reset()
+	m.inputField.Blur()
+	m.renameInput.Reset()
+	m.renameInput.Blur()
+	m.tagInput.Reset()
+	m.tagInput.Blur()
+	m.filterInput.Reset()
+	m.filterInput.Blur()
+	m.tableView.Focus()
+	m.state = tableEntry
+}
+
+func initialEntryListModel(store database.VaultStore, audit auditlog.Logger, cipherKey32, cipherKey64 []byte) EntryModel {
+	cols := []table.Column{
+		{Title: "Entries", Width: 40},
+		{Title: "Type", Width: 12},
+		{Title: "Tags", Width: 25},
 	}
 
 	t := table.New(
+		table.WithKeyMap(tableKeyMap()),
+		table.WithStyles(tableStyles()),
 		table.WithColumns(cols),
-		table.WithRows(rows),
+		table.WithRows([]table.Row{}),
 		table.WithHeight(10),
 		table.WithFocused(true),
 	)
 	t.Focus()
 
+	typeRows := []table.Row{{"Custom"}}
+	for _, t := range templates.Templates {
+		typeRows = append(typeRows, table.Row{t.Name})
+	}
+	typeView := table.New(
+		table.WithKeyMap(tableKeyMap()),
+		table.WithStyles(tableStyles()),
+		table.WithColumns([]table.Column{{Title: "Entry Type", Width: 30}}),
+		table.WithRows(typeRows),
+		table.WithHeight(len(typeRows)+1),
+	)
+
 	input := textinput.New()
 	input.Width = 50
 	input.Prompt = "Entry Name: "
+	input.Placeholder = "folder/name"
+
+	renameInput := textinput.New()
+	renameInput.Width = 50
+	renameInput.Prompt = "New Name: "
+
+	tagInput := textinput.New()
+	tagInput.Width = 50
+	tagInput.Prompt = "Tags: "
+	tagInput.Placeholder = "comma separated"
 
-	return EntryModel{
+	filterInput := textinput.New()
+	filterInput.Width = 50
+	filterInput.Prompt = "Filter by tag: "
+	filterInput.Placeholder = "empty to show all"
+
+	m, err := EntryModel{
 		tableView:   t,
+		typeView:    typeView,
 		inputField:  input,
+		renameInput: renameInput,
+		tagInput:    tagInput,
+		filterInput: filterInput,
 		help:        help.New(),
 		state:       tableEntry,
-		db:          db,
+		collapsed:   map[string]bool{},
+		store:       store,
+		cipherKey32: cipherKey32,
 		cipherKey64: cipherKey64,
+		audit:       audit,
+	}.setTableRows()
+	if err != nil {
+		return EntryModel{}
 	}
+	return m
 }
 
 func (m EntryModel) Init() tea.Cmd {
@@ -88,68 +264,220 @@ func (m EntryModel) Update(msg tea.Msg) (EntryModel, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
 		switch {
-		case key.Matches(msg, kb.Quit):
+		case key.Matches(msg, kb.Quit) && !m.typing():
 			return m, tea.Quit
 		case key.Matches(msg, kb.Escape):
-			m.inputField.Reset()
-			m.inputField.Blur()
-			m.tableView.Focus()
-			m.state = tableEntry
+			m.resetInputs()
 		case key.Matches(msg, kb.Enter):
 			switch {
 			case m.tableView.Focused():
-				if m.selectBoundsCheck() {
-					row := m.tableView.SelectedRow()
-					return m, func() tea.Msg {
-						return selectEntryMsg{Entry: row[0]}
-					}
-				} else {
+				node, ok := m.selectedNode()
+				if !ok {
 					m.message = "Invalid Row selected"
 					m.messageErr = true
+				} else if node.isFolder() {
+					m.collapsed[node.folder] = !m.collapsed[node.folder]
+					m.refreshRows()
+				} else {
+					return m, func() tea.Msg {
+						return selectEntryMsg{Entry: node.entry}
+					}
+				}
+			case m.typeView.Focused():
+				if index := m.typeView.Cursor(); index > 0 {
+					m.newType = templates.Templates[index-1].Type
 				}
+				m.typeView.Blur()
+				m.inputField.Focus()
+				m.state = addEntry
+				return m, nil
 			case m.inputField.Focused():
-				entry := m.inputField.Value()
+				folder, entry := database.SplitEntryPath(m.inputField.Value())
 				if entry != "" {
-					if err := database.CreateEntry(m.db, []byte(entry)); err != nil {
+					newType := m.newType
+					err := m.createEntry(folder, entry, newType)
+					if errors.Is(err, database.ErrExists) {
+						m.message = err.Error()
+						m.messageErr = true
+						return m, nil
+					}
+					if err == nil {
+						m, err = m.setTableRows()
+					}
+					if err != nil {
 						return m, func() tea.Msg {
 							return errMsg{Err: err}
 						}
 					}
-					rows := m.tableView.Rows()
-					rows = append(rows, table.Row{entry})
-					m.tableView.SetRows(rows)
-					m.tableView.Focus()
-					m.inputField.Blur()
-					m.inputField.Reset()
-					m.state = tableEntry
-					m.message = fmt.Sprintf("New Entry \"%s\" added", entry)
+					m.resetInputs()
+					m.message = fmt.Sprintf("New Entry \"%s\" added", database.JoinEntryPath(folder, entry))
 					m.messageErr = false
+					if newType != templates.Custom {
+						return m, func() tea.Msg {
+							return selectEntryMsg{Entry: entry}
+						}
+					}
 				}
+			case m.renameInput.Focused():
+				node, _ := m.selectedEntry()
+				newFolder, newEntry := database.SplitEntryPath(m.renameInput.Value())
+				if newEntry != "" {
+					if newEntry != node.entry {
+						err := m.store.RenameEntry([]byte(node.entry), []byte(newEntry))
+						if errors.Is(err, database.ErrExists) {
+							m.message = database.NameTaken(m.store, m.cipherKey32, newFolder, newEntry).Error()
+							m.messageErr = true
+							return m, nil
+						}
+						if err != nil {
+							return m, func() tea.Msg {
+								return errMsg{Err: err}
+							}
+						}
+					}
+					if newFolder != node.folder {
+						err := database.UpdateEntryMetadata(m.store, m.cipherKey32, []byte(newEntry), func(metadata *database.EntryMetadata) {
+							metadata.Folder = newFolder
+						})
+						if err != nil {
+							return m, func() tea.Msg {
+								return errMsg{Err: err}
+							}
+						}
+					}
+					var err error
+					if newEntry != node.entry || newFolder != node.folder {
+						err = m.audit.Log(auditlog.Rename, database.JoinEntryPath(node.folder, node.entry), "", "to "+database.JoinEntryPath(newFolder, newEntry))
+					}
+					if err == nil {
+						m, err = m.setTableRows()
+					}
+					if err != nil {
+						return m, func() tea.Msg {
+							return errMsg{Err: err}
+						}
+					}
+					m.message = fmt.Sprintf("Renamed \"%s\" to \"%s\"", database.JoinEntryPath(node.folder, node.entry), database.JoinEntryPath(newFolder, newEntry))
+					m.messageErr = false
+				}
+				m.resetInputs()
+			case m.tagInput.Focused():
+				node, _ := m.selectedEntry()
+				tags := database.ParseTags(m.tagInput.Value())
+				err := database.UpdateEntryMetadata(m.store, m.cipherKey32, []byte(node.entry), func(metadata *database.EntryMetadata) {
+					metadata.Tags = tags
+				})
+				if err == nil {
+					m, err = m.setTableRows()
+				}
+				if err != nil {
+					return m, func() tea.Msg {
+						return errMsg{Err: err}
+					}
+				}
+				m.resetInputs()
+			case m.filterInput.Focused():
+				m.tagFilter = strings.TrimSpace(m.filterInput.Value())
+				m.refreshRows()
+				m.tableView.SetCursor(0)
+				m.resetInputs()
 			}
 		case key.Matches(msg, kb.Add):
 			if m.state == tableEntry {
 				m.tableView.Blur()
-				m.inputField.Focus()
-				m.state = addEntry
+				if folder := m.selectedFolder(); folder != "" {
+					m.inputField.SetValue(folder + "/")
+				}
+				m.typeView.SetCursor(0)
+				m.typeView.Focus()
+				m.state = pickType
+				return m, nil
+			}
+		case key.Matches(msg, kb.Rename):
+			if node, ok := m.selectedEntry(); m.state == tableEntry && ok {
+				m.tableView.Blur()
+				m.renameInput.SetValue(database.JoinEntryPath(node.folder, node.entry))
+				m.renameInput.Focus()
+				m.state = renameEntry
+				return m, nil
+			}
+		case key.Matches(msg, kb.Tags):
+			if node, ok := m.selectedEntry(); m.state == tableEntry && ok {
+				m.tableView.Blur()
+				m.tagInput.SetValue(strings.Join(m.entries[node.entry].Tags, ", "))
+				m.tagInput.Focus()
+				m.state = tagEntry
+				return m, nil
+			}
+		case key.Matches(msg, kb.Filter):
+			if m.state == tableEntry {
+				m.tableView.Blur()
+				m.filterInput.SetValue(m.tagFilter)
+				m.filterInput.Focus()
+				m.state = filterEntry
 				return m, nil
 			}
+		case key.Matches(msg, kb.Undo):
+			if m.state == tableEntry {
+				return m, func() tea.Msg {
+					return undoMsg{}
+				}
+			}
+		case key.Matches(msg, kb.Trash):
+			if m.state == tableEntry {
+				m.message = ""
+				return m, func() tea.Msg {
+					return openTrashMsg{}
+				}
+			}
+		case key.Matches(msg, kb.Health):
+			if m.state == tableEntry {
+				m.message = ""
+				return m, func() tea.Msg {
+					return openReportMsg{}
+				}
+			}
+		case key.Matches(msg, kb.AuditLog):
+			if m.state == tableEntry {
+				m.message = ""
+				return m, func() tea.Msg {
+					return openAuditLogMsg{}
+				}
+			}
+		case key.Matches(msg, kb.Vaults):
+			if m.state == tableEntry {
+				m.message = ""
+				return m, func() tea.Msg {
+					return openVaultsMsg{}
+				}
+			}
 		case key.Matches(msg, kb.Remove):
-			if m.state == tableEntry && m.selectBoundsCheck() {
+			if _, ok := m.selectedEntry(); m.state == tableEntry && ok {
 				m.tableView.Blur()
 				m.state = removeEntry
 			}
 		case key.Matches(msg, kb.Confirm):
 			if m.state == removeEntry {
-				entry := m.tableView.SelectedRow()[0]
-				if err := database.RemoveEntry(m.db, []byte(entry)); err != nil {
+				node, _ := m.selectedEntry()
+				id, err := m.store.RemoveEntry([]byte(node.entry))
+				if err == nil {
+					err = m.audit.Log(auditlog.Remove, database.JoinEntryPath(node.folder, node.entry), "", "moved to trash")
+				}
+				if err == nil {
+					m, err = m.setTableRows()
+				}
+				if err != nil {
 					return m, func() tea.Msg {
 						return errMsg{Err: err}
 					}
 				}
-				index := m.tableView.Cursor()
-				m.tableView.SetRows(slices.Delete(m.tableView.Rows(), index, index+1))
-				m.message = fmt.Sprintf("Removed entry \"%s\"", entry)
+				m.message = fmt.Sprintf("Moved entry \"%s\" to trash, press z to undo", node.entry)
 				m.messageErr = false
+				m.tableView.Focus()
+				m.state = tableEntry
+				return m, func() tea.Msg {
+					return deletedMsg{ID: id}
+				}
 			}
 			fallthrough
 		case key.Matches(msg, kb.Cancel):
@@ -160,36 +488,71 @@ func (m EntryModel) Update(msg tea.Msg) (EntryModel, tea.Cmd) {
 		}
 	}
 
-	if m.state == tableEntry {
+	switch m.state {
+	case tableEntry:
 		m.tableView, cmd = m.tableView.Update(msg)
 		commands = append(commands, cmd)
-	} else if m.state == addEntry {
+	case pickType:
+		m.typeView, cmd = m.typeView.Update(msg)
+		commands = append(commands, cmd)
+	case addEntry:
 		m.inputField, cmd = m.inputField.Update(msg)
 		commands = append(commands, cmd)
+	case renameEntry:
+		m.renameInput, cmd = m.renameInput.Update(msg)
+		commands = append(commands, cmd)
+	case tagEntry:
+		m.tagInput, cmd = m.tagInput.Update(msg)
+		commands = append(commands, cmd)
+	case filterEntry:
+		m.filterInput, cmd = m.filterInput.Update(msg)
+		commands = append(commands, cmd)
 	}
 	return m, tea.Batch(commands...)
 }
 
 func (m EntryModel) View() string {
+	return m.viewPane() + fmt.Sprintf("\n\n%s\n", helpView(m.help))
+}
+
+// viewPane renders the model without the help line, so that it can be shown
+// next to the details of the selected entry.
+func (m EntryModel) viewPane() string {
 	s := tableStyle.Render(m.tableView.View())
 
+	if m.tagFilter != "" {
+		s += fmt.Sprintf("\nFiltered by tag: %s", m.tagFilter)
+	}
+
+	node, _ := m.selectedNode()
 	switch m.state {
+	case pickType:
+		s += fmt.Sprintf("\n\n%s", m.typeView.View())
 	case addEntry:
+		if t, ok := templates.Lookup(m.newType); ok {
+			s += fmt.Sprintf("\n\nNew %s", t.Name)
+		}
 		s += fmt.Sprintf("\n\n%s", m.inputField.View())
+	case renameEntry:
+		s += fmt.Sprintf("\n\nRename Entry: %s", database.JoinEntryPath(node.folder, node.entry))
+		s += fmt.Sprintf("\n%s", m.renameInput.View())
+	case tagEntry:
+		s += fmt.Sprintf("\n\nTags of %s", node.entry)
+		s += fmt.Sprintf("\n%s", m.tagInput.View())
+	case filterEntry:
+		s += fmt.Sprintf("\n\n%s", m.filterInput.View())
 	case removeEntry:
-		s += fmt.Sprintf("\n\nDelete Entry: %s?\n", m.tableView.SelectedRow()[0])
-		s += fmt.Sprintf("[y] Yes  [n] No\n\n")
+		s += fmt.Sprintf("\n\nDelete Entry: %s?\n", node.entry)
+		s += confirmHint() + "\n\n"
 	case tableEntry:
 	default:
 	}
 
-	//if m.messageErr {
-	//	s += errMessageStyle.Render(m.message)
-	//} else {
-	//	s += successMessageStyle.Render(m.message)
-	//}
-
-	s += fmt.Sprintf("\n\n%s\n", m.help.View(keybindings()))
+	if m.message == "" && m.damaged > 0 {
+		s += messageView(damagedMessage(m.damaged), true)
+	} else {
+		s += messageView(m.message, m.messageErr)
+	}
 
 	return s
 }
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+	"github.com/AdityaKK0407/sentryvault/internal/templates"
+	"github.com/charmbracelet/bubbles/table"
+)
+
+// treeNode is one row of the entry tree, either a folder or an entry.
+type treeNode struct {
+	folder string
+	entry  string
+	depth  int
+}
+
+func (n treeNode) isFolder() bool {
+	return n.entry == ""
+}
+
+type folderNode struct {
+	name    string
+	path    string
+	folders map[string]*folderNode
+	entries []string
+}
+
+func newFolderNode(name, path string) *folderNode {
+	return &folderNode{name: name, path: path, folders: map[string]*folderNode{}}
+}
+
+// buildTree arranges entries by folder, skipping the contents of collapsed
+// folders and entries without the filter tag.
+func buildTree(entries map[string]database.EntryMetadata, collapsed map[string]bool, tagFilter string) ([]treeNode, []table.Row) {
+	root := newFolderNode("", "")
+	for entry, metadata := range entries {
+		if tagFilter != "" && !metadata.HasTag(tagFilter) {
+			continue
+		}
+		node := root
+		if metadata.Folder != "" {
+			for _, segment := range strings.Split(metadata.Folder, "/") {
+				child, ok := node.folders[segment]
+				if !ok {
+					child = newFolderNode(segment, database.JoinEntryPath(node.path, segment))
+					node.folders[segment] = child
+				}
+				node = child
+			}
+		}
+		node.entries = append(node.entries, entry)
+	}
+
+	var nodes []treeNode
+	var rows []table.Row
+	var walk func(node *folderNode, depth int)
+	walk = func(node *folderNode, depth int) {
+		indent := strings.Repeat("  ", depth)
+
+		var names []string
+		for name := range node.folders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			child := node.folders[name]
+			marker := "▾ "
+			if collapsed[child.path] {
+				marker = "▸ "
+			}
+			nodes = append(nodes, treeNode{folder: child.path, depth: depth})
+			rows = append(rows, table.Row{indent + marker + child.name + "/", "", ""})
+			if !collapsed[child.path] {
+				walk(child, depth+1)
+			}
+		}
+
+		sort.Strings(node.entries)
+		for _, entry := range node.entries {
+			nodes = append(nodes, treeNode{folder: node.path, entry: entry, depth: depth})
+			metadata := entries[entry]
+			rows = append(rows, table.Row{indent + entry, typeName(metadata.Type), strings.Join(metadata.Tags, ", ")})
+		}
+	}
+	walk(root, 0)
+	return nodes, rows
+}
+
+func typeName(typ string) string {
+	if t, ok := templates.Lookup(typ); ok {
+		return t.Name
+	}
+	return ""
+}
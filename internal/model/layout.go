@@ -0,0 +1,71 @@
+package model
+
+import (
+	"slices"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	// splitMinWidth is the terminal width from which the entry list and the
+	// details of the selected entry are shown side by side.
+	splitMinWidth = 140
+
+	// chromeHeight is the number of lines around a table taken up by titles,
+	// inputs, messages and help.
+	chromeHeight   = 14
+	minTableHeight = 5
+	minColumnWidth = 8
+)
+
+// paneGap separates the panes of the split layout.
+const paneGap = "  "
+
+// tableHeight returns the number of rows a table gets in a window of the
+// given height.
+func tableHeight(height int) int {
+	return max(minTableHeight, height-chromeHeight)
+}
+
+// fitColumns gives the columns at the given indexes an equal share of the
+// width left over by the other columns. Every column also takes two cells of
+// padding, and bordered tables two more for the border.
+func fitColumns(t *table.Model, width int, bordered bool, flexible ...int) {
+	cols := t.Columns()
+	free := width - 2*len(cols)
+	if bordered {
+		free -= 2
+	}
+	for i, col := range cols {
+		if !slices.Contains(flexible, i) {
+			free -= col.Width
+		}
+	}
+	share := max(minColumnWidth, free/len(flexible))
+	for _, i := range flexible {
+		cols[i].Width = share
+	}
+	// The last flexible column takes whatever the division left over
+	if rest := free - share*len(flexible); rest > 0 {
+		cols[flexible[len(flexible)-1]].Width += rest
+	}
+	t.SetColumns(cols)
+}
+
+// inputWidth returns the width of a text input with the given prompt so that
+// it fills a line of the given width.
+func inputWidth(width int, prompt string) int {
+	return max(minColumnWidth, width-len([]rune(prompt))-2)
+}
+
+// helpView renders the short help cut to the width of the window. The help
+// model stops truncating once its ellipsis no longer fits on the line.
+func helpView(h help.Model) string {
+	view := h.View(keybindings())
+	if h.Width > 0 {
+		view = lipgloss.NewStyle().MaxWidth(h.Width).Render(view)
+	}
+	return view
+}
@@ -1,9 +1,17 @@
 package model
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
 	tea "github.com/charmbracelet/bubbletea"
-	bolt "go.etcd.io/bbolt"
+	"github.com/charmbracelet/lipgloss"
 )
 
 type modelState uint8
@@ -11,14 +19,32 @@ type modelState uint8
 const (
 	EntryList modelState = iota
 	EntryDetails
+	TrashList
+	AttachmentList
+	VaultList
+	HealthReport
+	AuditLog
 )
 
 type MainModel struct {
 	state            modelState
 	entryListState   EntryModel
 	entryDetailState DetailsModel
-	db               *bolt.DB
+	trashState       TrashModel
+	attachmentState  AttachmentModel
+	vaultState       VaultModel
+	reportState      ReportModel
+	auditState       AuditModel
+	store            database.VaultStore
+	username         string
+	actor            string
 	cipherKey        []byte
+	lastDeleted      uint64
+	width            int
+	height           int
+	lastActivity     time.Time
+	copied           string
+	Locked           bool
 	Err              error
 }
 
@@ -28,33 +54,104 @@ type selectEntryMsg struct {
 
 type returnEntryMsg struct{}
 
+type openTrashMsg struct{}
+
+type openAttachmentsMsg struct {
+	Entry string
+}
+
+// deletedMsg reports an entry or field moved to the trash, so that it can be
+// restored with a single undo.
+type openVaultsMsg struct{}
+
+type openReportMsg struct{}
+
+type openAuditLogMsg struct{}
+
+// switchVaultMsg replaces the open vault with another one, already unlocked
+// by Actor.
+type switchVaultMsg struct {
+	Store     database.VaultStore
+	Username  string
+	Actor     string
+	CipherKey []byte
+}
+
+// deletedMsg reports an entry or field moved to the trash, so that it can be
+// restored with a single undo.
+type deletedMsg struct {
+	ID uint64
+}
+
+type undoMsg struct{}
+
+// copiedMsg reports a value copied to the clipboard, which is cleared again
+// once the clipboard timeout passes.
+type copiedMsg struct {
+	Value string
+}
+
+type clearClipboardMsg struct {
+	Value string
+}
+
+type lockCheckMsg struct{}
+
 type errMsg struct {
 	Err error
 }
 
-func InitialMainModel(db *bolt.DB, cipherKey32, cipherKey64 []byte) *MainModel {
+// InitialMainModel shows an unlocked vault. What is done in it is logged in
+// its audit log for actor, who unlocked it.
+func InitialMainModel(store database.VaultStore, username, actor string, cipherKey32, cipherKey64 []byte) *MainModel {
+	audit := auditlog.NewLogger(store, cipherKey32, actor)
 	return &MainModel{
 		state:            EntryList,
-		entryListState:   initialEntryListModel(db, cipherKey64),
-		entryDetailState: initialEntryDetailsModel(db, cipherKey32, cipherKey64),
-		db:               db,
+		entryListState:   initialEntryListModel(store, audit, cipherKey32, cipherKey64),
+		entryDetailState: initialEntryDetailsModel(store, username, audit, cipherKey32, cipherKey64),
+		trashState:       initialTrashModel(store, audit),
+		attachmentState:  initialAttachmentModel(store, username, audit, cipherKey32),
+		vaultState:       initialVaultModel(username),
+		reportState:      initialReportModel(store, audit, cipherKey32),
+		auditState:       initialAuditModel(store, cipherKey32),
+		store:            store,
+		username:         username,
+		actor:            actor,
 		cipherKey:        cipherKey32,
+		lastActivity:     time.Now(),
 		Err:              nil,
 	}
 }
 
 type KeyMap struct {
-	Up      key.Binding
-	Down    key.Binding
-	Enter   key.Binding
-	Tab     key.Binding
-	Add     key.Binding
-	Update  key.Binding
-	Remove  key.Binding
-	Escape  key.Binding
-	Confirm key.Binding
-	Cancel  key.Binding
-	Quit    key.Binding
+	Up       key.Binding
+	Down     key.Binding
+	Enter    key.Binding
+	Tab      key.Binding
+	Add      key.Binding
+	Update   key.Binding
+	Remove   key.Binding
+	Rename   key.Binding
+	Escape   key.Binding
+	Confirm  key.Binding
+	Cancel   key.Binding
+	Sort     key.Binding
+	History  key.Binding
+	Undo     key.Binding
+	Trash    key.Binding
+	Tags     key.Binding
+	Filter   key.Binding
+	Reveal   key.Binding
+	Copy     key.Binding
+	Generate key.Binding
+	Submit   key.Binding
+	Expand   key.Binding
+	Editor   key.Binding
+	Files    key.Binding
+	Vaults   key.Binding
+	Health   key.Binding
+	AuditLog key.Binding
+	Quit     key.Binding
 }
 
 func (k KeyMap) ShortHelp() []key.Binding {
@@ -65,6 +162,11 @@ func (k KeyMap) ShortHelp() []key.Binding {
 		k.Tab,
 		k.Add,
 		k.Remove,
+		k.Rename,
+		k.Sort,
+		k.History,
+		k.Trash,
+		k.Filter,
 		k.Escape,
 		k.Quit,
 	}
@@ -72,39 +174,109 @@ func (k KeyMap) ShortHelp() []key.Binding {
 
 func (k KeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.Up, k.Down, k.Enter, k.Add, k.Remove, k.Escape, k.Quit},
+		{k.Up, k.Down, k.Enter, k.Add, k.Update, k.Remove, k.Rename, k.Sort, k.History, k.Undo, k.Trash, k.Tags, k.Filter, k.Reveal, k.Copy, k.Generate, k.Files, k.Vaults, k.Health, k.AuditLog, k.Escape, k.Quit},
 	}
 }
 
+// keybindings returns the key map set up by Configure.
 func keybindings() KeyMap {
+	return keyMap
+}
+
+func newKeyMap(keys map[string][]string) KeyMap {
+	binding := func(action, desc string) key.Binding {
+		return key.NewBinding(key.WithKeys(keys[action]...), key.WithHelp(helpKeys(keys[action]), desc))
+	}
 	return KeyMap{
-		Up:      key.NewBinding(key.WithKeys("up"), key.WithHelp("↑", "up")),
-		Down:    key.NewBinding(key.WithKeys("down"), key.WithHelp("↓", "down")),
-		Enter:   key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "select")),
-		Tab:     key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "move back")),
-		Add:     key.NewBinding(key.WithKeys("a"), key.WithHelp("a", "add")),
-		Update:  key.NewBinding(key.WithKeys("u"), key.WithHelp("u", "update")),
-		Remove:  key.NewBinding(key.WithKeys("r"), key.WithHelp("r", "remove")),
-		Escape:  key.NewBinding(key.WithKeys("esc"), key.WithHelp("esc", "escape add/update/remove model")),
-		Confirm: key.NewBinding(key.WithKeys("y"), key.WithHelp("y", "confirm")),
-		Cancel:  key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "cancel")),
-		Quit:    key.NewBinding(key.WithKeys("q", "ctrl+c"), key.WithHelp("q", "quit")),
+		Up:       binding("up", "up"),
+		Down:     binding("down", "down"),
+		Enter:    binding("enter", "select"),
+		Tab:      binding("tab", "move back"),
+		Add:      binding("add", "add"),
+		Update:   binding("update", "update"),
+		Remove:   binding("remove", "remove"),
+		Rename:   binding("rename", "rename/move"),
+		Escape:   binding("escape", "escape add/update/remove model"),
+		Confirm:  binding("confirm", "confirm"),
+		Cancel:   binding("cancel", "cancel"),
+		Sort:     binding("sort", "sort by key/age"),
+		History:  binding("history", "history"),
+		Undo:     binding("undo", "undo delete"),
+		Trash:    binding("trash", "trash"),
+		Tags:     binding("tags", "tags"),
+		Filter:   binding("filter", "filter by tag"),
+		Reveal:   binding("reveal", "show/hide secrets"),
+		Copy:     binding("copy", "copy value"),
+		Generate: binding("generate", "generate password"),
+		Submit:   binding("submit", "finish multi-line value"),
+		Expand:   binding("expand", "toggle multi-line value"),
+		Editor:   binding("editor", "edit value in $EDITOR"),
+		Files:    binding("files", "attachments"),
+		Vaults:   binding("vaults", "switch vault"),
+		Health:   binding("health", "security report"),
+		AuditLog: binding("auditlog", "audit log"),
+		Quit:     binding("quit", "quit"),
 	}
 }
 
+// helpKeys shows the keys of a binding in help, leaving out ctrl+c which
+// always quits.
+func helpKeys(keys []string) string {
+	var shown []string
+	for _, k := range keys {
+		switch k {
+		case "up":
+			shown = append(shown, "↑")
+		case "down":
+			shown = append(shown, "↓")
+		case "ctrl+c":
+		default:
+			shown = append(shown, k)
+		}
+	}
+	return strings.Join(shown, "/")
+}
+
 func (m MainModel) Init() tea.Cmd {
 	return tea.Batch(
 		m.entryListState.Init(),
 		m.entryDetailState.Init(),
+		lockCheck(settings.Lock.Timeout),
 	)
 }
 
+// lockCheck checks for inactivity once after the given time.
+func lockCheck(after time.Duration) tea.Cmd {
+	if settings.Lock.Timeout == 0 {
+		return nil
+	}
+	return tea.Tick(after, func(time.Time) tea.Msg {
+		return lockCheckMsg{}
+	})
+}
+
+// ClearClipboard clears a value copied from the vault if it is still on the
+// clipboard. It is called when the program exits before the timeout passed.
+func (m MainModel) ClearClipboard() {
+	if m.copied == "" {
+		return
+	}
+	if current, err := clipboard.ReadAll(); err == nil && current == m.copied {
+		clipboard.WriteAll("")
+	}
+}
+
 func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.resize()
+		return m, m.preview()
 	case selectEntryMsg:
 		m.state = EntryDetails
 		m.entryDetailState.Entry = msg.Entry
+		m.entryDetailState.reveal = false
 		var err error
 		m.entryDetailState, err = m.entryDetailState.setTableRows()
 		if err != nil {
@@ -113,27 +285,260 @@ func (m MainModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 	case returnEntryMsg:
 		m.state = EntryList
+		var err error
+		if m.entryListState, err = m.entryListState.setTableRows(); err != nil {
+			m.Err = err
+			return m, tea.Quit
+		}
+		m.entryDetailState.clear()
+		return m, m.preview()
+	case openTrashMsg:
+		m.state = TrashList
+		var err error
+		if m.trashState, err = m.trashState.setTableRows(); err != nil {
+			m.Err = err
+			return m, tea.Quit
+		}
+	case openAttachmentsMsg:
+		m.state = AttachmentList
+		m.attachmentState.Entry = msg.Entry
+		var err error
+		if m.attachmentState, err = m.attachmentState.setTableRows(); err != nil {
+			m.Err = err
+			return m, tea.Quit
+		}
+	case openVaultsMsg:
+		m.state = VaultList
+		var err error
+		if m.vaultState, err = m.vaultState.setTableRows(); err != nil {
+			m.Err = err
+			return m, tea.Quit
+		}
+	case openReportMsg:
+		m.state = HealthReport
+		var err error
+		if m.reportState, err = m.reportState.setTableRows(); err != nil {
+			m.Err = err
+			return m, tea.Quit
+		}
+	case openAuditLogMsg:
+		m.state = AuditLog
+		var err error
+		if m.auditState, err = m.auditState.setTableRows(); err != nil {
+			m.Err = err
+			return m, tea.Quit
+		}
+	case switchVaultMsg:
+		return m.switchVault(msg)
+	case deletedMsg:
+		m.lastDeleted = msg.ID
+	case undoMsg:
+		return m.undo()
 	case errMsg:
 		m.Err = msg.Err
 		return m, tea.Quit
+	case editorMsg:
+		m.lastActivity = time.Now()
+		m.entryDetailState, cmd = m.entryDetailState.Update(msg)
+	case copiedMsg:
+		m.copied = msg.Value
+		if settings.Clipboard.Timeout > 0 {
+			return m, tea.Tick(settings.Clipboard.Timeout, func(time.Time) tea.Msg {
+				return clearClipboardMsg{Value: msg.Value}
+			})
+		}
+	case clearClipboardMsg:
+		if msg.Value == m.copied {
+			m.ClearClipboard()
+			m.copied = ""
+		}
+	case lockCheckMsg:
+		idle := time.Since(m.lastActivity)
+		if idle >= settings.Lock.Timeout {
+			m.Locked = true
+			return m, tea.Quit
+		}
+		return m, lockCheck(settings.Lock.Timeout - idle)
 	case tea.KeyMsg:
+		m.lastActivity = time.Now()
+		if msg.Type == tea.KeyCtrlC {
+			return m, tea.Quit
+		}
 		switch m.state {
 		case EntryList:
 			m.entryListState, cmd = m.entryListState.Update(msg)
+			cmd = tea.Batch(cmd, m.preview())
 		case EntryDetails:
 			m.entryDetailState, cmd = m.entryDetailState.Update(msg)
+		case TrashList:
+			m.trashState, cmd = m.trashState.Update(msg)
+		case AttachmentList:
+			m.attachmentState, cmd = m.attachmentState.Update(msg)
+		case VaultList:
+			m.vaultState, cmd = m.vaultState.Update(msg)
+		case HealthReport:
+			m.reportState, cmd = m.reportState.Update(msg)
+		case AuditLog:
+			m.auditState, cmd = m.auditState.Update(msg)
 		}
 	}
 	return m, cmd
 }
 
+// switchVault locks the open vault and continues with another one.
+func (m MainModel) switchVault(msg switchVaultMsg) (tea.Model, tea.Cmd) {
+	if _, err := msg.Store.PurgeExpiredTrash(); err != nil {
+		msg.Store.Close()
+		m.Err = err
+		return m, tea.Quit
+	}
+	if err := m.store.Close(); err != nil {
+		msg.Store.Close()
+		m.Err = err
+		return m, tea.Quit
+	}
+
+	next := InitialMainModel(msg.Store, msg.Username, msg.Actor, msg.CipherKey, nil)
+	next.width, next.height = m.width, m.height
+	next.lastActivity = m.lastActivity
+	next.copied = m.copied
+	next.resize()
+	next.entryListState.message = fmt.Sprintf("Opened %s's vault", msg.Username)
+	return *next, next.preview()
+}
+
+// Vault returns the vault open when the program ended, which differs from
+// the one it started with after switching vaults, and who unlocked it.
+func (m MainModel) Vault() (database.VaultStore, string, string, []byte) {
+	return m.store, m.username, m.actor, m.cipherKey
+}
+
+// undo restores the last item deleted in this session from the trash.
+func (m MainModel) undo() (tea.Model, tea.Cmd) {
+	message, isErr := "Nothing to undo", true
+	if m.lastDeleted != 0 {
+		err := m.store.RestoreTrash(m.lastDeleted)
+		if err == nil {
+			err = auditlog.NewLogger(m.store, m.cipherKey, m.actor).Log(auditlog.Restore, "", "", "undo of the last deletion")
+		}
+		if err != nil {
+			message = fmt.Sprintf("Undo failed: %v", err)
+		} else {
+			message, isErr = "Restored last deleted item", false
+			m.lastDeleted = 0
+		}
+	}
+
+	var err error
+	if m.entryListState, err = m.entryListState.setTableRows(); err != nil {
+		m.Err = err
+		return m, tea.Quit
+	}
+	if m.state == EntryDetails {
+		if m.entryDetailState, err = m.entryDetailState.setTableRows(); err != nil {
+			m.Err = err
+			return m, tea.Quit
+		}
+		m.entryDetailState.message, m.entryDetailState.messageErr = message, isErr
+	} else {
+		m.entryListState.message, m.entryListState.messageErr = message, isErr
+	}
+	return m, nil
+}
+
+// split reports whether the window is wide enough to show the entry list and
+// the details of the selected entry side by side.
+func (m MainModel) split() bool {
+	return m.width >= splitMinWidth
+}
+
+// listWidth is the width of the entry list, which gets two fifths of the
+// window in the split layout.
+func (m MainModel) listWidth() int {
+	if m.split() {
+		return m.width * 2 / 5
+	}
+	return m.width
+}
+
+// resize fits every model into the window.
+func (m *MainModel) resize() {
+	listWidth, detailsWidth := m.listWidth(), m.width
+	if m.split() {
+		detailsWidth = m.width - listWidth - len(paneGap)
+	}
+	m.entryListState.setSize(listWidth, m.height)
+	m.entryDetailState.setSize(detailsWidth, m.height)
+	m.trashState.setSize(m.width, m.height)
+	m.attachmentState.setSize(m.width, m.height)
+	m.vaultState.setSize(m.width, m.height)
+	m.reportState.setSize(m.width, m.height)
+	m.auditState.setSize(m.width, m.height)
+}
+
+// preview shows the entry selected in the list in the details pane of the
+// split layout.
+func (m *MainModel) preview() tea.Cmd {
+	if !m.split() || m.state != EntryList {
+		return nil
+	}
+	node, ok := m.entryListState.selectedEntry()
+	if !ok {
+		m.entryDetailState.clear()
+		return nil
+	}
+	if node.entry == m.entryDetailState.Entry {
+		return nil
+	}
+	m.entryDetailState.Entry = node.entry
+	m.entryDetailState.reveal = false
+	var err error
+	if m.entryDetailState, err = m.entryDetailState.setTableRows(); err != nil {
+		return func() tea.Msg {
+			return errMsg{Err: err}
+		}
+	}
+	return nil
+}
+
 func (m MainModel) View() string {
+	if m.split() && (m.state == EntryList || m.state == EntryDetails) {
+		// The help line spans both panes
+		h := m.entryListState.help
+		if m.state == EntryDetails {
+			h = m.entryDetailState.help
+		}
+		h.Width = m.width
+		list := lipgloss.NewStyle().Width(m.listWidth()).Render(m.entryListState.viewPane())
+		panes := lipgloss.JoinHorizontal(lipgloss.Top, list, paneGap, m.entryDetailState.viewPane())
+		return fmt.Sprintf("%s\n\n%s\n", panes, helpView(h))
+	}
+
 	switch m.state {
 	case EntryList:
 		return m.entryListState.View()
+	case TrashList:
+		return m.trashState.View()
+	case AttachmentList:
+		return m.attachmentState.View()
+	case VaultList:
+		return m.vaultState.View()
+	case HealthReport:
+		return m.reportState.View()
+	case AuditLog:
+		return m.auditState.View()
 	case EntryDetails:
 		fallthrough
 	default:
 		return m.entryDetailState.View()
 	}
 }
+
+// setRows replaces the rows of a table. SetRows leaves the cursor at -1 once
+// a table has been empty, which would make the first new row unselectable.
+func setRows(t *table.Model, rows []table.Row) {
+	t.SetRows(rows)
+	if t.Cursor() < 0 {
+		t.SetCursor(0)
+	}
+}
@@ -0,0 +1,141 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+	"github.com/AdityaKK0407/sentryvault/internal/health"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// ReportModel shows the weak, reused and stale secrets of the vault. Each
+// finding opens the entry holding the secret.
+type ReportModel struct {
+	tableView   table.Model
+	help        help.Model
+	report      health.Report
+	store       database.VaultStore
+	cipherKey32 []byte
+	audit       auditlog.Logger
+}
+
+func (m ReportModel) setTableRows() (ReportModel, error) {
+	report, err := health.Check(m.store, m.cipherKey32, settings.Health, time.Now())
+	if err != nil {
+		return m, err
+	}
+
+	var rows []table.Row
+	for _, f := range report.Findings {
+		rows = append(rows, table.Row{
+			string(f.Kind),
+			f.Path,
+			f.Key,
+			f.Detail,
+		})
+	}
+	m.report = report
+	setRows(&m.tableView, rows)
+	return m, m.audit.Log(auditlog.Check, "", "", fmt.Sprintf("security report of %d secrets", report.Checked))
+}
+
+// setSize fits the table into the given width and height.
+func (m *ReportModel) setSize(width, height int) {
+	fitColumns(&m.tableView, width, true, 1, 3)
+	m.tableView.SetHeight(tableHeight(height))
+	m.help.Width = width
+}
+
+func (m ReportModel) selectBoundsCheck() bool {
+	if m.tableView.Cursor() >= 0 && m.tableView.Cursor() < len(m.report.Findings) {
+		return true
+	}
+	return false
+}
+
+func initialReportModel(store database.VaultStore, audit auditlog.Logger, cipherKey32 []byte) ReportModel {
+	cols := []table.Column{
+		{Title: "Issue", Width: 9},
+		{Title: "Entry", Width: 25},
+		{Title: "Field", Width: 16},
+		{Title: "Detail", Width: 40},
+	}
+
+	t := table.New(
+		table.WithKeyMap(tableKeyMap()),
+		table.WithStyles(tableStyles()),
+		table.WithColumns(cols),
+		table.WithRows([]table.Row{}),
+		table.WithHeight(10),
+		table.WithFocused(true),
+	)
+
+	return ReportModel{
+		tableView:   t,
+		help:        help.New(),
+		store:       store,
+		cipherKey32: cipherKey32,
+		audit:       audit,
+	}
+}
+
+func (m ReportModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m ReportModel) Update(msg tea.Msg) (ReportModel, tea.Cmd) {
+	var cmd tea.Cmd
+	kb := keybindings()
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, kb.Quit):
+			return m, tea.Quit
+		case key.Matches(msg, kb.Escape):
+			return m, func() tea.Msg {
+				return returnEntryMsg{}
+			}
+		case key.Matches(msg, kb.Enter):
+			if m.selectBoundsCheck() {
+				entry := m.report.Findings[m.tableView.Cursor()].Entry
+				return m, func() tea.Msg {
+					return selectEntryMsg{Entry: entry}
+				}
+			}
+			return m, nil
+		}
+	}
+
+	m.tableView, cmd = m.tableView.Update(msg)
+	return m, cmd
+}
+
+func (m ReportModel) View() string {
+	s := fmt.Sprintf("Security report: %d secrets checked, %d weak, %d reused, %d stale",
+		m.report.Checked,
+		m.report.Count(health.Weak),
+		m.report.Count(health.Reused),
+		m.report.Count(health.Stale),
+	)
+	if settings.Health.BreachList != "" {
+		s += fmt.Sprintf(", %d breached", m.report.Count(health.Breached))
+	}
+	s += "\n\n"
+	s += tableStyle.Render(m.tableView.View())
+
+	if len(m.report.Findings) == 0 {
+		s += "\n\nNo problems found"
+	} else {
+		kb := keybindings()
+		s += "\n\n" + keyHints(keyHint(kb.Enter, "Open entry"), keyHint(kb.Escape, "Back"))
+	}
+	s += fmt.Sprintf("\n\n%s\n", helpView(m.help))
+
+	return s
+}
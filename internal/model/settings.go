@@ -0,0 +1,36 @@
+package model
+
+import (
+	"github.com/AdityaKK0407/sentryvault/internal/config"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
+)
+
+// settings holds the user configuration the models were set up with.
+var settings = config.Default()
+
+var keyMap = newKeyMap(settings.Keys)
+
+// Configure applies a user configuration. It has to be called before the
+// models are created.
+func Configure(cfg config.Config) {
+	settings = cfg
+	keyMap = newKeyMap(cfg.Keys)
+	applyTheme(cfg.Theme)
+}
+
+// tableKeyMap moves table rows with the configured up and down keys. The
+// letter shortcuts of the default table key map are left out so that they
+// cannot shadow remapped actions.
+func tableKeyMap() table.KeyMap {
+	km := table.DefaultKeyMap()
+	km.LineUp = keyMap.Up
+	km.LineDown = keyMap.Down
+	km.PageUp = key.NewBinding(key.WithKeys("pgup"))
+	km.PageDown = key.NewBinding(key.WithKeys("pgdown"))
+	km.HalfPageUp = key.NewBinding(key.WithKeys("ctrl+u"))
+	km.HalfPageDown = key.NewBinding(key.WithKeys("ctrl+d"))
+	km.GotoTop = key.NewBinding(key.WithKeys("home"))
+	km.GotoBottom = key.NewBinding(key.WithKeys("end"))
+	return km
+}
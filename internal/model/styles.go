@@ -1,12 +1,93 @@
 package model
 
 import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/AdityaKK0407/sentryvault/internal/config"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 )
 
 var tableStyle = lipgloss.NewStyle().
 	Border(lipgloss.NormalBorder())
 
-var errMessageStyle = lipgloss.NewStyle()
+var detailPaneStyle = lipgloss.NewStyle().
+	Border(lipgloss.RoundedBorder()).
+	Padding(0, 1)
+
+var errMessageStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("9"))
+
+var successMessageStyle = lipgloss.NewStyle().
+	Foreground(lipgloss.Color("10"))
+
+// keyHint renders a binding and what it does as "[key] action", following
+// the configured keys.
+func keyHint(b key.Binding, action string) string {
+	return fmt.Sprintf("[%s] %s", b.Help().Key, action)
+}
+
+func keyHints(hints ...string) string {
+	return strings.Join(hints, "  ")
+}
+
+func confirmHint() string {
+	kb := keybindings()
+	return keyHints(keyHint(kb.Confirm, "Yes"), keyHint(kb.Cancel, "No"))
+}
+
+func messageView(message string, isErr bool) string {
+	if message == "" {
+		return ""
+	}
+	if isErr {
+		return "\n\n" + errMessageStyle.Render(message)
+	}
+	return "\n\n" + successMessageStyle.Render(message)
+}
+
+// damagedMessage tells how many items of the vault cannot be decrypted and
+// how to repair them.
+func damagedMessage(n int) string {
+	if n == 1 {
+		return "1 item cannot be decrypted, run sentryvault fsck -repair to quarantine it"
+	}
+	return fmt.Sprintf("%d items cannot be decrypted, run sentryvault fsck -repair to quarantine them", n)
+}
+
+// applyTheme sets the styles from the colours of a theme. Without colour
+// only bold and borders are used.
+func applyTheme(theme config.Theme) {
+	if theme.NoColor || os.Getenv("NO_COLOR") != "" {
+		lipgloss.SetColorProfile(termenv.Ascii)
+	}
+	tableStyle = tableStyle.BorderForeground(lipgloss.Color(theme.Border))
+	detailPaneStyle = detailPaneStyle.BorderForeground(lipgloss.Color(theme.Border))
+	errMessageStyle = errMessageStyle.Foreground(lipgloss.Color(theme.Error))
+	successMessageStyle = successMessageStyle.Foreground(lipgloss.Color(theme.Success))
+	accentColour = lipgloss.Color(theme.Accent)
+	borderColour = lipgloss.Color(theme.Border)
+}
+
+var (
+	accentColour = lipgloss.Color("212")
+	borderColour = lipgloss.Color("240")
+)
 
-var successMessageStyle = lipgloss.NewStyle()
+// tableStyles returns the styles of every table, following the theme.
+func tableStyles() table.Styles {
+	styles := table.DefaultStyles()
+	styles.Header = styles.Header.
+		BorderStyle(lipgloss.NormalBorder()).
+		BorderForeground(borderColour).
+		BorderBottom(true).
+		Bold(true)
+	styles.Selected = styles.Selected.
+		Foreground(accentColour).
+		Bold(true)
+	return styles
+}
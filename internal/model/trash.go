@@ -0,0 +1,196 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type trashState uint8
+
+const (
+	tableTrash trashState = iota
+	purgeTrash
+)
+
+type TrashModel struct {
+	tableView  table.Model
+	help       help.Model
+	state      trashState
+	items      []database.TrashItem
+	store      database.VaultStore
+	audit      auditlog.Logger
+	message    string
+	messageErr bool
+}
+
+func (m TrashModel) setTableRows() (TrashModel, error) {
+	items, err := m.store.GetTrash()
+	if err != nil {
+		return m, err
+	}
+
+	var rows []table.Row
+	for _, item := range items {
+		name, kind := item.Entry, "entry"
+		if !item.IsEntry() {
+			name, kind = item.Entry+" / "+item.Key, "field"
+		}
+		rows = append(rows, table.Row{
+			name,
+			kind,
+			item.Deleted.Local().Format("2006-01-02 15:04"),
+		})
+	}
+	m.items = items
+	setRows(&m.tableView, rows)
+	return m, nil
+}
+
+// setSize fits the table into the given width and height.
+func (m *TrashModel) setSize(width, height int) {
+	fitColumns(&m.tableView, width, true, 0)
+	m.tableView.SetHeight(tableHeight(height))
+	m.help.Width = width
+}
+
+func (m TrashModel) selectBoundsCheck() bool {
+	if m.tableView.Cursor() >= 0 && m.tableView.Cursor() < len(m.items) {
+		return true
+	}
+	return false
+}
+
+func initialTrashModel(store database.VaultStore, audit auditlog.Logger) TrashModel {
+	cols := []table.Column{
+		{Title: "Deleted Item", Width: 40},
+		{Title: "Kind", Width: 6},
+		{Title: "Deleted", Width: 16},
+	}
+
+	t := table.New(
+		table.WithKeyMap(tableKeyMap()),
+		table.WithStyles(tableStyles()),
+		table.WithColumns(cols),
+		table.WithRows([]table.Row{}),
+		table.WithHeight(10),
+		table.WithFocused(true),
+	)
+
+	return TrashModel{
+		tableView: t,
+		help:      help.New(),
+		state:     tableTrash,
+		store:     store,
+		audit:     audit,
+	}
+}
+
+func (m TrashModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m TrashModel) Update(msg tea.Msg) (TrashModel, tea.Cmd) {
+	var cmd tea.Cmd
+	kb := keybindings()
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, kb.Quit):
+			return m, tea.Quit
+		case key.Matches(msg, kb.Escape):
+			if m.state == tableTrash {
+				m.message = ""
+				return m, func() tea.Msg {
+					return returnEntryMsg{}
+				}
+			}
+			m.tableView.Focus()
+			m.state = tableTrash
+		case key.Matches(msg, kb.Enter):
+			if m.state == tableTrash && m.selectBoundsCheck() {
+				item := m.items[m.tableView.Cursor()]
+				if err := m.store.RestoreTrash(item.ID); err != nil {
+					m.message = err.Error()
+					m.messageErr = true
+					return m, nil
+				}
+				err := m.audit.Log(auditlog.Restore, item.Entry, item.Key, "from trash")
+				if err == nil {
+					m, err = m.setTableRows()
+				}
+				if err != nil {
+					return m, func() tea.Msg {
+						return errMsg{Err: err}
+					}
+				}
+				m.message = fmt.Sprintf("Restored \"%s\"", item.Entry)
+				m.messageErr = false
+				return m, nil
+			}
+		case key.Matches(msg, kb.Remove):
+			if m.state == tableTrash && m.selectBoundsCheck() {
+				m.tableView.Blur()
+				m.state = purgeTrash
+			}
+		case key.Matches(msg, kb.Confirm):
+			if m.state == purgeTrash {
+				item := m.items[m.tableView.Cursor()]
+				err := m.store.PurgeTrash(item.ID)
+				if err == nil {
+					err = m.audit.Log(auditlog.Purge, item.Entry, item.Key, "")
+				}
+				if err == nil {
+					m, err = m.setTableRows()
+				}
+				if err != nil {
+					return m, func() tea.Msg {
+						return errMsg{Err: err}
+					}
+				}
+				m.message = fmt.Sprintf("Permanently deleted \"%s\"", item.Entry)
+				m.messageErr = false
+			}
+			fallthrough
+		case key.Matches(msg, kb.Cancel):
+			if m.state == purgeTrash {
+				m.tableView.Focus()
+				m.state = tableTrash
+			}
+		}
+	}
+
+	if m.state == tableTrash {
+		m.tableView, cmd = m.tableView.Update(msg)
+	}
+	return m, cmd
+}
+
+func (m TrashModel) View() string {
+	s := "Trash\n\n"
+	s += tableStyle.Render(m.tableView.View())
+
+	switch m.state {
+	case purgeTrash:
+		s += fmt.Sprintf("\n\nPermanently delete %s?\n", m.tableView.SelectedRow()[0])
+		s += confirmHint() + "\n\n"
+	case tableTrash:
+		if len(m.items) == 0 {
+			s += "\n\nTrash is empty"
+		} else {
+			kb := keybindings()
+			s += "\n\n" + keyHints(keyHint(kb.Enter, "Restore"), keyHint(kb.Remove, "Delete permanently"), keyHint(kb.Escape, "Back"))
+		}
+	}
+
+	s += messageView(m.message, m.messageErr)
+	s += fmt.Sprintf("\n\n%s\n", helpView(m.help))
+
+	return s
+}
@@ -0,0 +1,367 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+	"github.com/AdityaKK0407/sentryvault/internal/vault"
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/table"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+type vaultState uint8
+
+const (
+	tableVaults vaultState = iota
+	unlockVault
+	createVaultName
+	createVaultPassword
+	deleteVaultName
+	deleteVaultPassword
+)
+
+// VaultModel lists the vaults on disk and opens, creates or deletes them.
+// The open vault is replaced through a switchVaultMsg.
+type VaultModel struct {
+	tableView     table.Model
+	nameInput     textinput.Model
+	passwordInput textinput.Model
+	keyfileInput  textinput.Model
+	help          help.Model
+	state         vaultState
+	vaults        []vault.Info
+	username      string
+	newName       string
+	message       string
+	messageErr    bool
+}
+
+func (m VaultModel) setTableRows() (VaultModel, error) {
+	vaults, err := vault.List()
+	if err != nil {
+		return m, err
+	}
+
+	var rows []table.Row
+	for _, v := range vaults {
+		name := v.Name
+		if name == m.username {
+			name += " (open)"
+		}
+		rows = append(rows, table.Row{
+			name,
+			database.FormatSize(v.Size),
+			v.Modified.Local().Format("2006-01-02 15:04"),
+		})
+	}
+	m.vaults = vaults
+	setRows(&m.tableView, rows)
+	return m, nil
+}
+
+// setSize fits the table and inputs into the given width and height.
+func (m *VaultModel) setSize(width, height int) {
+	fitColumns(&m.tableView, width, true, 0)
+	m.tableView.SetHeight(tableHeight(height))
+	m.nameInput.Width = inputWidth(width, m.nameInput.Prompt)
+	m.passwordInput.Width = inputWidth(width, m.passwordInput.Prompt)
+	m.keyfileInput.Width = inputWidth(width, m.keyfileInput.Prompt)
+	m.help.Width = width
+}
+
+func (m VaultModel) selectBoundsCheck() bool {
+	if m.tableView.Cursor() >= 0 && m.tableView.Cursor() < len(m.vaults) {
+		return true
+	}
+	return false
+}
+
+func (m VaultModel) selected() string {
+	return m.vaults[m.tableView.Cursor()].Name
+}
+
+// enteringPassword reports whether the password and keyfile inputs are
+// shown.
+func (m VaultModel) enteringPassword() bool {
+	return m.state == unlockVault || m.state == createVaultPassword || m.state == deleteVaultPassword
+}
+
+// credentials returns the password and keyfile entered.
+func (m VaultModel) credentials() vault.Credentials {
+	return vault.Credentials{
+		Password: m.passwordInput.Value(),
+		Keyfile:  expandPath(m.keyfileInput.Value()),
+	}
+}
+
+// focusPassword moves to the password input, clearing both inputs.
+func (m *VaultModel) focusPassword() {
+	m.passwordInput.Reset()
+	m.keyfileInput.Reset()
+	m.keyfileInput.Blur()
+	m.passwordInput.Focus()
+}
+
+// typing reports whether a name or password is being entered.
+func (m VaultModel) typing() bool {
+	return m.state != tableVaults
+}
+
+func (m *VaultModel) resetInputs() {
+	m.nameInput.Reset()
+	m.nameInput.Blur()
+	m.passwordInput.Reset()
+	m.passwordInput.Blur()
+	m.keyfileInput.Reset()
+	m.keyfileInput.Blur()
+	m.newName = ""
+	m.tableView.Focus()
+	m.state = tableVaults
+}
+
+func (m *VaultModel) setError(err error) {
+	m.message = err.Error()
+	m.messageErr = true
+}
+
+func initialVaultModel(username string) VaultModel {
+	cols := []table.Column{
+		{Title: "Vault", Width: 40},
+		{Title: "Size", Width: 10},
+		{Title: "Modified", Width: 16},
+	}
+
+	t := table.New(
+		table.WithKeyMap(tableKeyMap()),
+		table.WithStyles(tableStyles()),
+		table.WithColumns(cols),
+		table.WithRows([]table.Row{}),
+		table.WithHeight(10),
+		table.WithFocused(true),
+	)
+
+	nameInput := textinput.New()
+	nameInput.Prompt = "Vault Name: "
+	nameInput.Width = 50
+
+	passwordInput := textinput.New()
+	passwordInput.Prompt = "Password: "
+	passwordInput.EchoMode = textinput.EchoPassword
+	passwordInput.Width = 50
+
+	keyfileInput := textinput.New()
+	keyfileInput.Prompt = "Keyfile: "
+	keyfileInput.Placeholder = "empty for none"
+	keyfileInput.Width = 50
+
+	return VaultModel{
+		tableView:     t,
+		nameInput:     nameInput,
+		passwordInput: passwordInput,
+		keyfileInput:  keyfileInput,
+		help:          help.New(),
+		state:         tableVaults,
+		username:      username,
+	}
+}
+
+func (m VaultModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m VaultModel) Update(msg tea.Msg) (VaultModel, tea.Cmd) {
+	var cmd tea.Cmd
+	kb := keybindings()
+
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch {
+		case key.Matches(msg, kb.Quit) && !m.typing():
+			return m, tea.Quit
+		case key.Matches(msg, kb.Escape):
+			if m.state == tableVaults {
+				m.message = ""
+				return m, func() tea.Msg {
+					return returnEntryMsg{}
+				}
+			}
+			m.resetInputs()
+			return m, nil
+		case key.Matches(msg, kb.Enter):
+			return m.submit()
+		case key.Matches(msg, kb.Tab) && m.enteringPassword():
+			if m.passwordInput.Focused() {
+				m.passwordInput.Blur()
+				m.keyfileInput.Focus()
+			} else {
+				m.keyfileInput.Blur()
+				m.passwordInput.Focus()
+			}
+			return m, nil
+		case key.Matches(msg, kb.Add):
+			if m.state == tableVaults {
+				m.tableView.Blur()
+				m.nameInput.Focus()
+				m.state = createVaultName
+				return m, nil
+			}
+		case key.Matches(msg, kb.Remove):
+			if m.state == tableVaults && m.selectBoundsCheck() {
+				if m.selected() == m.username {
+					m.message = "The open vault cannot be deleted, open another vault first"
+					m.messageErr = true
+					return m, nil
+				}
+				m.tableView.Blur()
+				m.nameInput.Focus()
+				m.state = deleteVaultName
+				return m, nil
+			}
+		}
+	}
+
+	switch m.state {
+	case tableVaults:
+		m.tableView, cmd = m.tableView.Update(msg)
+	case createVaultName, deleteVaultName:
+		m.nameInput, cmd = m.nameInput.Update(msg)
+	case unlockVault, createVaultPassword, deleteVaultPassword:
+		if m.keyfileInput.Focused() {
+			m.keyfileInput, cmd = m.keyfileInput.Update(msg)
+		} else {
+			m.passwordInput, cmd = m.passwordInput.Update(msg)
+		}
+	}
+	return m, cmd
+}
+
+// submit handles enter in every state of the vault manager.
+func (m VaultModel) submit() (VaultModel, tea.Cmd) {
+	switch m.state {
+	case tableVaults:
+		if !m.selectBoundsCheck() {
+			return m, nil
+		}
+		if m.selected() == m.username {
+			m.message = fmt.Sprintf("\"%s\" is already open", m.username)
+			m.messageErr = true
+			return m, nil
+		}
+		m.message = ""
+		m.tableView.Blur()
+		m.focusPassword()
+		m.state = unlockVault
+	case unlockVault:
+		name := m.selected()
+		creds := m.credentials()
+		store, cipherKey32, err := vault.Open(name, creds)
+		if err != nil {
+			m.focusPassword()
+			m.setError(err)
+			return m, nil
+		}
+		m.resetInputs()
+		return m, switchVault(store, name, creds.Actor(), cipherKey32)
+	case createVaultName:
+		name := m.nameInput.Value()
+		if err := vault.ValidateName(name); err != nil {
+			m.setError(err)
+			return m, nil
+		}
+		if exists, err := vault.Exists(name); err != nil || exists {
+			if err == nil {
+				err = fmt.Errorf("vault \"%s\" %w", name, database.ErrExists)
+			}
+			m.setError(err)
+			return m, nil
+		}
+		m.message = ""
+		m.newName = name
+		m.nameInput.Blur()
+		m.focusPassword()
+		m.state = createVaultPassword
+	case createVaultPassword:
+		name := m.newName
+		creds := m.credentials()
+		store, cipherKey32, err := vault.Create(name, creds)
+		if err != nil {
+			m.resetInputs()
+			m.setError(err)
+			return m, nil
+		}
+		m.resetInputs()
+		return m, switchVault(store, name, creds.Actor(), cipherKey32)
+	case deleteVaultName:
+		if m.nameInput.Value() != m.selected() {
+			m.message = fmt.Sprintf("Type \"%s\" to confirm", m.selected())
+			m.messageErr = true
+			return m, nil
+		}
+		m.message = ""
+		m.nameInput.Blur()
+		m.focusPassword()
+		m.state = deleteVaultPassword
+	case deleteVaultPassword:
+		name := m.selected()
+		err := vault.Delete(name, m.credentials())
+		if errors.Is(err, vault.ErrInvalidPassword) || errors.Is(err, vault.ErrKeyfileRequired) || errors.Is(err, vault.ErrNoKeyfile) {
+			m.focusPassword()
+			m.setError(err)
+			return m, nil
+		}
+		m.resetInputs()
+		if err != nil {
+			m.setError(err)
+			return m, nil
+		}
+		if m, err = m.setTableRows(); err != nil {
+			return m, func() tea.Msg {
+				return errMsg{Err: err}
+			}
+		}
+		m.message = fmt.Sprintf("Deleted vault \"%s\"", name)
+		m.messageErr = false
+	}
+	return m, nil
+}
+
+func switchVault(store database.VaultStore, username, actor string, cipherKey32 []byte) tea.Cmd {
+	return func() tea.Msg {
+		return switchVaultMsg{Store: store, Username: username, Actor: actor, CipherKey: cipherKey32}
+	}
+}
+
+// passwordView shows the password and keyfile inputs.
+func (m VaultModel) passwordView() string {
+	return fmt.Sprintf("%s\n%s\n%s", m.passwordInput.View(), m.keyfileInput.View(), keyHint(keybindings().Tab, "Switch to keyfile"))
+}
+
+func (m VaultModel) View() string {
+	s := "Vaults\n\n"
+	s += tableStyle.Render(m.tableView.View())
+
+	switch m.state {
+	case unlockVault:
+		s += fmt.Sprintf("\n\nUnlock %s, locking %s\n%s", m.selected(), m.username, m.passwordView())
+	case createVaultName:
+		s += fmt.Sprintf("\n\nNew vault\n%s", m.nameInput.View())
+	case createVaultPassword:
+		s += fmt.Sprintf("\n\nPassword for %s\n%s", m.newName, m.passwordView())
+	case deleteVaultName:
+		s += fmt.Sprintf("\n\nPermanently delete %s? Type its name to confirm\n%s", m.selected(), m.nameInput.View())
+	case deleteVaultPassword:
+		s += fmt.Sprintf("\n\nPermanently delete %s? Enter its password to confirm\n%s", m.selected(), m.passwordView())
+	case tableVaults:
+		kb := keybindings()
+		s += "\n\n" + keyHints(keyHint(kb.Enter, "Open"), keyHint(kb.Add, "New vault"), keyHint(kb.Remove, "Delete"), keyHint(kb.Escape, "Back"))
+	}
+
+	s += messageView(m.message, m.messageErr)
+	s += fmt.Sprintf("\n\n%s\n", helpView(m.help))
+
+	return s
+}
@@ -0,0 +1,117 @@
+// Package shamir splits a secret into shares, any threshold of which
+// recover it, using Shamir's secret sharing over GF(256). Each byte of the
+// secret is the constant term of its own random polynomial.
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Share is one point on the polynomials: X is never 0, which would be the
+// secret itself, and Y holds one byte per byte of the secret.
+type Share struct {
+	X byte
+	Y []byte
+}
+
+// Split splits secret into n shares, any k of which recover it. Fewer than
+// k shares reveal nothing about the secret.
+func Split(secret []byte, n, k int) ([]Share, error) {
+	switch {
+	case len(secret) == 0:
+		return nil, errors.New("the secret is empty")
+	case k < 2:
+		return nil, fmt.Errorf("the threshold must be at least 2, got %d", k)
+	case n < k:
+		return nil, fmt.Errorf("%d shares cannot meet a threshold of %d", n, k)
+	case n > 255:
+		return nil, fmt.Errorf("at most 255 shares can be made, got %d", n)
+	}
+
+	shares := make([]Share, n)
+	for i := range shares {
+		shares[i] = Share{X: byte(i + 1), Y: make([]byte, len(secret))}
+	}
+	coefficients := make([]byte, k)
+	for b, s := range secret {
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		coefficients[0] = s
+		for i := range shares {
+			shares[i].Y[b] = evaluate(coefficients, shares[i].X)
+		}
+	}
+	clear(coefficients)
+	return shares, nil
+}
+
+// Combine recovers the secret from at least the threshold number of shares.
+// With fewer shares it returns a wrong secret, which cannot be told apart
+// from the right one here.
+func Combine(shares []Share) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least 2 shares are needed")
+	}
+	size := len(shares[0].Y)
+	seen := make(map[byte]bool)
+	for _, share := range shares {
+		switch {
+		case share.X == 0:
+			return nil, errors.New("invalid share")
+		case seen[share.X]:
+			return nil, fmt.Errorf("share %d is given twice", share.X)
+		case len(share.Y) != size:
+			return nil, errors.New("the shares belong to different secrets")
+		}
+		seen[share.X] = true
+	}
+
+	// Lagrange interpolation at x = 0
+	secret := make([]byte, size)
+	for i, share := range shares {
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = mul(basis, div(other.X, other.X^share.X))
+			}
+		}
+		for b, y := range share.Y {
+			secret[b] ^= mul(y, basis)
+		}
+	}
+	return secret, nil
+}
+
+// evaluate returns the polynomial with the given coefficients, lowest
+// first, at x.
+func evaluate(coefficients []byte, x byte) byte {
+	var y byte
+	for i := len(coefficients) - 1; i >= 0; i-- {
+		y = mul(y, x) ^ coefficients[i]
+	}
+	return y
+}
+
+// mul multiplies in GF(256) with the AES polynomial x^8 + x^4 + x^3 + x + 1.
+// It does not branch on its inputs, so its timing does not leak them.
+func mul(a, b byte) byte {
+	var p byte
+	for range 8 {
+		p ^= a & -(b & 1)
+		a = a<<1 ^ 0x1b&-(a>>7)
+		b >>= 1
+	}
+	return p
+}
+
+// div divides a by b, which must not be 0. The inverse of b is b^254.
+func div(a, b byte) byte {
+	inverse := b
+	for range 6 {
+		inverse = mul(mul(inverse, inverse), b)
+	}
+	return mul(a, mul(inverse, inverse))
+}
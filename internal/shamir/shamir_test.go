@@ -0,0 +1,78 @@
+package shamir
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("correct horse battery")
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every choice of 3 or more shares recovers the secret
+	for mask := range 1 << len(shares) {
+		var subset []Share
+		for i, share := range shares {
+			if mask&(1<<i) != 0 {
+				subset = append(subset, share)
+			}
+		}
+		if len(subset) < 3 {
+			continue
+		}
+		got, err := Combine(subset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, secret) {
+			t.Errorf("shares %05b recovered %q", mask, got)
+		}
+	}
+
+	got, err := Combine(shares[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(got, secret) {
+		t.Error("2 shares recovered the secret with a threshold of 3")
+	}
+}
+
+func TestCombineErrors(t *testing.T) {
+	shares, err := Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Combine(shares[:1]); err == nil {
+		t.Error("Combine accepted a single share")
+	}
+	if _, err = Combine([]Share{shares[0], shares[0]}); err == nil {
+		t.Error("Combine accepted the same share twice")
+	}
+	short := Share{X: shares[1].X, Y: shares[1].Y[:3]}
+	if _, err = Combine([]Share{shares[0], short}); err == nil {
+		t.Error("Combine accepted shares of different lengths")
+	}
+}
+
+func TestSplitErrors(t *testing.T) {
+	for _, c := range []struct{ n, k int }{{3, 1}, {2, 3}, {256, 3}} {
+		if _, err := Split([]byte("secret"), c.n, c.k); err == nil {
+			t.Errorf("Split(%d, %d) succeeded", c.n, c.k)
+		}
+	}
+}
+
+func TestField(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		if got := mul(byte(a), div(1, byte(a))); got != 1 {
+			t.Fatalf("%d * 1/%d = %d", a, a, got)
+		}
+	}
+	// 0x57 * 0x83 = 0xc1 is the worked example of FIPS 197
+	if got := mul(0x57, 0x83); got != 0xc1 {
+		t.Errorf("mul(0x57, 0x83) = %#x, want 0xc1", got)
+	}
+}
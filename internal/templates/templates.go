@@ -0,0 +1,208 @@
+package templates
+
+import (
+	"encoding/base32"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Field struct {
+	Key       string
+	Sensitive bool
+	Multiline bool
+	Validate  func(string) error
+}
+
+type Template struct {
+	Type   string
+	Name   string
+	Fields []Field
+}
+
+// Custom is the type of entries without a template, holding arbitrary fields.
+const Custom = ""
+
+var Templates = []Template{
+	{
+		Type: "login",
+		Name: "Login",
+		Fields: []Field{
+			{Key: "username"},
+			{Key: "password", Sensitive: true},
+			{Key: "url", Validate: validateURL},
+			{Key: "totp", Sensitive: true, Validate: validateTOTP},
+		},
+	},
+	{
+		Type: "card",
+		Name: "Credit Card",
+		Fields: []Field{
+			{Key: "cardholder"},
+			{Key: "number", Sensitive: true, Validate: validateCardNumber},
+			{Key: "expiry", Validate: validateExpiry},
+			{Key: "cvv", Sensitive: true, Validate: validateCVV},
+		},
+	},
+	{
+		Type: "ssh",
+		Name: "SSH Key",
+		Fields: []Field{
+			{Key: "private key", Sensitive: true, Multiline: true, Validate: validatePrivateKey},
+			{Key: "public key", Validate: validatePublicKey},
+			{Key: "passphrase", Sensitive: true},
+		},
+	},
+	{
+		Type: "token",
+		Name: "API Token",
+		Fields: []Field{
+			{Key: "service"},
+			{Key: "token", Sensitive: true},
+			{Key: "expires", Validate: validateDate},
+		},
+	},
+	{
+		Type: "note",
+		Name: "Secure Note",
+		Fields: []Field{
+			{Key: "note", Sensitive: true, Multiline: true},
+		},
+	},
+}
+
+func Lookup(typ string) (Template, bool) {
+	for _, t := range Templates {
+		if t.Type == typ {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+func (t Template) Field(key string) (Field, bool) {
+	for _, f := range t.Fields {
+		if f.Key == key {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// FieldOf returns the template definition of a field, if the entry type has one.
+func FieldOf(typ, key string) (Field, bool) {
+	t, ok := Lookup(typ)
+	if !ok {
+		return Field{}, false
+	}
+	return t.Field(key)
+}
+
+func IsSensitive(typ, key string) bool {
+	f, _ := FieldOf(typ, key)
+	return f.Sensitive
+}
+
+// Validate checks a value against the template of its entry. Empty values are
+// always accepted so that pre-populated fields can be filled in later, as are
+// fields the template does not know about.
+func Validate(typ, key, value string) error {
+	f, ok := FieldOf(typ, key)
+	if !ok || f.Validate == nil || value == "" {
+		return nil
+	}
+	return f.Validate(value)
+}
+
+// Luhn reports whether number passes the Luhn checksum used by card numbers.
+// Spaces and dashes are ignored.
+func Luhn(number string) bool {
+	var sum, digits int
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+		double = !double
+	}
+	return digits > 1 && sum%10 == 0
+}
+
+func validateCardNumber(value string) error {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(value)
+	if len(digits) < 12 || len(digits) > 19 {
+		return errors.New("card number must have 12 to 19 digits")
+	}
+	if !Luhn(value) {
+		return errors.New("card number fails the Luhn check")
+	}
+	return nil
+}
+
+func validateExpiry(value string) error {
+	if _, err := time.Parse("01/06", value); err != nil {
+		return errors.New("expiry must be in MM/YY format")
+	}
+	return nil
+}
+
+func validateCVV(value string) error {
+	if len(value) < 3 || len(value) > 4 || strings.Trim(value, "0123456789") != "" {
+		return errors.New("CVV must be 3 or 4 digits")
+	}
+	return nil
+}
+
+func validateURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("url must be absolute, e.g. https://example.com")
+	}
+	return nil
+}
+
+func validateTOTP(value string) error {
+	if strings.HasPrefix(value, "otpauth://") {
+		return nil
+	}
+	secret := strings.ToUpper(strings.ReplaceAll(value, " ", ""))
+	if _, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "=")); err != nil {
+		return errors.New("totp must be a base32 secret or an otpauth:// URI")
+	}
+	return nil
+}
+
+func validatePrivateKey(value string) error {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "-----BEGIN ") || !strings.Contains(value, "PRIVATE KEY-----") {
+		return errors.New("private key must be in PEM format")
+	}
+	return nil
+}
+
+func validatePublicKey(value string) error {
+	if !strings.HasPrefix(value, "ssh-") && !strings.HasPrefix(value, "ecdsa-") && !strings.HasPrefix(value, "sk-") {
+		return errors.New("public key must be in OpenSSH format, e.g. ssh-ed25519 AAAA...")
+	}
+	return nil
+}
+
+func validateDate(value string) error {
+	if _, err := time.Parse(time.DateOnly, value); err != nil {
+		return errors.New("date must be in YYYY-MM-DD format")
+	}
+	return nil
+}
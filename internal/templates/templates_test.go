@@ -0,0 +1,43 @@
+package templates
+
+import "testing"
+
+func TestLuhn(t *testing.T) {
+	tests := map[string]bool{
+		"4111 1111 1111 1111": true,
+		"4111-1111-1111-1112": false,
+		"79927398713":         true,
+		"0":                   false,
+		"4111 1111 1111 111a": false,
+	}
+	for number, want := range tests {
+		if got := Luhn(number); got != want {
+			t.Errorf("Luhn(%q) = %v, want %v", number, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		typ, key, value string
+		ok              bool
+	}{
+		{"card", "number", "4111111111111111", true},
+		{"card", "number", "4111111111111112", false},
+		{"card", "expiry", "12/29", true},
+		{"card", "expiry", "13/29", false},
+		{"card", "cvv", "12a", false},
+		{"card", "number", "", true},
+		{"login", "url", "https://github.com", true},
+		{"login", "url", "github.com", false},
+		{"login", "totp", "JBSWY3DPEHPK3PXP", true},
+		{"login", "custom field", "anything", true},
+		{Custom, "password", "anything", true},
+	}
+	for _, test := range tests {
+		err := Validate(test.typ, test.key, test.value)
+		if (err == nil) != test.ok {
+			t.Errorf("Validate(%q, %q, %q) = %v, want ok %v", test.typ, test.key, test.value, err, test.ok)
+		}
+	}
+}
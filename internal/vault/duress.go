@@ -0,0 +1,114 @@
+package vault
+
+import (
+	"crypto/rand"
+	"errors"
+
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+)
+
+// Every vault has a decoy: a second vault file of the same layout, kept
+// next to it as a dot file. Given the duress password, Open unlocks the
+// decoy in place of the vault. Until a duress password is set the decoy is
+// locked with a random one, so its presence tells nothing, and the real
+// vault keeps no trace of it.
+
+// errDecoy tells unlock that the decoy was opened rather than the vault, so
+// that no failure is recorded.
+var errDecoy = errors.New("decoy opened")
+
+// SetDuress makes password open the decoy of a vault in place of the vault,
+// replacing the decoy with an empty one. The owner's credentials are
+// checked first, and the vault must not be open. Fill the decoy with
+// plausible entries by unlocking it with password.
+func SetDuress(username string, creds Credentials, password string) error {
+	if password == "" {
+		return errors.New("the duress password is empty")
+	}
+	if password == creds.Password {
+		return errors.New("the duress password must differ from the vault password")
+	}
+	if err := checkOwner(username, creds); err != nil {
+		return err
+	}
+	return resetDecoy(username, password)
+}
+
+// RemoveDuress empties the decoy of a vault and locks it with a random
+// password. The owner's credentials are checked first.
+func RemoveDuress(username string, creds Credentials) error {
+	if err := checkOwner(username, creds); err != nil {
+		return err
+	}
+	return lockDecoy(username)
+}
+
+// checkOwner unlocks a vault with the credentials of its owner. The duress
+// password is refused like a wrong one, so that it cannot change the decoy.
+func checkOwner(username string, creds Credentials) error {
+	if err := requireOwner(creds, "set a duress password"); err != nil {
+		return err
+	}
+	store, _, decoy, err := open(username, creds)
+	if err != nil {
+		return err
+	}
+	if err = store.Close(); err != nil {
+		return err
+	}
+	if decoy {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+// lockDecoy empties the decoy and locks it with a random password.
+func lockDecoy(username string) error {
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return err
+	}
+	return resetDecoy(username, string(password))
+}
+
+// ensureDecoy gives a vault made before decoys existed an empty one.
+func ensureDecoy(username string) error {
+	if _, _, err := database.GetDecoyHeaders(username); err == nil {
+		return nil
+	}
+	return lockDecoy(username)
+}
+
+func resetDecoy(username, password string) error {
+	if err := database.DeleteDecoy(username); err != nil {
+		return err
+	}
+	decoy, err := database.OpenDecoy(username)
+	if err != nil {
+		return err
+	}
+	_, err = Init(database.NewBoltStore(decoy), username, Credentials{Password: password})
+	if cerr := decoy.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		database.DeleteDecoy(username)
+	}
+	return err
+}
+
+// openDecoy returns the key of the decoy of a vault when password opens it,
+// nil otherwise. It always derives a key, even without a decoy file.
+func openDecoy(username, password string) []byte {
+	combinedTitle, salt, err := database.GetDecoyHeaders(username)
+	if err != nil {
+		cipher.DeriveEncryptionKey32([]byte(password), make([]byte, 16))
+		return nil
+	}
+	cipherKey32 := cipher.DeriveEncryptionKey32([]byte(password), salt)
+	if _, err = cipher.DecryptAESGCM(cipherKey32, combinedTitle); err != nil {
+		return nil
+	}
+	return cipherKey32
+}
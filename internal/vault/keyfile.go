@@ -0,0 +1,205 @@
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+)
+
+const (
+	keyfileHeader    = "keyfile"
+	wrappedKeyHeader = "wrappedKey"
+
+	keyfileSize = 64
+)
+
+var (
+	ErrKeyfileRequired = errors.New("this vault needs a keyfile to unlock")
+	ErrNoKeyfile       = errors.New("this vault does not use a keyfile")
+)
+
+// Credentials unlock a vault.
+type Credentials struct {
+	Password string
+	// Keyfile is the path of a keyfile, for vaults that need one.
+	Keyfile string
+	// Member is the name of the member of a shared vault unlocking it with
+	// their own password, empty for the owner.
+	Member string
+}
+
+// ownerActor names the owner of a vault in its audit log.
+const ownerActor = "owner"
+
+// Actor names whoever unlocks with the credentials in the audit log: the
+// member, or the owner.
+func (c Credentials) Actor() string {
+	if c.Member != "" {
+		return c.Member
+	}
+	return ownerActor
+}
+
+// input returns the input of the key derivation: the password, mixed with
+// the hash of the keyfile when there is one.
+func (c Credentials) input() ([]byte, error) {
+	if c.Keyfile == "" {
+		return []byte(c.Password), nil
+	}
+	f, err := os.Open(c.Keyfile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read keyfile: %w", err)
+	}
+	defer f.Close()
+	hash, err := cipher.KeyfileHash(f)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.MixKeyfile([]byte(c.Password), hash), nil
+}
+
+// inputFor checks that a keyfile is given exactly when the vault needs one.
+func (c Credentials) inputFor(store database.VaultStore) ([]byte, error) {
+	required, err := NeedsKeyfile(store)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case required && c.Keyfile == "":
+		return nil, ErrKeyfileRequired
+	case !required && c.Keyfile != "":
+		return nil, ErrNoKeyfile
+	}
+	return c.input()
+}
+
+// NeedsKeyfile reports whether a vault needs a keyfile besides the
+// password.
+func NeedsKeyfile(store database.VaultStore) (bool, error) {
+	flag, err := store.GetHeader(keyfileHeader)
+	return flag != nil, err
+}
+
+// GenerateKeyfile writes a new random keyfile to path, which must not exist.
+func GenerateKeyfile(path string) error {
+	data := make([]byte, keyfileSize)
+	if _, err := rand.Read(data); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// SetCredentials protects an unlocked vault with new credentials of its
+// owner, adding or removing the need for a keyfile. The vault is given a new
+// key, stored encrypted under the key derived from the new credentials, so
+// that the key derived from the old ones no longer opens it. Members keep
+// their access, the recovery key and shares are removed since they only
+// unlock the old key. It returns the new key. Credentials of a member are
+// refused, members cannot become the owner.
+func SetCredentials(store database.FileStore, cipherKey32 []byte, creds Credentials) ([]byte, error) {
+	if err := requireOwner(creds, "change its credentials"); err != nil {
+		return nil, err
+	}
+	return rotateKey(store, cipherKey32, creds, "")
+}
+
+// rotateKey encrypts a vault again under a new random key, wrapped under
+// the key derived from the credentials of the owner. The members other than
+// revoked get the new key, as does the audit log, while the recovery key
+// and shares are removed.
+func rotateKey(store database.FileStore, cipherKey32 []byte, owner Credentials, revoked string) ([]byte, error) {
+	newKey := make([]byte, 32)
+	if _, err := rand.Read(newKey); err != nil {
+		return nil, err
+	}
+	input, err := owner.input()
+	if err != nil {
+		return nil, err
+	}
+	_, salt, err := database.GetHeaders(store)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := cipher.EncryptAESGCM(cipher.DeriveEncryptionKey32(input, salt), newKey)
+	if err != nil {
+		return nil, err
+	}
+	var flag []byte
+	if owner.Keyfile != "" {
+		flag = []byte("required")
+	}
+	headers := map[string][]byte{
+		wrappedKeyHeader:  wrapped,
+		keyfileHeader:     flag,
+		recoveryKeyHeader: nil,
+		sharedKeyHeader:   nil,
+	}
+
+	members := map[string][]byte{}
+	if revoked != "" {
+		members[revoked] = nil
+	}
+	pairs, err := store.GetMembers()
+	if err != nil {
+		return nil, err
+	}
+	for _, pair := range pairs {
+		if string(pair[0]) == revoked {
+			continue
+		}
+		var other memberRecord
+		if err = json.Unmarshal(pair[1], &other); err != nil {
+			return nil, err
+		}
+		if err = other.sealVaultKey(newKey); err != nil {
+			return nil, err
+		}
+		if members[string(pair[0])], err = json.Marshal(other); err != nil {
+			return nil, err
+		}
+	}
+
+	logHeaders, reseal, err := auditlog.Rotate(store, cipherKey32, newKey)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(headers, logHeaders)
+
+	if err = store.Rekey(cipherKey32, newKey, headers, members, reseal); err != nil {
+		return nil, err
+	}
+	return newKey, nil
+}
+
+// unwrap returns the vault key given the key derived from the credentials.
+// Vaults whose credentials never changed use the derived key directly.
+// It returns nil when the derived key is wrong.
+func unwrap(store database.VaultStore, derived []byte) ([]byte, error) {
+	wrapped, err := store.GetHeader(wrappedKeyHeader)
+	if err != nil || wrapped == nil {
+		return derived, err
+	}
+	cipherKey32, err := cipher.DecryptAESGCM(derived, wrapped)
+	if err != nil {
+		return nil, nil
+	}
+	return cipherKey32, nil
+}
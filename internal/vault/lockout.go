@@ -0,0 +1,261 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+)
+
+const (
+	// freeAttempts is the number of failed unlocks allowed before back-off
+	// starts. Every further failure doubles the wait, up to maxBackoff.
+	freeAttempts = 3
+	maxBackoff   = time.Hour
+
+	unlockStateHeader = "unlockState"
+)
+
+var ErrWiped = errors.New("the key material of this vault was wiped after too many failed unlock attempts, restore it from a backup")
+
+// LockedOutError is returned while unlocking is refused after failed
+// attempts.
+type LockedOutError struct {
+	Until    time.Time
+	Failures int
+	Tampered bool
+}
+
+func (e *LockedOutError) Error() string {
+	wait := time.Until(e.Until).Round(time.Second)
+	if e.Tampered {
+		return fmt.Sprintf("the unlock record of this vault was modified outside SentryVault or written on another computer, try again in %s", wait)
+	}
+	return fmt.Sprintf("%d failed attempts, try again in %s", e.Failures, wait)
+}
+
+// UnlockState records failed unlocks in the vault header. It is stored with
+// a MAC so that editing or deleting the record, for instance to reset the
+// counter, is detected. The MAC key is kept outside the vault file, see
+// localKey, so a vault moved to another computer starts out locked out for
+// the longest back-off.
+type UnlockState struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+	// WipeAfter is the number of consecutive failures after which the key
+	// material is destroyed, 0 to never wipe.
+	WipeAfter int  `json:"wipeAfter,omitempty"`
+	Wiped     bool `json:"wiped,omitempty"`
+}
+
+// Backoff returns how long to wait after the last failure before the next
+// attempt.
+func (s UnlockState) Backoff() time.Duration {
+	if s.Failures < freeAttempts {
+		return 0
+	}
+	wait := time.Second << min(s.Failures-freeAttempts, 12)
+	return min(wait, maxBackoff)
+}
+
+// AttemptsLeft returns the number of failures left before the vault is
+// wiped, or -1 when wiping is off.
+func (s UnlockState) AttemptsLeft() int {
+	if s.WipeAfter == 0 {
+		return -1
+	}
+	return max(0, s.WipeAfter-s.Failures)
+}
+
+// localKey returns the secret of this computer that the unlock records of
+// its vaults are keyed with, creating it on first use. It lives next to the
+// vaults rather than in them, so that editing a vault file is not enough to
+// forge a record.
+func localKey() ([]byte, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("unable to find user config directory: %w", err)
+	}
+	path := filepath.Join(configDir, "SentryVault", "unlock.key")
+	key, err := os.ReadFile(path)
+	if err == nil && len(key) == sha256.Size {
+		return key, nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	key = make([]byte, sha256.Size)
+	if _, err = rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(path, key, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func unlockStateKey(store database.VaultStore) ([]byte, error) {
+	key, err := localKey()
+	if err != nil {
+		return nil, err
+	}
+	salt, err := store.GetHeader("salt")
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("sentryvault unlock state"))
+	mac.Write(salt)
+	return mac.Sum(nil), nil
+}
+
+// GetUnlockState reads the unlock record of a vault. The second result
+// reports a record whose MAC does not match, or a missing record, which
+// every vault is given by Init or its migration. A tampered record is
+// returned with only the WipeAfter it claims, so that resetting it does not
+// turn wiping off.
+func GetUnlockState(store database.VaultStore) (UnlockState, bool, error) {
+	var state UnlockState
+	data, err := store.GetHeader(unlockStateHeader)
+	if err != nil {
+		return state, false, err
+	}
+	if data == nil {
+		// Vaults made before failed unlocks were recorded have no schema
+		// version either and start a fresh record. Otherwise only a wiped
+		// vault, whose salt is gone, may lack one
+		version, err := database.GetSchemaVersion(store)
+		if err != nil || version == 0 {
+			return state, false, err
+		}
+		salt, err := store.GetHeader("salt")
+		return state, salt != nil, err
+	}
+	key, err := unlockStateKey(store)
+	if err != nil {
+		return state, false, err
+	}
+	if len(data) < sha256.Size {
+		return state, true, nil
+	}
+	body, sum := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	if err = json.Unmarshal(body, &state); err != nil {
+		return UnlockState{}, true, nil
+	}
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return UnlockState{WipeAfter: state.WipeAfter}, true, nil
+	}
+	return state, false, nil
+}
+
+// startUnlockState gives a vault made before failed unlocks were recorded
+// an empty record.
+func startUnlockState(store database.VaultStore) error {
+	data, err := store.GetHeader(unlockStateHeader)
+	if err != nil || data != nil {
+		return err
+	}
+	return setUnlockState(store, UnlockState{})
+}
+
+func setUnlockState(store database.VaultStore, state UnlockState) error {
+	body, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	key, err := unlockStateKey(store)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(body)
+	return database.SetHeader(store, unlockStateHeader, mac.Sum(body))
+}
+
+// SetWipeAfter turns on wiping the key material after n consecutive failed
+// unlocks, or off for 0. The vault must have been unlocked first.
+func SetWipeAfter(store database.VaultStore, n int) error {
+	if n < 0 {
+		return fmt.Errorf("the number of attempts must not be negative, got %d", n)
+	}
+	if n > 0 && n <= freeAttempts {
+		return fmt.Errorf("wiping after fewer than %d attempts makes a typo destroy the vault", freeAttempts+1)
+	}
+	state, _, err := GetUnlockState(store)
+	if err != nil {
+		return err
+	}
+	state.WipeAfter = n
+	return setUnlockState(store, state)
+}
+
+// checkLockout refuses an attempt made too soon after the last failure. A
+// tampered record locks the vault for the longest back-off.
+func checkLockout(store database.VaultStore, now time.Time) (UnlockState, error) {
+	state, tampered, err := GetUnlockState(store)
+	if err != nil {
+		return state, err
+	}
+	if tampered {
+		state = UnlockState{Failures: freeAttempts + 12, LastFailure: now, WipeAfter: state.WipeAfter}
+		if err = setUnlockState(store, state); err != nil {
+			return state, err
+		}
+		return state, &LockedOutError{Until: now.Add(state.Backoff()), Failures: state.Failures, Tampered: true}
+	}
+	if state.Wiped {
+		return state, ErrWiped
+	}
+	if until := state.LastFailure.Add(state.Backoff()); now.Before(until) {
+		return state, &LockedOutError{Until: until, Failures: state.Failures}
+	}
+	return state, nil
+}
+
+// recordFailure counts a failed unlock, wiping the key material once the
+// configured number of failures is reached.
+func recordFailure(store database.VaultStore, state UnlockState, now time.Time) error {
+	state.Failures++
+	state.LastFailure = now
+	if state.WipeAfter > 0 && state.Failures >= state.WipeAfter {
+		state.Wiped = true
+		if err := wipe(store); err != nil {
+			return err
+		}
+		// Without the salt the record is keyed with the local key alone
+		if err := setUnlockState(store, state); err != nil {
+			return err
+		}
+		return ErrWiped
+	}
+	if err := setUnlockState(store, state); err != nil {
+		return err
+	}
+	if left := state.AttemptsLeft(); left >= 0 {
+		return fmt.Errorf("%w, WARNING: the vault is wiped after %d more failed attempts", ErrInvalidPassword, left)
+	}
+	return ErrInvalidPassword
+}
+
+// wipe deletes the salt, the password check, the members and every wrapped
+// copy of the key, without which the key cannot be recovered. bbolt may
+// keep the old values in free pages until they are reused.
+func wipe(store database.VaultStore) error {
+	if err := store.DeleteMembers(); err != nil {
+		return err
+	}
+	return database.DeleteHeaders(store, "salt", "combinedTitle", wrappedKeyHeader, recoveryKeyHeader, sharedKeyHeader)
+}
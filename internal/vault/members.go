@@ -0,0 +1,171 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+)
+
+// requireOwner refuses what only the owner of a vault may do, given the
+// credentials it was unlocked with. Members share the vault key, but not
+// the means to change who can get at it.
+func requireOwner(creds Credentials, what string) error {
+	if creds.Member != "" {
+		return fmt.Errorf("only the owner of the vault can %s", what)
+	}
+	return nil
+}
+
+// A shared vault has members besides its owner, who unlocks it with the
+// vault password as before. Every member has an X25519 key pair whose
+// private key is encrypted under their own password. The vault key is
+// encrypted to each member's public key, so members can be added and the
+// key rotated without knowing anyone's password.
+
+// Member describes a member of a shared vault.
+type Member struct {
+	Name  string
+	Added time.Time
+	// Fingerprint identifies the public key of the member.
+	Fingerprint string
+}
+
+type memberRecord struct {
+	Added     time.Time `json:"added"`
+	PublicKey []byte    `json:"publicKey"`
+	// PrivateKey is encrypted under the key derived from the member's
+	// password and Salt.
+	Salt       []byte `json:"salt"`
+	PrivateKey []byte `json:"privateKey"`
+	// VaultKey is the vault key sealed to PublicKey from Ephemeral.
+	Ephemeral []byte `json:"ephemeral"`
+	VaultKey  []byte `json:"vaultKey"`
+}
+
+func (r memberRecord) member(name string) Member {
+	sum := sha256.Sum256(r.PublicKey)
+	return Member{Name: name, Added: r.Added, Fingerprint: strings.ToUpper(hex.EncodeToString(sum[:8]))}
+}
+
+// sealVaultKey encrypts the vault key to the member's public key.
+func (r *memberRecord) sealVaultKey(cipherKey32 []byte) error {
+	var err error
+	r.Ephemeral, r.VaultKey, err = cipher.SealTo(r.PublicKey, cipherKey32)
+	return err
+}
+
+func getMember(store database.VaultStore, name string) (*memberRecord, error) {
+	data, err := store.GetMember([]byte(name))
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var record memberRecord
+	if err = json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("member \"%s\": %w", name, err)
+	}
+	return &record, nil
+}
+
+// Members lists the members of a vault, ordered by name.
+func Members(store database.VaultStore) ([]Member, error) {
+	pairs, err := store.GetMembers()
+	if err != nil {
+		return nil, err
+	}
+	var members []Member
+	for _, pair := range pairs {
+		var record memberRecord
+		if err = json.Unmarshal(pair[1], &record); err != nil {
+			return nil, fmt.Errorf("member \"%s\": %w", pair[0], err)
+		}
+		members = append(members, record.member(string(pair[0])))
+	}
+	return members, nil
+}
+
+// AddMember gives a new member access to an unlocked vault. The member
+// unlocks it with their own password.
+func AddMember(store database.VaultStore, cipherKey32 []byte, name, password string) (Member, error) {
+	if strings.TrimSpace(name) == "" {
+		return Member{}, errors.New("member name is empty")
+	}
+	private, err := cipher.GenerateX25519()
+	if err != nil {
+		return Member{}, err
+	}
+	salt, err := cipher.GenerateRandomSalt()
+	if err != nil {
+		return Member{}, err
+	}
+	encrypted, err := cipher.EncryptAESGCM(cipher.DeriveEncryptionKey32([]byte(password), salt), private.Bytes())
+	if err != nil {
+		return Member{}, err
+	}
+	record := memberRecord{
+		Added:      time.Now(),
+		PublicKey:  private.PublicKey().Bytes(),
+		Salt:       salt,
+		PrivateKey: encrypted,
+	}
+	if err = record.sealVaultKey(cipherKey32); err != nil {
+		return Member{}, err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return Member{}, err
+	}
+	if err = store.AddMember([]byte(name), data); err != nil {
+		return Member{}, err
+	}
+	return record.member(name), nil
+}
+
+// RevokeMember removes a member and rotates the vault key and the key of
+// the audit log, so that a copy of the old keys kept by the member opens
+// nothing, old or new, and forges no log records. Only the
+// owner can revoke, as the owner's credentials are needed to protect the
+// new key; they are checked again here. The recovery key and shares cannot
+// be carried over and are removed. It returns the new key.
+func RevokeMember(store database.FileStore, owner Credentials, name string) ([]byte, error) {
+	if err := requireOwner(owner, "revoke members"); err != nil {
+		return nil, err
+	}
+	record, err := getMember(store, name)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, fmt.Errorf("member \"%s\" %w", name, database.ErrNotFound)
+	}
+	cipherKey32, err := Unlock(store, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	return rotateKey(store, cipherKey32, owner, name)
+}
+
+// memberKey returns the vault key as opened by a member, nil when the
+// member does not exist or the password is wrong.
+func memberKey(store database.VaultStore, name, password string) ([]byte, error) {
+	record, err := getMember(store, name)
+	if err != nil || record == nil {
+		return nil, err
+	}
+	private, err := cipher.DecryptAESGCM(cipher.DeriveEncryptionKey32([]byte(password), record.Salt), record.PrivateKey)
+	if err != nil {
+		return nil, nil
+	}
+	cipherKey32, err := cipher.OpenFrom(private, record.Ephemeral, record.VaultKey)
+	if err != nil {
+		return nil, nil
+	}
+	return cipherKey32, nil
+}
@@ -0,0 +1,173 @@
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+)
+
+const (
+	recoveryKeyHeader = "recoveryKey"
+
+	// recoveryKeySize of 20 bytes gives 160 bits, written as 32 base32
+	// characters in groups of four.
+	recoveryKeySize  = 20
+	recoveryKeyGroup = 4
+)
+
+var ErrNoRecoveryKey = errors.New("this vault has no recovery key")
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// FormatRecoveryKey writes a recovery key as groups of four characters,
+// such as "MZXW-6YTB-...".
+func FormatRecoveryKey(raw []byte) string {
+	encoded := recoveryEncoding.EncodeToString(raw)
+	var groups []string
+	for len(encoded) > recoveryKeyGroup {
+		groups = append(groups, encoded[:recoveryKeyGroup])
+		encoded = encoded[recoveryKeyGroup:]
+	}
+	return strings.Join(append(groups, encoded), "-")
+}
+
+// ParseRecoveryKey reads a recovery key as typed in from the emergency kit.
+func ParseRecoveryKey(key string) ([]byte, error) {
+	raw, err := decodeGrouped(key)
+	if err != nil || len(raw) != recoveryKeySize {
+		return nil, errors.New("this is not a recovery key, check it against the emergency kit")
+	}
+	return raw, nil
+}
+
+// decodeGrouped decodes a key written by FormatRecoveryKey. Case, spaces
+// and dashes do not matter, and the digits 0, 1 and 8, which base32 does
+// not use, are read as the letters they are mistaken for.
+func decodeGrouped(key string) ([]byte, error) {
+	key = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '\t', '\n':
+			return -1
+		case '0':
+			return 'O'
+		case '1':
+			return 'I'
+		case '8':
+			return 'B'
+		}
+		return r
+	}, strings.ToUpper(key))
+	return recoveryEncoding.DecodeString(key)
+}
+
+// HasRecoveryKey reports whether a vault can be recovered with a recovery
+// key.
+func HasRecoveryKey(store database.VaultStore) (bool, error) {
+	wrapped, err := store.GetHeader(recoveryKeyHeader)
+	return wrapped != nil, err
+}
+
+// NewRecoveryKey creates a recovery key for a vault unlocked with creds,
+// replacing any earlier one. The vault key is stored encrypted under the
+// recovery key, next to the copy protected by the password. Only the owner
+// can create one, as it sets new credentials in the end.
+func NewRecoveryKey(store database.VaultStore, cipherKey32 []byte, creds Credentials) (string, error) {
+	if err := requireOwner(creds, "create a recovery key"); err != nil {
+		return "", err
+	}
+	raw := make([]byte, recoveryKeySize)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	_, salt, err := database.GetHeaders(store)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := cipher.EncryptAESGCM(cipher.DeriveEncryptionKey32(raw, salt), cipherKey32)
+	if err != nil {
+		return "", err
+	}
+	if err = database.SetHeader(store, recoveryKeyHeader, wrapped); err != nil {
+		return "", err
+	}
+	return FormatRecoveryKey(raw), nil
+}
+
+func RemoveRecoveryKey(store database.VaultStore, creds Credentials) error {
+	if err := requireOwner(creds, "remove the recovery key"); err != nil {
+		return err
+	}
+	return database.DeleteHeaders(store, recoveryKeyHeader)
+}
+
+// Recover unlocks a vault with its recovery key. Failed attempts count
+// towards the back-off like wrong passwords. Callers should have the user
+// set new credentials with SetCredentials straight away.
+func Recover(store database.VaultStore, recoveryKey string) ([]byte, error) {
+	raw, err := ParseRecoveryKey(recoveryKey)
+	if err != nil {
+		return nil, err
+	}
+	return unlock(store, ownerActor, "recovery key", func(salt []byte) ([]byte, error) {
+		wrapped, err := store.GetHeader(recoveryKeyHeader)
+		if err != nil {
+			return nil, err
+		}
+		if wrapped == nil {
+			return nil, ErrNoRecoveryKey
+		}
+		cipherKey32, err := cipher.DecryptAESGCM(cipher.DeriveEncryptionKey32(raw, salt), wrapped)
+		if err != nil {
+			return nil, nil
+		}
+		return cipherKey32, nil
+	}, nil)
+}
+
+// Kit is a printable emergency kit, to be kept offline with the recovery
+// key on it.
+type Kit struct {
+	Vault       string
+	Path        string
+	Created     time.Time
+	RecoveryKey string
+	Keyfile     bool
+}
+
+func (k Kit) String() string {
+	var b strings.Builder
+	line := strings.Repeat("=", 64)
+	fmt.Fprintf(&b, "%s\n  SENTRYVAULT EMERGENCY KIT\n%s\n\n", line, line)
+	fmt.Fprintf(&b, "  Vault:        %s\n", k.Vault)
+	fmt.Fprintf(&b, "  Vault file:   %s\n", k.Path)
+	fmt.Fprintf(&b, "  Created:      %s\n\n", k.Created.Local().Format("2006-01-02 15:04"))
+
+	fmt.Fprintf(&b, "  Recovery key\n\n")
+	groups := strings.Split(k.RecoveryKey, "-")
+	for len(groups) > 0 {
+		n := min(4, len(groups))
+		fmt.Fprintf(&b, "      %s\n", strings.Join(groups[:n], "  "))
+		groups = groups[n:]
+	}
+
+	fmt.Fprintf(&b, "\n  Master password (optional):  ______________________________\n\n")
+	if k.Keyfile {
+		fmt.Fprintf(&b, "  This vault also needs its keyfile to unlock with the password.\n")
+		fmt.Fprintf(&b, "  The recovery key works without it.\n\n")
+	}
+
+	fmt.Fprintf(&b, "  If you forget your master password, run\n\n")
+	fmt.Fprintf(&b, "      sentryvault recover -vault %s\n\n", k.Vault)
+	fmt.Fprintf(&b, "  and type in the recovery key above. You then choose a new master\n")
+	fmt.Fprintf(&b, "  password. Anyone holding this kit and a copy of the vault file can\n")
+	fmt.Fprintf(&b, "  open the vault: print it, keep it somewhere safe and offline, and\n")
+	fmt.Fprintf(&b, "  do not store it next to the vault.\n")
+	fmt.Fprintf(&b, "\n%s\n", line)
+	return b.String()
+}
@@ -0,0 +1,224 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+	"github.com/AdityaKK0407/sentryvault/internal/shamir"
+)
+
+const (
+	sharedKeyHeader = "sharedKey"
+
+	shareVersion  = 1
+	vaultIDSize   = 8
+	checksumSize  = 4
+	encodedShare  = 1 + vaultIDSize + 1 + 1 + recoveryKeySize + checksumSize
+	shareChecksum = "sentryvault share"
+)
+
+var ErrNoShares = errors.New("this vault was not split into shares")
+
+// VaultID identifies a vault for its shares. It is taken from the salt, so
+// it stays the same across password changes and in backups of the vault.
+func VaultID(store database.VaultStore) (string, error) {
+	salt, err := store.GetHeader("salt")
+	if err != nil {
+		return "", err
+	}
+	if salt == nil {
+		return "", errors.New("the vault has no salt")
+	}
+	sum := sha256.Sum256(append([]byte("sentryvault vault id"), salt...))
+	return strings.ToUpper(hex.EncodeToString(sum[:vaultIDSize])), nil
+}
+
+// Share is one part of a vault recovery secret split with SplitRecovery.
+type Share struct {
+	VaultID   string
+	Threshold int
+	share     shamir.Share
+}
+
+// Index returns the number of the share, starting at 1.
+func (s Share) Index() int {
+	return int(s.share.X)
+}
+
+// Code returns the share as grouped base32 with a checksum, to be typed
+// back in with ParseShare.
+func (s Share) Code() string {
+	id, _ := hex.DecodeString(s.VaultID)
+	data := []byte{shareVersion}
+	data = append(data, id...)
+	data = append(data, byte(s.Threshold), s.share.X)
+	data = append(data, s.share.Y...)
+	return FormatRecoveryKey(append(data, shareSum(data)...))
+}
+
+// Block returns the share as a text block for printing and handing out.
+func (s Share) Block(vaultName string, shares int) string {
+	var b strings.Builder
+	line := strings.Repeat("=", 64)
+	fmt.Fprintf(&b, "%s\n  SENTRYVAULT RECOVERY SHARE %d OF %d\n%s\n\n", line, s.Index(), shares, line)
+	fmt.Fprintf(&b, "  Vault:      %s\n", vaultName)
+	fmt.Fprintf(&b, "  Vault ID:   %s\n", s.VaultID)
+	fmt.Fprintf(&b, "  Needed:     %d of %d shares\n\n", s.Threshold, shares)
+	groups := strings.Split(s.Code(), "-")
+	for len(groups) > 0 {
+		n := min(7, len(groups))
+		fmt.Fprintf(&b, "      %s\n", strings.Join(groups[:n], "  "))
+		groups = groups[n:]
+	}
+	fmt.Fprintf(&b, "\n  To recover the vault, %d holders run\n\n", s.Threshold)
+	fmt.Fprintf(&b, "      sentryvault recover -vault %s -shares\n\n", vaultName)
+	fmt.Fprintf(&b, "  and type in their shares. Keep this share to yourself.\n")
+	fmt.Fprintf(&b, "\n%s\n", line)
+	return b.String()
+}
+
+func shareSum(data []byte) []byte {
+	sum := sha256.Sum256(append([]byte(shareChecksum), data...))
+	return sum[:checksumSize]
+}
+
+// ParseShare reads a share code, checking its checksum so that typos are
+// caught before the shares are combined.
+func ParseShare(code string) (Share, error) {
+	data, err := decodeGrouped(code)
+	if err != nil || len(data) != encodedShare {
+		return Share{}, errors.New("this is not a recovery share, check it against the printed share")
+	}
+	body, sum := data[:len(data)-checksumSize], data[len(data)-checksumSize:]
+	if !bytes.Equal(sum, shareSum(body)) {
+		return Share{}, errors.New("the share has a typo, its checksum does not match")
+	}
+	if body[0] != shareVersion {
+		return Share{}, fmt.Errorf("unsupported share version %d", body[0])
+	}
+	id := body[1 : 1+vaultIDSize]
+	threshold, x := body[1+vaultIDSize], body[2+vaultIDSize]
+	return Share{
+		VaultID:   strings.ToUpper(hex.EncodeToString(id)),
+		Threshold: int(threshold),
+		share:     shamir.Share{X: x, Y: bytes.Clone(body[3+vaultIDSize:])},
+	}, nil
+}
+
+// HasShares reports whether a vault can be recovered with shares.
+func HasShares(store database.VaultStore) (bool, error) {
+	wrapped, err := store.GetHeader(sharedKeyHeader)
+	return wrapped != nil, err
+}
+
+// SplitRecovery creates a recovery secret for a vault unlocked with creds
+// and splits it into n shares, any k of which recover the vault. It
+// replaces any earlier shares and is separate from the recovery key of the
+// emergency kit. Only the owner can split, like NewRecoveryKey.
+func SplitRecovery(store database.VaultStore, cipherKey32 []byte, creds Credentials, n, k int) ([]Share, error) {
+	if err := requireOwner(creds, "split the vault into shares"); err != nil {
+		return nil, err
+	}
+	secret := make([]byte, recoveryKeySize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	parts, err := shamir.Split(secret, n, k)
+	if err != nil {
+		return nil, err
+	}
+	id, err := VaultID(store)
+	if err != nil {
+		return nil, err
+	}
+	_, salt, err := database.GetHeaders(store)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := cipher.EncryptAESGCM(cipher.DeriveEncryptionKey32(secret, salt), cipherKey32)
+	if err != nil {
+		return nil, err
+	}
+
+	// The threshold is stored next to the key so that it cannot be lowered
+	// by editing a share
+	header := binary.BigEndian.AppendUint16(nil, uint16(k))
+	if err = database.SetHeader(store, sharedKeyHeader, append(header, wrapped...)); err != nil {
+		return nil, err
+	}
+
+	shares := make([]Share, len(parts))
+	for i, part := range parts {
+		shares[i] = Share{VaultID: id, Threshold: k, share: part}
+	}
+	return shares, nil
+}
+
+func RemoveShares(store database.VaultStore, creds Credentials) error {
+	if err := requireOwner(creds, "remove the recovery shares"); err != nil {
+		return err
+	}
+	return database.DeleteHeaders(store, sharedKeyHeader)
+}
+
+// CheckShare checks that a share belongs to the vault, returning the number
+// of shares needed.
+func CheckShare(store database.VaultStore, share Share) (int, error) {
+	id, err := VaultID(store)
+	if err != nil {
+		return 0, err
+	}
+	if share.VaultID != id {
+		return 0, fmt.Errorf("share %d belongs to the vault with ID %s, not %s", share.Index(), share.VaultID, id)
+	}
+	data, err := store.GetHeader(sharedKeyHeader)
+	if err != nil {
+		return 0, err
+	}
+	if len(data) < 2 {
+		return 0, ErrNoShares
+	}
+	return int(binary.BigEndian.Uint16(data)), nil
+}
+
+// RecoverShares unlocks a vault with at least the threshold number of its
+// shares. Failed attempts count towards the back-off like wrong passwords.
+func RecoverShares(store database.VaultStore, shares []Share) ([]byte, error) {
+	var parts []shamir.Share
+	for _, share := range shares {
+		threshold, err := CheckShare(store, share)
+		if err != nil {
+			return nil, err
+		}
+		if len(shares) < threshold {
+			return nil, fmt.Errorf("%d of %d shares given", len(shares), threshold)
+		}
+		parts = append(parts, share.share)
+	}
+	secret, err := shamir.Combine(parts)
+	if err != nil {
+		return nil, err
+	}
+	return unlock(store, ownerActor, "recovery shares", func(salt []byte) ([]byte, error) {
+		data, err := store.GetHeader(sharedKeyHeader)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) < 2 {
+			return nil, ErrNoShares
+		}
+		cipherKey32, err := cipher.DecryptAESGCM(cipher.DeriveEncryptionKey32(secret, salt), data[2:])
+		if err != nil {
+			return nil, nil
+		}
+		return cipherKey32, nil
+	}, nil)
+}
@@ -0,0 +1,388 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+	"github.com/AdityaKK0407/sentryvault/internal/config"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+	bolt "go.etcd.io/bbolt"
+)
+
+var ErrInvalidPassword = errors.New("invalid password")
+
+// Info describes a vault file on disk.
+type Info struct {
+	Name     string
+	Size     int64
+	Modified time.Time
+}
+
+// List returns every vault ordered by name.
+func List() ([]Info, error) {
+	files, err := database.GetDBFiles()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(files)
+
+	var vaults []Info
+	for _, file := range files {
+		name := strings.TrimSuffix(file, ".db")
+		path, err := database.DBPath(name)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		vaults = append(vaults, Info{Name: name, Size: info.Size(), Modified: info.ModTime()})
+	}
+	return vaults, nil
+}
+
+// Exists reports whether a vault with the given name exists.
+func Exists(username string) (bool, error) {
+	files, err := database.GetDBFiles()
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(files, username+".db"), nil
+}
+
+// ValidateName checks that a vault name can be used as a file name.
+func ValidateName(username string) error {
+	switch {
+	case strings.TrimSpace(username) == "":
+		return errors.New("vault name is empty")
+	case strings.ContainsAny(username, `/\`):
+		return errors.New("vault name cannot contain slashes")
+	case strings.HasPrefix(username, "."):
+		return errors.New("vault name cannot start with a dot")
+	}
+	return nil
+}
+
+// Create makes a new vault protected by the given credentials and returns
+// it open, together with its key.
+func Create(username string, creds Credentials) (*database.BoltStore, []byte, error) {
+	if err := ValidateName(username); err != nil {
+		return nil, nil, err
+	}
+	exists, err := Exists(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	if exists {
+		return nil, nil, fmt.Errorf("vault \"%s\" %w", username, database.ErrExists)
+	}
+
+	db, err := database.Open(username)
+	if err != nil {
+		return nil, nil, err
+	}
+	store := database.NewBoltStore(db)
+	cipherKey32, err := Init(store, username, creds)
+	if err == nil {
+		err = lockDecoy(username)
+	}
+	if err != nil {
+		store.Close()
+		database.DeleteDB(username)
+		return nil, nil, err
+	}
+	return store, cipherKey32, nil
+}
+
+// Init writes the headers of a new vault, starts its record of failed
+// unlocks and its audit log, and returns its key.
+func Init(store database.VaultStore, username string, creds Credentials) ([]byte, error) {
+	input, err := creds.input()
+	if err != nil {
+		return nil, err
+	}
+	salt, err := cipher.GenerateRandomSalt()
+	if err != nil {
+		return nil, err
+	}
+	cipherKey32 := cipher.DeriveEncryptionKey32(input, salt)
+
+	title := username + "'s Vault"
+	combinedTitle, err := cipher.EncryptAESGCM(cipherKey32, []byte(title))
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string][]byte{"combinedTitle": combinedTitle, "salt": salt}
+	if creds.Keyfile != "" {
+		headers[keyfileHeader] = []byte("required")
+	}
+	if err = store.PutHeaders(headers); err != nil {
+		return nil, err
+	}
+	if err = setUnlockState(store, UnlockState{}); err != nil {
+		return nil, err
+	}
+	if err = auditlog.Start(store, cipherKey32, ownerActor); err != nil {
+		return nil, err
+	}
+	if err = database.SetSchemaVersion(store, database.SchemaVersion()); err != nil {
+		return nil, err
+	}
+	return cipherKey32, nil
+}
+
+// Unlock checks the credentials of an open vault and returns its key.
+// Failed attempts are recorded in the vault, see UnlockState.
+func Unlock(store database.VaultStore, creds Credentials) ([]byte, error) {
+	return unlock(store, creds.Actor(), "password", func(salt []byte) ([]byte, error) {
+		return credentialKey(store, creds, salt)
+	}, nil)
+}
+
+// credentialKey derives the vault key from the credentials, nil when they
+// are wrong.
+func credentialKey(store database.VaultStore, creds Credentials, salt []byte) ([]byte, error) {
+	if creds.Member != "" {
+		return memberKey(store, creds.Member, creds.Password)
+	}
+	// A missing keyfile is a mistake rather than a guess, so it is not
+	// counted as a failure
+	input, err := creds.inputFor(store)
+	if err != nil {
+		return nil, err
+	}
+	return unwrap(store, cipher.DeriveEncryptionKey32(input, salt))
+}
+
+// unlock derives the vault key with derive, which returns nil for a wrong
+// secret, and checks it against the header. It applies the back-off of
+// failed attempts and logs the unlock for actor, saying what was used. A
+// vault written by a newer version is refused before any secret is tried.
+// upgrade, when given, migrates the vault once unlocked, before anything
+// is written to it.
+func unlock(store database.VaultStore, actor, with string, derive func(salt []byte) ([]byte, error), upgrade func(cipherKey32 []byte) error) ([]byte, error) {
+	if _, err := database.PendingMigrations(store); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	state, err := checkLockout(store, now)
+	if err != nil {
+		return nil, err
+	}
+
+	combinedTitle, salt, err := database.GetHeaders(store)
+	if err != nil {
+		return nil, err
+	}
+	cipherKey32, err := derive(salt)
+	if err != nil {
+		return nil, err
+	}
+	if cipherKey32 == nil {
+		return nil, recordFailure(store, state, now)
+	}
+	if _, err = cipher.DecryptAESGCM(cipherKey32, combinedTitle); err != nil {
+		return nil, recordFailure(store, state, now)
+	}
+	if upgrade != nil {
+		if err = upgrade(cipherKey32); err != nil {
+			return nil, err
+		}
+	}
+
+	detail := with
+	if state.Failures > 0 {
+		detail = fmt.Sprintf("%s, after %d failed attempts", with, state.Failures)
+		state.Failures = 0
+		state.LastFailure = time.Time{}
+		if err = setUnlockState(store, state); err != nil {
+			return nil, err
+		}
+	}
+	if err = auditlog.NewLogger(store, cipherKey32, actor).Log(auditlog.Unlock, "", "", detail); err != nil {
+		return nil, err
+	}
+	return cipherKey32, nil
+}
+
+// Open opens an existing vault and unlocks it. Given the duress password
+// it opens the decoy instead, see SetDuress. The caller closes the
+// store.
+func Open(username string, creds Credentials) (*database.BoltStore, []byte, error) {
+	store, cipherKey32, _, err := open(username, creds)
+	return store, cipherKey32, err
+}
+
+// open is Open, also reporting whether the decoy was opened.
+func open(username string, creds Credentials) (*database.BoltStore, []byte, bool, error) {
+	exists, err := Exists(username)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if !exists {
+		return nil, nil, false, fmt.Errorf("vault \"%s\" %w", username, database.ErrNotFound)
+	}
+
+	// A vault written by an older version is backed up before anything
+	// writes to it, even the record of a failed attempt
+	backup, err := backupOutdated(username)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	db, err := database.Open(username)
+	if err != nil {
+		discard(backup)
+		return nil, nil, false, err
+	}
+	store := database.NewBoltStore(db)
+	// Both verifiers are always checked, so that the time taken does not
+	// tell which of the passwords was given. The decoy is tried first, so
+	// that the duress password opens it even while the vault is locked out
+	// and tells nothing of the lockout.
+	decoyKey := openDecoy(username, creds.Password)
+	unlocked := false
+	cipherKey32, err := unlock(store, creds.Actor(), "password", func(salt []byte) ([]byte, error) {
+		cipherKey32, err := credentialKey(store, creds, salt)
+		if decoyKey != nil && (err != nil || !verify(store, cipherKey32)) {
+			return nil, errDecoy
+		}
+		return cipherKey32, err
+	}, func(cipherKey32 []byte) error {
+		unlocked = true
+		return migrate(db, username, backup, upgrade(cipherKey32, creds.Actor(), username))
+	})
+	var locked *LockedOutError
+	if decoyKey != nil && (errors.As(err, &locked) || errors.Is(err, ErrWiped)) {
+		err = errDecoy
+	}
+	if !unlocked {
+		// The vault was not unlocked, so it is not migrated either
+		discard(backup)
+	}
+	if errors.Is(err, errDecoy) {
+		store.Close()
+		if db, err = database.OpenDecoy(username); err != nil {
+			return nil, nil, false, err
+		}
+		decoy := database.NewBoltStore(db)
+		// The decoy keeps a log of its own, like any vault. It is migrated
+		// without a backup, which would leave a trace of it, and has no
+		// decoy of its own
+		up := upgrade(decoyKey, creds.Actor(), "")
+		if _, err = database.Migrate(db, up); err == nil {
+			err = auditlog.NewLogger(decoy, decoyKey, creds.Actor()).Log(auditlog.Unlock, "", "", "password")
+		}
+		if err != nil {
+			decoy.Close()
+			return nil, nil, false, err
+		}
+		return decoy, decoyKey, true, nil
+	}
+	if err != nil {
+		store.Close()
+		return nil, nil, false, err
+	}
+	return store, cipherKey32, false, nil
+}
+
+// upgrade returns what the migrations of a vault need, unlocked with
+// cipherKey32 by actor. The decoy of the vault named username is added when
+// it has none, an empty username adds none.
+func upgrade(cipherKey32 []byte, actor, username string) database.Upgrade {
+	up := database.Upgrade{
+		CipherKey32:      cipherKey32,
+		StartUnlockState: startUnlockState,
+		StartLog: func(store database.VaultStore) error {
+			return auditlog.Start(store, cipherKey32, actor)
+		},
+	}
+	if username != "" {
+		up.AddDecoy = func() error { return ensureDecoy(username) }
+	}
+	return up
+}
+
+// backupOutdated backs up a vault written by an older version as that
+// version left it, and refuses one written by a newer version. The vault is
+// only read. It returns the path of the backup, "" when the vault is up to
+// date.
+func backupOutdated(username string) (string, error) {
+	db, err := database.OpenReadOnly(username)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	pending, err := database.PendingMigrations(database.NewBoltStore(db))
+	if err != nil || pending == 0 {
+		return "", err
+	}
+	path, err := database.Snapshot(db, username)
+	if err != nil {
+		return "", fmt.Errorf("error backing up the vault before migrating it: %w", err)
+	}
+	return path, nil
+}
+
+// discard deletes the backup taken by backupOutdated for a vault that was
+// not unlocked, so that failed attempts do not pile up backups.
+func discard(backup string) {
+	if backup != "" {
+		os.Remove(backup)
+	}
+}
+
+// migrate brings a vault written by an older version up to the current
+// schema. backup is the one taken by backupOutdated, the oldest backups
+// beyond retention are only deleted now that the vault is unlocked.
+func migrate(db *bolt.DB, username, backup string, up database.Upgrade) error {
+	if backup == "" {
+		return nil
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if err = database.PruneBackups(username, cfg.Backup.Retention); err != nil {
+		return err
+	}
+	_, err = database.Migrate(db, up)
+	return err
+}
+
+// verify reports whether a key opens the password check of a vault.
+func verify(store database.VaultStore, cipherKey32 []byte) bool {
+	if cipherKey32 == nil {
+		return false
+	}
+	combinedTitle, _, err := database.GetHeaders(store)
+	if err != nil {
+		return false
+	}
+	_, err = cipher.DecryptAESGCM(cipherKey32, combinedTitle)
+	return err == nil
+}
+
+// Delete removes a vault after checking its credentials. The vault must not
+// be open. Its backups are kept.
+func Delete(username string, creds Credentials) error {
+	store, _, decoy, err := open(username, creds)
+	if err != nil {
+		return err
+	}
+	if decoy {
+		store.Close()
+		return ErrInvalidPassword
+	}
+	if err = store.Close(); err != nil {
+		return err
+	}
+	return database.DeleteDB(username)
+}
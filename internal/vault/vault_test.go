@@ -0,0 +1,885 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdityaKK0407/sentryvault/internal/auditlog"
+	"github.com/AdityaKK0407/sentryvault/internal/cipher"
+	"github.com/AdityaKK0407/sentryvault/internal/database"
+	bolt "go.etcd.io/bbolt"
+)
+
+func setConfigDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+}
+
+// The credentials, lockout, recovery and members of a vault are kept in its
+// store, so they work on any VaultStore.
+func TestMemoryStore(t *testing.T) {
+	setConfigDir(t)
+	store := database.NewMemoryStore()
+	owner := Credentials{Password: "secret"}
+	created, err := Init(store, "alice", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Unlock(store, Credentials{Password: "wrong"}); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("Unlock with a wrong password = %v, want ErrInvalidPassword", err)
+	}
+	if state, _, err := GetUnlockState(store); err != nil || state.Failures != 1 {
+		t.Fatalf("GetUnlockState after a failure = %+v, %v", state, err)
+	}
+	if key, err := Unlock(store, owner); err != nil || !bytes.Equal(key, created) {
+		t.Fatalf("Unlock = %v", err)
+	}
+
+	recoveryKey, err := NewRecoveryKey(store, created, owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := Recover(store, recoveryKey); err != nil || !bytes.Equal(key, created) {
+		t.Fatalf("Recover = %v", err)
+	}
+	if _, err = AddMember(store, created, "bob", "bob-password"); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := Unlock(store, Credentials{Member: "bob", Password: "bob-password"}); err != nil || !bytes.Equal(key, created) {
+		t.Fatalf("Unlock as a member = %v", err)
+	}
+}
+
+func TestCreateOpenDelete(t *testing.T) {
+	setConfigDir(t)
+
+	db, created, err := Create("alice", Credentials{Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = Create("alice", Credentials{Password: "other"}); !errors.Is(err, database.ErrExists) {
+		t.Fatalf("Create of an existing vault = %v, want ErrExists", err)
+	}
+
+	vaults, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vaults) != 1 || vaults[0].Name != "alice" || vaults[0].Size == 0 {
+		t.Fatalf("List = %+v, want alice", vaults)
+	}
+
+	if _, _, err = Open("alice", Credentials{Password: "wrong"}); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("Open with a wrong password = %v, want ErrInvalidPassword", err)
+	}
+	db, opened, err := Open("alice", Credentials{Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+	if !bytes.Equal(created, opened) {
+		t.Fatal("Open returned a different key than Create")
+	}
+
+	if err = Delete("alice", Credentials{Password: "wrong"}); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("Delete with a wrong password = %v, want ErrInvalidPassword", err)
+	}
+	if err = Delete("alice", Credentials{Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := Exists("alice"); err != nil || exists {
+		t.Fatalf("Exists after Delete = %v, %v", exists, err)
+	}
+	if _, _, err = Open("alice", Credentials{Password: "secret"}); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("Open of a deleted vault = %v, want ErrNotFound", err)
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, name := range []string{"", "  ", "../bob", `a\b`, ".hidden"} {
+		if ValidateName(name) == nil {
+			t.Errorf("ValidateName(%q) = nil, want an error", name)
+		}
+	}
+	if err := ValidateName("bob"); err != nil {
+		t.Errorf("ValidateName(\"bob\") = %v", err)
+	}
+}
+
+func TestUnlockBackoff(t *testing.T) {
+	setConfigDir(t)
+	db, _, err := Create("alice", Credentials{Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for range freeAttempts {
+		if _, err = Unlock(db, Credentials{Password: "wrong"}); !errors.Is(err, ErrInvalidPassword) {
+			t.Fatalf("Unlock with a wrong password = %v, want ErrInvalidPassword", err)
+		}
+	}
+	var locked *LockedOutError
+	if _, err = Unlock(db, Credentials{Password: "secret"}); !errors.As(err, &locked) || locked.Failures != freeAttempts {
+		t.Fatalf("Unlock right after %d failures = %v, want a LockedOutError", freeAttempts, err)
+	}
+
+	// Let the back-off pass
+	state, _, _ := GetUnlockState(db)
+	state.LastFailure = state.LastFailure.Add(-time.Minute)
+	if err = setUnlockState(db, state); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Unlock(db, Credentials{Password: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if state, _, _ = GetUnlockState(db); state.Failures != 0 {
+		t.Fatalf("Failures after a successful unlock = %d, want 0", state.Failures)
+	}
+}
+
+func TestUnlockStateTampered(t *testing.T) {
+	setConfigDir(t)
+	db, _, err := Create("alice", Credentials{Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err = Unlock(db, Credentials{Password: "wrong"}); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatal(err)
+	}
+	data, _ := db.GetHeader(unlockStateHeader)
+	data = bytes.Replace(data, []byte(`"failures":1`), []byte(`"failures":0`), 1)
+	if err = database.SetHeader(db, unlockStateHeader, data); err != nil {
+		t.Fatal(err)
+	}
+
+	var locked *LockedOutError
+	if _, err = Unlock(db, Credentials{Password: "secret"}); !errors.As(err, &locked) || !locked.Tampered {
+		t.Fatalf("Unlock with an edited record = %v, want a tampered LockedOutError", err)
+	}
+
+	// Deleting the record does not reset the counter either
+	if err = database.DeleteHeaders(db, unlockStateHeader); err != nil {
+		t.Fatal(err)
+	}
+	if _, tampered, err := GetUnlockState(db); err != nil || !tampered {
+		t.Fatalf("GetUnlockState without a record = %v, %v, want tampered", tampered, err)
+	}
+
+	// Nor does rewriting it with the salt, which is in the file
+	salt, _ := db.GetHeader("salt")
+	body := []byte(`{"failures":0,"lastFailure":"0001-01-01T00:00:00Z"}`)
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte("sentryvault unlock state"))
+	mac = hmac.New(sha256.New, mac.Sum(nil))
+	mac.Write(body)
+	if err = database.SetHeader(db, unlockStateHeader, mac.Sum(body)); err != nil {
+		t.Fatal(err)
+	}
+	if _, tampered, err := GetUnlockState(db); err != nil || !tampered {
+		t.Fatalf("GetUnlockState of a record keyed with the salt = %v, %v, want tampered", tampered, err)
+	}
+
+	// Resetting a tampered record keeps wiping on
+	body = []byte(`{"failures":0,"lastFailure":"0001-01-01T00:00:00Z","wipeAfter":5}`)
+	if err = database.SetHeader(db, unlockStateHeader, append(body, make([]byte, sha256.Size)...)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Unlock(db, Credentials{Password: "secret"}); !errors.As(err, &locked) || !locked.Tampered {
+		t.Fatalf("Unlock with a forged record = %v, want a tampered LockedOutError", err)
+	}
+	if state, tampered, _ := GetUnlockState(db); tampered || state.WipeAfter != 5 {
+		t.Fatalf("WipeAfter after a tamper = %d (tampered %v), want 5", state.WipeAfter, tampered)
+	}
+}
+
+func TestUnlockStatePreSeries(t *testing.T) {
+	setConfigDir(t)
+	db, _, err := Create("alice", Credentials{Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// A vault written before unlock records or schema versions has neither
+	if err = database.DeleteHeaders(db, unlockStateHeader, "schemaVersion"); err != nil {
+		t.Fatal(err)
+	}
+	if _, tampered, err := GetUnlockState(db); err != nil || tampered {
+		t.Fatalf("GetUnlockState of a pre-series vault = %v, %v, want a fresh record", tampered, err)
+	}
+	if _, err = Unlock(db, Credentials{Password: "secret"}); err != nil {
+		t.Fatalf("Unlock of a pre-series vault = %v", err)
+	}
+}
+
+func TestWipe(t *testing.T) {
+	setConfigDir(t)
+	db, _, err := Create("alice", Credentials{Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err = SetWipeAfter(db, freeAttempts); err == nil {
+		t.Fatal("SetWipeAfter accepted too few attempts")
+	}
+	if err = SetWipeAfter(db, 5); err != nil {
+		t.Fatal(err)
+	}
+	state, _, _ := GetUnlockState(db)
+	state.Failures = 4
+	if err = recordFailure(db, state, time.Now()); !errors.Is(err, ErrWiped) {
+		t.Fatalf("recordFailure at the limit = %v, want ErrWiped", err)
+	}
+	if _, err = Unlock(db, Credentials{Password: "secret"}); !errors.Is(err, ErrWiped) {
+		t.Fatalf("Unlock of a wiped vault = %v, want ErrWiped", err)
+	}
+	if salt, _ := db.GetHeader("salt"); salt != nil {
+		t.Fatal("salt was not wiped")
+	}
+}
+
+func TestKeyfile(t *testing.T) {
+	setConfigDir(t)
+	dir := t.TempDir()
+	keyfile, other := filepath.Join(dir, "key"), filepath.Join(dir, "other")
+	for _, path := range []string{keyfile, other} {
+		if err := GenerateKeyfile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := GenerateKeyfile(keyfile); err == nil {
+		t.Fatal("GenerateKeyfile overwrote an existing file")
+	}
+
+	db, created, err := Create("alice", Credentials{Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	value, err := cipher.EncryptAESGCM(created, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.CreateEntry([]byte("aws"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Insert([]byte("aws"), []byte("key"), value, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Adding a keyfile rotates the key, so the one derived from the
+	// password alone opens nothing
+	added, err := SetCredentials(db, created, Credentials{Password: "secret", Keyfile: keyfile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(added, created) {
+		t.Fatal("adding a keyfile did not rotate the key")
+	}
+	_, salt, _ := database.GetHeaders(db)
+	if verify(db, cipher.DeriveEncryptionKey32([]byte("secret"), salt)) {
+		t.Fatal("the key derived from the password alone still opens the vault")
+	}
+
+	if _, err = Unlock(db, Credentials{Password: "secret"}); !errors.Is(err, ErrKeyfileRequired) {
+		t.Fatalf("Unlock without the keyfile = %v, want ErrKeyfileRequired", err)
+	}
+	if _, err = Unlock(db, Credentials{Password: "secret", Keyfile: other}); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("Unlock with another keyfile = %v, want ErrInvalidPassword", err)
+	}
+	if key, err := Unlock(db, Credentials{Password: "secret", Keyfile: keyfile}); err != nil || !bytes.Equal(key, added) {
+		t.Fatalf("Unlock with the keyfile = %v", err)
+	}
+
+	// Dropping it rotates the key again, and the data follows
+	dropped, err := SetCredentials(db, added, Credentials{Password: "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = Unlock(db, Credentials{Password: "new", Keyfile: keyfile}); !errors.Is(err, ErrNoKeyfile) {
+		t.Fatalf("Unlock with a keyfile that is no longer needed = %v, want ErrNoKeyfile", err)
+	}
+	if key, err := Unlock(db, Credentials{Password: "new"}); err != nil || !bytes.Equal(key, dropped) {
+		t.Fatalf("Unlock without the keyfile = %v", err)
+	}
+	if value, _, err = db.Retrieve([]byte("aws"), []byte("key")); err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := cipher.DecryptAESGCM(dropped, value); err != nil || string(plain) != "secret" {
+		t.Fatalf("value under the new key = %q, %v", plain, err)
+	}
+}
+
+func TestRecoveryKey(t *testing.T) {
+	setConfigDir(t)
+	db, created, err := Create("alice", Credentials{Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err = Recover(db, FormatRecoveryKey(make([]byte, recoveryKeySize))); !errors.Is(err, ErrNoRecoveryKey) {
+		t.Fatalf("Recover without a recovery key = %v, want ErrNoRecoveryKey", err)
+	}
+	key, err := NewRecoveryKey(db, created, Credentials{Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(strings.Split(key, "-")) != 8 {
+		t.Fatalf("recovery key %q is not in 8 groups", key)
+	}
+
+	if _, err = Recover(db, "not a key"); err == nil {
+		t.Fatal("Recover accepted a malformed key")
+	}
+	if _, err = Recover(db, FormatRecoveryKey(make([]byte, recoveryKeySize))); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("Recover with a wrong key = %v, want ErrInvalidPassword", err)
+	}
+	// Typed in lower case without dashes
+	recovered, err := Recover(db, strings.ToLower(strings.ReplaceAll(key, "-", " ")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(recovered, created) {
+		t.Fatal("Recover returned a different key")
+	}
+
+	// The new password comes with a new key, so neither the old password
+	// nor the recovery key opens the vault any more
+	reset, err := SetCredentials(db, recovered, Credentials{Password: "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := Unlock(db, Credentials{Password: "new"}); err != nil || !bytes.Equal(key, reset) {
+		t.Fatalf("Unlock with the new password = %v", err)
+	}
+	_, salt, _ := database.GetHeaders(db)
+	if verify(db, cipher.DeriveEncryptionKey32([]byte("secret"), salt)) {
+		t.Fatal("the key derived from the old password still opens the vault")
+	}
+	if _, err = Recover(db, key); !errors.Is(err, ErrNoRecoveryKey) {
+		t.Fatalf("Recover after a reset = %v, want ErrNoRecoveryKey", err)
+	}
+}
+
+func TestParseRecoveryKey(t *testing.T) {
+	raw := []byte("0123456789abcdefghij")
+	key := FormatRecoveryKey(raw)
+	// Digits that look like letters are read as those letters
+	typo := strings.NewReplacer("O", "0", "I", "1", "B", "8").Replace(key)
+	for _, typed := range []string{key, strings.ToLower(key), typo} {
+		got, err := ParseRecoveryKey(typed)
+		if err != nil || !bytes.Equal(got, raw) {
+			t.Errorf("ParseRecoveryKey(%q) = %x, %v", typed, got, err)
+		}
+	}
+}
+
+func TestShares(t *testing.T) {
+	setConfigDir(t)
+	db, created, err := Create("team", Credentials{Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	shares, err := SplitRecovery(db, created, Credentials{Password: "secret"}, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed []Share
+	for _, share := range []Share{shares[4], shares[0], shares[2]} {
+		p, err := ParseShare(strings.ToLower(share.Code()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed = append(parsed, p)
+	}
+	if _, err = RecoverShares(db, parsed[:2]); err == nil {
+		t.Fatal("RecoverShares accepted fewer shares than the threshold")
+	}
+	recovered, err := RecoverShares(db, parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(recovered, created) {
+		t.Fatal("RecoverShares returned a different key")
+	}
+
+	// A typo is caught by the checksum
+	code := []byte(shares[1].Code())
+	code[5] = map[bool]byte{true: 'B', false: 'A'}[code[5] == 'A']
+	if _, err = ParseShare(string(code)); err == nil {
+		t.Fatal("ParseShare accepted a share with a typo")
+	}
+
+	// Shares of another vault are refused
+	other, otherKey, err := Create("other", Credentials{Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if _, err = SplitRecovery(other, otherKey, Credentials{Password: "secret"}, 3, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = RecoverShares(other, parsed); err == nil {
+		t.Fatal("RecoverShares accepted shares of another vault")
+	}
+}
+
+func TestMembers(t *testing.T) {
+	setConfigDir(t)
+	owner := Credentials{Password: "owner"}
+	db, created, err := Create("team", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, name := range []string{"bob", "carol"} {
+		if _, err = AddMember(db, created, name, name+"-password"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = AddMember(db, created, "bob", "again"); !errors.Is(err, database.ErrExists) {
+		t.Fatalf("adding bob twice = %v, want ErrExists", err)
+	}
+	members, err := Members(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || members[0].Name != "bob" || members[1].Name != "carol" {
+		t.Fatalf("Members = %+v", members)
+	}
+
+	bob, err := Unlock(db, Credentials{Member: "bob", Password: "bob-password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bob, created) {
+		t.Fatal("bob unlocked a different key")
+	}
+	if _, err = Unlock(db, Credentials{Member: "bob", Password: "carol-password"}); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("bob with carol's password = %v, want ErrInvalidPassword", err)
+	}
+
+	// Members cannot make themselves the owner or mint a way back in
+	member := Credentials{Member: "bob", Password: "bob-password"}
+	if _, err = SetCredentials(db, bob, member); err == nil {
+		t.Fatal("a member set the credentials of the vault")
+	}
+	if _, err = NewRecoveryKey(db, bob, member); err == nil {
+		t.Fatal("a member created a recovery key")
+	}
+	if _, err = SplitRecovery(db, bob, member, 3, 2); err == nil {
+		t.Fatal("a member split the vault into shares")
+	}
+	if err = RemoveRecoveryKey(db, member); err == nil {
+		t.Fatal("a member removed the recovery key")
+	}
+	if has, err := HasRecoveryKey(db); err != nil || has {
+		t.Fatalf("HasRecoveryKey after a member tried = %v, %v", has, err)
+	}
+
+	secret, err := cipher.EncryptAESGCM(created, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.CreateEntry([]byte("aws"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Insert([]byte("aws"), []byte("key"), secret, nil); err != nil {
+		t.Fatal(err)
+	}
+	// A field with damaged metadata is quarantined together with its value
+	if err = db.Insert([]byte("aws"), []byte("token"), secret, []byte("damaged")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Check(created, true); err != nil {
+		t.Fatal(err)
+	}
+	if count, err := db.QuarantineCount(); err != nil || count != 1 {
+		t.Fatalf("QuarantineCount = %d, %v", count, err)
+	}
+	logKey, err := db.GetHeader("auditKey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldLogKey, err := cipher.DecryptAESGCM(created, logKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = RevokeMember(db, Credentials{Member: "carol", Password: "carol-password"}, "bob"); err == nil {
+		t.Fatal("a member revoked another member")
+	}
+	rotated, err := RevokeMember(db, owner, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(rotated, created) {
+		t.Fatal("revoking did not rotate the key")
+	}
+	if _, err = Unlock(db, Credentials{Member: "bob", Password: "bob-password"}); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("revoked bob = %v, want ErrInvalidPassword", err)
+	}
+	for _, creds := range []Credentials{owner, {Member: "carol", Password: "carol-password"}} {
+		key, err := Unlock(db, creds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key, rotated) {
+			t.Fatalf("%+v unlocked a different key", creds)
+		}
+	}
+	value, _, err := db.Retrieve([]byte("aws"), []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = cipher.DecryptAESGCM(created, value); err == nil {
+		t.Fatal("the old key still opens the vault")
+	}
+	if plain, err := cipher.DecryptAESGCM(rotated, value); err != nil || string(plain) != "secret" {
+		t.Fatalf("value under the new key = %q, %v", plain, err)
+	}
+	// bob knew the key of the audit log too, so it is replaced
+	if logKey, err = db.GetHeader("auditKey"); err != nil {
+		t.Fatal(err)
+	}
+	if newLogKey, err := cipher.DecryptAESGCM(rotated, logKey); err != nil || bytes.Equal(newLogKey, oldLogKey) {
+		t.Fatalf("the key of the audit log was not replaced: %v", err)
+	}
+
+	// The audit log follows the key and names who unlocked
+	result, err := auditlog.Verify(db, rotated)
+	if err != nil || !result.OK() {
+		t.Fatalf("Verify after the rotation = %+v, %v", result, err)
+	}
+	records, err := auditlog.Read(db, rotated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actors []string
+	for _, r := range records {
+		if r.Action == auditlog.Unlock {
+			actors = append(actors, r.Actor)
+		}
+	}
+	if got := strings.Join(actors, ","); got != "bob,owner,owner,carol" {
+		t.Fatalf("unlocks logged by %s", got)
+	}
+
+	// The quarantine is not part of the store, it is read from the file
+	db.Close()
+	file, err := database.Open("team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	err = file.View(func(tx *bolt.Tx) error {
+		quarantined := tx.Bucket([]byte("Quarantine")).Bucket(binary.BigEndian.AppendUint64(nil, 1)).Get([]byte("value"))
+		if plain, err := cipher.DecryptAESGCM(rotated, quarantined); err != nil || string(plain) != "secret" {
+			t.Errorf("quarantined value under the new key = %q, %v", plain, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDuress(t *testing.T) {
+	setConfigDir(t)
+	owner := Credentials{Password: "real"}
+	db, created, err := Create("travel", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := cipher.EncryptAESGCM(created, []byte("real secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.CreateEntry([]byte("bank"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Insert([]byte("bank"), []byte("pin"), secret, nil); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Every vault has a decoy, whether or not a duress password is set
+	path, err := database.DecoyPath("travel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = SetDuress("travel", owner, "real"); err == nil {
+		t.Fatal("SetDuress accepted the vault password")
+	}
+	if err = SetDuress("travel", Credentials{Password: "wrong"}, "decoy"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("SetDuress with a wrong password = %v, want ErrInvalidPassword", err)
+	}
+	if err = SetDuress("travel", owner, "decoy"); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Size() != after.Size() {
+		t.Errorf("setting a duress password changed the size of the decoy from %d to %d", before.Size(), after.Size())
+	}
+	vaults, err := List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vaults) != 1 {
+		t.Fatalf("List shows the decoy: %+v", vaults)
+	}
+
+	decoy, decoyKey, err := Open("travel", Credentials{Password: "decoy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := decoy.GetEntriesMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("the decoy shows the entries %q", entries)
+	}
+	if bytes.Equal(decoyKey, created) {
+		t.Fatal("the duress password opened the real key")
+	}
+	// The decoy locks and unlocks like any vault
+	if _, err = Unlock(decoy, Credentials{Password: "decoy"}); err != nil {
+		t.Fatal(err)
+	}
+	decoy.Close()
+
+	// The duress password works while the vault is locked out, without
+	// telling of the lockout
+	for range freeAttempts {
+		if _, _, err = Open("travel", Credentials{Password: "wrong"}); !errors.Is(err, ErrInvalidPassword) {
+			t.Fatalf("Open with a wrong password = %v, want ErrInvalidPassword", err)
+		}
+	}
+	if decoy, _, err = Open("travel", Credentials{Password: "decoy"}); err != nil {
+		t.Fatalf("Open with the duress password while locked out = %v", err)
+	}
+	decoy.Close()
+	file, err := database.Open("travel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = database.NewBoltStore(file)
+	lockout, _, _ := GetUnlockState(db)
+	lockout.LastFailure = lockout.LastFailure.Add(-time.Minute)
+	if err = setUnlockState(db, lockout); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if err = Delete("travel", Credentials{Password: "decoy"}); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("Delete with the duress password = %v, want ErrInvalidPassword", err)
+	}
+	db, key, err := Open("travel", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, created) {
+		t.Fatal("the vault password opened a different key")
+	}
+	state, _, err := GetUnlockState(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Failures != 0 {
+		t.Errorf("the duress password was counted as %d failures", state.Failures)
+	}
+	db.Close()
+
+	if err = RemoveDuress("travel", owner); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = Open("travel", Credentials{Password: "decoy"}); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("Open with a removed duress password = %v, want ErrInvalidPassword", err)
+	}
+	if err = Delete("travel", owner); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("the decoy was left behind: %v", err)
+	}
+}
+
+func TestSchemaMigration(t *testing.T) {
+	setConfigDir(t)
+	creds := Credentials{Password: "secret"}
+	db, _, err := Create("old", creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := database.GetSchemaVersion(db); err != nil || version != database.SchemaVersion() {
+		t.Fatalf("schema version of a new vault = %d, %v", version, err)
+	}
+	// Vaults written before versions were recorded have no header
+	if err = database.DeleteHeaders(db, "schemaVersion"); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if _, _, err = Open("old", Credentials{Password: "wrong"}); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("Open with a wrong password = %v, want ErrInvalidPassword", err)
+	}
+	if backups, err := database.GetBackups("old"); err != nil || len(backups) != 0 {
+		t.Fatalf("a failed attempt left backups behind: %v, %v", backups, err)
+	}
+
+	db, _, err = Open("old", creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := database.GetSchemaVersion(db)
+	if err != nil || version != database.SchemaVersion() {
+		t.Fatalf("schema version after Open = %d, %v", version, err)
+	}
+	backups, err := database.GetBackups("old")
+	if err != nil || len(backups) != 1 {
+		t.Fatalf("backups taken before migrating = %v, %v", backups, err)
+	}
+	// The backup is the vault before the unlock reset the failed attempts
+	backup, err := bolt.Open(backups[0], 0600, &bolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := database.GetSchemaVersion(database.NewBoltStore(backup)); err != nil || version != 0 {
+		t.Fatalf("schema version of the backup = %d, %v, want 0", version, err)
+	}
+	if state, _, err := GetUnlockState(database.NewBoltStore(backup)); err != nil || state.Failures != 1 {
+		t.Fatalf("unlock state of the backup = %+v, %v, want 1 failure", state, err)
+	}
+	backup.Close()
+	if err = database.SetSchemaVersion(db, version+1); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	if _, _, err = Open("old", creds); !errors.Is(err, database.ErrNewerSchema) {
+		t.Fatalf("Open of a vault of a newer version = %v, want ErrNewerSchema", err)
+	}
+	file, err := database.Open("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = database.NewBoltStore(file)
+	defer db.Close()
+	if state, _, err := GetUnlockState(db); err != nil || state.Failures != 0 {
+		t.Fatalf("refusing a newer vault counted as a failed attempt: %+v, %v", state, err)
+	}
+}
+
+func TestMigratePreSeries(t *testing.T) {
+	setConfigDir(t)
+	creds := Credentials{Password: "secret"}
+	db, _, err := Create("old", creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// Strip the vault down to the header and content of the first versions
+	path, err := database.DBPath("old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = file.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{"Metadata", "History", "Trash", "Attachments", "Members", "AuditLog"} {
+			if err := tx.DeleteBucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+		header := tx.Bucket([]byte("Header"))
+		for _, name := range []string{"schemaVersion", unlockStateHeader, "auditKey", "auditHead"} {
+			if err := header.Delete([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = database.DeleteDecoy("old"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A failed attempt changes nothing but the record of it
+	if _, _, err = Open("old", Credentials{Password: "wrong"}); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("Open with a wrong password = %v, want ErrInvalidPassword", err)
+	}
+	if file, err = database.OpenReadOnly("old"); err != nil {
+		t.Fatal(err)
+	}
+	err = file.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("Members")) != nil {
+			return errors.New("buckets were added before the vault was unlocked")
+		}
+		return nil
+	})
+	file.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, cipherKey32, err := Open("old", creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if version, err := database.GetSchemaVersion(db); err != nil || version != database.SchemaVersion() {
+		t.Fatalf("schema version after Open = %d, %v", version, err)
+	}
+	if state, tampered, err := GetUnlockState(db); err != nil || tampered || state.Failures != 0 {
+		t.Fatalf("unlock state after Open = %+v, %v, %v", state, tampered, err)
+	}
+	if _, err = db.GetTrash(); err != nil {
+		t.Fatalf("the trash was not added: %v", err)
+	}
+	records, err := auditlog.Read(db, cipherKey32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Detail != "log started" || records[1].Action != auditlog.Unlock {
+		t.Fatalf("audit log after Open = %+v, want its start and the unlock", records)
+	}
+	if _, _, err = database.GetDecoyHeaders("old"); err != nil {
+		t.Fatalf("the decoy was not added: %v", err)
+	}
+}
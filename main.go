@@ -5,10 +5,29 @@ import (
 	"os"
 
 	"github.com/AdityaKK0407/sentryvault/internal/app"
+	"github.com/AdityaKK0407/sentryvault/internal/config"
 	"github.com/AdityaKK0407/sentryvault/internal/database"
+	"github.com/AdityaKK0407/sentryvault/internal/model"
 )
 
 func main() {
+	// Run a single command when one is given
+	if len(os.Args) > 1 {
+		if err := app.RunCommand(os.Args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "An error occurred: %+v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Load the user configuration before anything is shown
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Printf("Invalid configuration: %v\n\nFix it and check it with: sentryvault config check\n", err)
+		os.Exit(1)
+	}
+	model.Configure(cfg)
+
 	fmt.Println(app.AsciiArt())
 
 	// Get all  users present
@@ -19,37 +38,38 @@ func main() {
 	}
 
 	// Run the Auth
-	username, password, newUser, err := app.RunAuth(files)
+	username, creds, newUser, err := app.RunAuth(files)
 	if err != nil {
 		fmt.Printf("An error occurred: %+v\n", err)
 		os.Exit(1)
 	}
 
-	// Create database instance
-	db, err := database.Open(username)
+	// Create or open the vault
+	store, cipherKey32, err := app.RunCipher(username, creds, newUser)
 	if err != nil {
 		fmt.Printf("An error occurred: %+v\n", err)
 		os.Exit(1)
 	}
 	defer func() {
-		err := db.Close()
+		err := store.Close()
 		if err != nil {
 			fmt.Printf("An error occurred: %+v\n", err)
 			os.Exit(1)
 		}
 	}()
 
-	// Run the encryption/decryption
-	cipherKey32, err := app.RunCipher(db, username, password, newUser)
-	if err != nil {
-		fmt.Printf("An error occurred: %+v\n", err)
-		os.Exit(1)
+	// Offer a way back in should the password of a new vault be forgotten
+	if newUser {
+		if err = app.OfferRecoveryKey(store, username, cipherKey32, creds); err != nil {
+			fmt.Printf("An error occurred: %+v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	var cipherKey64 []byte
 
 	// Run the Model
-	if err = app.RunModel(db, cipherKey32, cipherKey64); err != nil {
+	if err = app.RunModel(store, username, creds.Actor(), cipherKey32, cipherKey64); err != nil {
 		fmt.Printf("An error occurred: %+v\n", err)
 		os.Exit(1)
 	}